@@ -0,0 +1,65 @@
+// Command accrual-stub runs an in-memory imitation of the accrual system,
+// so that gophermart can be started locally without the real service.
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/elina-chertova/loyalty-system/internal/accrualstub"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+)
+
+func main() {
+	if err := run(); err != nil {
+		panic(err)
+	}
+}
+
+// run parses flags, seeds the stub and starts the HTTP server.
+func run() error {
+	var (
+		address  string
+		seedPath string
+		settings accrualstub.Settings
+	)
+	flag.StringVar(&address, "a", "localhost:8080", "address and port to run the stub")
+	flag.StringVar(&seedPath, "seed", "", "path to a JSON file with reward rules and orders")
+	flag.DurationVar(
+		&settings.ProcessingAfter,
+		"processing-after",
+		time.Second,
+		"time after registration when an order becomes PROCESSING",
+	)
+	flag.DurationVar(
+		&settings.ProcessedAfter,
+		"processed-after",
+		3*time.Second,
+		"time after registration when an order gets its final status",
+	)
+	flag.IntVar(
+		&settings.RequestsPerMinute,
+		"rpm",
+		0,
+		"requests per minute allowed for GET /api/orders/{number}, 0 disables throttling",
+	)
+	flag.Parse()
+
+	if err := logger.InitLogger(); err != nil {
+		return err
+	}
+
+	stub := accrualstub.NewStub(settings)
+	if seedPath != "" {
+		if err := stub.LoadFile(seedPath); err != nil {
+			return err
+		}
+	}
+
+	router := gin.Default()
+	router.Use(logger.GinLogger(logger.Logger))
+	stub.RegisterRoutes(router)
+	return router.Run(address)
+}
@@ -6,29 +6,34 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"time"
+	"os"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
-	"go.uber.org/zap"
 	p "net/http/pprof"
 
 	_ "github.com/elina-chertova/loyalty-system/docs"
 	"github.com/elina-chertova/loyalty-system/internal"
 	"github.com/elina-chertova/loyalty-system/internal/auth/middleware"
-	balService "github.com/elina-chertova/loyalty-system/internal/balance/service"
 	"github.com/elina-chertova/loyalty-system/internal/config"
 	"github.com/elina-chertova/loyalty-system/internal/db"
 	handlersDB "github.com/elina-chertova/loyalty-system/internal/db/handlers"
-	ordService "github.com/elina-chertova/loyalty-system/internal/order/service"
+	"github.com/elina-chertova/loyalty-system/internal/db/orderdb"
+	"github.com/elina-chertova/loyalty-system/internal/leader"
+	"github.com/elina-chertova/loyalty-system/internal/worker"
 	"github.com/elina-chertova/loyalty-system/pkg/logger"
 )
 
 // main is the entry point for the Loyalty System application.
+// "gophermart reconcile" runs the balance reconciliation instead of the server.
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(reconcile(os.Args[2:]))
+	}
 	if err := run(); err != nil {
 		fmt.Println("errors in", err.Error())
 		panic(err)
@@ -49,11 +54,22 @@ func run() error {
 	router := routerInit()
 	RegisterPprofRoutes(router)
 	model := db.NewModels(dbConn)
-	service := internal.NewServices(model)
+	service := internal.NewServices(model, params)
 	handler := internal.NewHandlers(service)
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	router.GET("/api/user/ping", handlersDB.Ping(dbConn))
+	router.GET(
+		"/api/internal/accrual/status",
+		middleware.JWTAuth(),
+		middleware.AdminAuth(model.User),
+		handler.Accrual.StatusHandler(),
+	)
+	router.POST(
+		"/api/internal/accrual/callback",
+		middleware.SignatureAuth(config.AccrualCallbackSecret),
+		handler.Callback.AccrualCallbackHandler(),
+	)
 
 	router.POST("/api/user/register", handler.User.RegisterHandler())
 	router.POST("/api/user/login", handler.User.LoginHandler())
@@ -61,6 +77,7 @@ func run() error {
 	router.POST(
 		"/api/user/orders",
 		middleware.JWTAuth(),
+		middleware.Idempotency(model.Idempotency),
 		handler.Order.LoadOrderHandler(),
 	)
 	router.GET(
@@ -68,6 +85,11 @@ func run() error {
 		middleware.JWTAuth(),
 		handler.Order.GetOrdersHandler(),
 	)
+	router.GET(
+		"/api/user/orders/:number/history",
+		middleware.JWTAuth(),
+		handler.Order.GetOrderHistoryHandler(),
+	)
 
 	router.GET(
 		"/api/user/balance",
@@ -78,23 +100,134 @@ func run() error {
 	router.POST(
 		"/api/user/balance/withdraw",
 		middleware.JWTAuth(),
+		middleware.Idempotency(model.Idempotency),
 		handler.Balance.RequestWithdrawFundsHandler(),
 	)
 
+	router.POST(
+		"/api/user/balance/transfer",
+		middleware.JWTAuth(),
+		middleware.Idempotency(model.Idempotency),
+		handler.Balance.TransferHandler(),
+	)
+
+	router.POST(
+		"/api/user/balance/holds",
+		middleware.JWTAuth(),
+		middleware.Idempotency(model.Idempotency),
+		handler.Balance.AuthorizeHoldHandler(),
+	)
+	router.POST(
+		"/api/user/balance/holds/:id/capture",
+		middleware.JWTAuth(),
+		handler.Balance.CaptureHoldHandler(),
+	)
+	router.POST(
+		"/api/user/balance/holds/:id/void",
+		middleware.JWTAuth(),
+		handler.Balance.VoidHoldHandler(),
+	)
+
 	router.GET(
 		"/api/user/withdrawals",
 		middleware.JWTAuth(),
 		handler.Balance.WithdrawalInfoHandler(),
 	)
+	router.GET(
+		"/api/user/statement",
+		middleware.JWTAuth(),
+		handler.Balance.StatementHandler(),
+	)
+	router.GET(
+		"/api/user/statement/export",
+		middleware.JWTAuth(),
+		handler.Balance.ExportStatementHandler(),
+	)
 
-	go func() {
-		for {
-			updateOrderStatusLoop(service.Order, params.AccrualSystemAddress)
-			updateBalanceLoop(service.Order, service.Balance)
-			time.Sleep(config.UpdateInterval)
-		}
+	router.GET(
+		"/api/admin/orders/stuck",
+		middleware.JWTAuth(),
+		middleware.AdminAuth(model.User),
+		handler.Admin.GetStuckOrdersHandler(),
+	)
+	router.POST(
+		"/api/admin/orders/:number/requeue",
+		middleware.JWTAuth(),
+		middleware.AdminAuth(model.User),
+		handler.Admin.RequeueOrderHandler(),
+	)
+	router.POST(
+		"/api/admin/withdrawals/:order/reverse",
+		middleware.JWTAuth(),
+		middleware.AdminAuth(model.User),
+		handler.AdminBalance.ReverseWithdrawalHandler(),
+	)
+	router.GET(
+		"/api/admin/statement/export",
+		middleware.JWTAuth(),
+		middleware.AdminAuth(model.User),
+		handler.AdminBalance.ExportHandler(),
+	)
+	router.POST(
+		"/api/admin/reconcile",
+		middleware.JWTAuth(),
+		middleware.AdminAuth(model.User),
+		handler.AdminBalance.ReconcileHandler(),
+	)
 
-	}()
+	router.POST(
+		"/api/admin/campaigns",
+		middleware.JWTAuth(),
+		middleware.AdminAuth(model.User),
+		handler.Campaign.CreateCampaignHandler(),
+	)
+	router.GET(
+		"/api/admin/campaigns",
+		middleware.JWTAuth(),
+		middleware.AdminAuth(model.User),
+		handler.Campaign.GetCampaignsHandler(),
+	)
+	router.GET(
+		"/api/admin/campaigns/:id",
+		middleware.JWTAuth(),
+		middleware.AdminAuth(model.User),
+		handler.Campaign.GetCampaignHandler(),
+	)
+	router.PUT(
+		"/api/admin/campaigns/:id",
+		middleware.JWTAuth(),
+		middleware.AdminAuth(model.User),
+		handler.Campaign.UpdateCampaignHandler(),
+	)
+	router.DELETE(
+		"/api/admin/campaigns/:id",
+		middleware.JWTAuth(),
+		middleware.AdminAuth(model.User),
+		handler.Campaign.DeleteCampaignHandler(),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Background jobs run only on the replica holding the leadership,
+	// so that orders are not polled and accruals are not credited twice.
+	elector := leader.NewElector(params.DatabaseDSN, config.LeaderLockKey, config.LeaderInterval)
+	go elector.Run(ctx, func(ctx context.Context) {
+		wake := make(chan struct{}, 1)
+		go orderdb.ListenNewOrders(ctx, params.DatabaseDSN, wake)
+		go worker.NewReconcileWorker(service.Balance, config.ReconcileInterval).Run(ctx)
+		go worker.NewExpiryWorker(service.Balance, config.ExpiryInterval).Run(ctx)
+		go worker.NewHoldWorker(service.Balance, config.HoldExpiryInterval).Run(ctx)
+		go worker.NewTierWorker(service.Balance, config.TierRecomputeHour).Run(ctx)
+		go worker.NewIdempotencyWorker(model.Idempotency, config.IdempotencyCleanupInterval).Run(ctx)
+		worker.NewAccrualWorker(
+			service.Poller,
+			service.Order,
+			service.Balance,
+			wake,
+			params.IdleInterval,
+		).Run(ctx)
+	})
 
 	err = router.Run(params.Address)
 	if err != nil {
@@ -103,25 +236,6 @@ func run() error {
 	return nil
 }
 
-// updateOrderStatusLoop periodically checks and updates the status
-// of orders by communicating with the external accrual system.
-func updateOrderStatusLoop(order *ordService.UserOrder, accrualServerAddress string) {
-	err := order.UpdateOrderStatus(accrualServerAddress)
-	if err != nil {
-		logger.Logger.Warn("Order status has not been updated", zap.Error(err))
-	}
-}
-
-// updateBalanceLoop periodically updates user balances based on
-// the latest order accruals.
-func updateBalanceLoop(order *ordService.UserOrder, balance *balService.UserBalance) {
-	err := balance.UpdateBalance(order)
-	if err != nil {
-		logger.Logger.Warn("Balance has not been updated", zap.Error(err))
-		return
-	}
-}
-
 // routerInit initializes and returns a new Gin engine instance,
 // setting up middleware and compression settings.
 func routerInit() *gin.Engine {
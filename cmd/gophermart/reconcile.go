@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	balService "github.com/elina-chertova/loyalty-system/internal/balance/service"
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/internal/db"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+)
+
+// reconcile recomputes the balances of all users from the source data and
+// prints the drifted ones. With --fix the drifted balances are corrected.
+// Returns the exit code: 0 if no balance drifted or all drifts were fixed,
+// 1 if drifts remain and 2 if the reconciliation failed.
+func reconcile(args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	databaseDSN := flags.String("d", config.DefaultDatabaseDSN, "Database DSN")
+	fix := flags.Bool("fix", false, "correct the drifted balances by adjustments")
+	_ = flags.Parse(args)
+	if envDSN := os.Getenv("DATABASE_URI"); envDSN != "" {
+		*databaseDSN = envDSN
+	}
+
+	if err := logger.InitLogger(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	balance := balService.NewBalance(db.NewModels(db.Init(*databaseDSN)).Balance)
+
+	drifts, err := balance.CheckDrift(*fix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reconciliation failed:", err)
+		return 2
+	}
+
+	if len(drifts) == 0 {
+		fmt.Println("no drifted balances")
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tCURRENT\tEXPECTED CURRENT\tWITHDRAWN\tEXPECTED WITHDRAWN")
+	for _, d := range drifts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.UserID, d.Current, d.ExpectedCurrent, d.Withdrawn, d.ExpectedWithdrawn)
+	}
+	_ = w.Flush()
+
+	if *fix {
+		fmt.Printf("%d drifted balances fixed\n", len(drifts))
+		return 0
+	}
+	fmt.Printf("%d drifted balances, run with --fix to correct them\n", len(drifts))
+	return 1
+}
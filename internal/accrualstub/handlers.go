@@ -0,0 +1,109 @@
+package accrualstub
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes registers the accrual system API of the stub on the router:
+//
+//	GET  /api/orders/:number  accrual state of an order
+//	POST /api/orders          register an order with its goods
+//	POST /api/goods           register a reward rule
+//	POST /api/seed            load rules and orders in the seed file format
+func (stub *Stub) RegisterRoutes(router gin.IRouter) {
+	router.GET("/api/orders/:number", stub.GetOrderHandler())
+	router.POST("/api/orders", stub.RegisterOrderHandler())
+	router.POST("/api/goods", stub.AddRuleHandler())
+	router.POST("/api/seed", stub.SeedHandler())
+}
+
+// GetOrderHandler answers with the accrual state of an order, 204 No Content
+// for unknown orders and 429 Too Many Requests when the limit is exceeded.
+func (stub *Stub) GetOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ok, retryAfter := stub.Allow(); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.String(
+				http.StatusTooManyRequests,
+				fmt.Sprintf(
+					"No more than %d requests per minute allowed",
+					stub.settings.RequestsPerMinute,
+				),
+			)
+			return
+		}
+
+		order, err := stub.GetOrder(c.Param("number"))
+		if errors.Is(err, ErrorOrderNotRegistered) {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// RegisterOrderHandler registers an order for accrual calculation.
+func (stub *Stub) RegisterOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var registration OrderRegistration
+		if err := c.BindJSON(&registration); err != nil {
+			return
+		}
+
+		err := stub.RegisterOrder(registration)
+		switch {
+		case errors.Is(err, ErrorOrderExists):
+			c.String(http.StatusConflict, err.Error())
+		case err != nil:
+			c.String(http.StatusBadRequest, err.Error())
+		default:
+			c.Status(http.StatusAccepted)
+		}
+	}
+}
+
+// AddRuleHandler registers a reward rule.
+func (stub *Stub) AddRuleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule RewardRule
+		if err := c.BindJSON(&rule); err != nil {
+			return
+		}
+
+		err := stub.AddRule(rule)
+		switch {
+		case errors.Is(err, ErrorRuleExists):
+			c.String(http.StatusConflict, err.Error())
+		case err != nil:
+			c.String(http.StatusBadRequest, err.Error())
+		default:
+			c.Status(http.StatusOK)
+		}
+	}
+}
+
+// SeedHandler loads rules and orders in the seed file format.
+func (stub *Stub) SeedHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var seed Seed
+		if err := c.BindJSON(&seed); err != nil {
+			return
+		}
+
+		if err := stub.Load(seed); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+}
@@ -0,0 +1,254 @@
+// Package accrualstub provides an in-process imitation of the external
+// accrual system for local development. It keeps reward rules and orders in
+// memory, simulates status transitions over time and throttles requests
+// the same way the real accrual system does.
+package accrualstub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/order/service"
+	"github.com/elina-chertova/loyalty-system/internal/order/utils"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+)
+
+// Accrual system statuses of a registered order.
+const (
+	StatusRegistered = "REGISTERED"
+	StatusProcessing = "PROCESSING"
+	StatusProcessed  = "PROCESSED"
+	StatusInvalid    = "INVALID"
+)
+
+// Reward types of a RewardRule.
+const (
+	RewardPercent = "%"
+	RewardPoints  = "pt"
+)
+
+// Predefined errors for stub operations.
+var (
+	ErrorRuleExists         = errors.New("reward rule already exists")
+	ErrorOrderExists        = errors.New("order is already registered")
+	ErrorNotValidOrder      = errors.New("order number is not valid")
+	ErrorNotValidRule       = errors.New("reward rule is not valid")
+	ErrorNotValidStatus     = errors.New("order status is not valid")
+	ErrorOrderNotRegistered = errors.New("order is not registered")
+)
+
+// RewardRule describes the reward for goods whose description contains Match.
+type RewardRule struct {
+	Match      string  `json:"match"`
+	Reward     float64 `json:"reward"`
+	RewardType string  `json:"reward_type"`
+}
+
+// Good is a single position of a registered order.
+type Good struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+// OrderRegistration is the payload of POST /api/orders. Status and Accrual
+// are stub extensions which seed the final outcome of the order regardless
+// of the reward rules. Seeding REGISTERED or PROCESSING pins the order
+// in that status.
+type OrderRegistration struct {
+	Order   string   `json:"order"`
+	Goods   []Good   `json:"goods"`
+	Status  string   `json:"status,omitempty"`
+	Accrual *float64 `json:"accrual,omitempty"`
+}
+
+// Seed is the format of the seed file and of POST /api/seed.
+type Seed struct {
+	Goods  []RewardRule        `json:"goods"`
+	Orders []OrderRegistration `json:"orders"`
+}
+
+// Settings configures the behaviour of the Stub.
+type Settings struct {
+	// ProcessingAfter is the time after registration when an order
+	// moves from REGISTERED to PROCESSING.
+	ProcessingAfter time.Duration
+	// ProcessedAfter is the time after registration when an order
+	// reaches its final status.
+	ProcessedAfter time.Duration
+	// RequestsPerMinute limits GET /api/orders/{number}. Zero disables throttling.
+	RequestsPerMinute int
+}
+
+type order struct {
+	registration OrderRegistration
+	registeredAt time.Time
+}
+
+// Stub is an in-memory accrual system.
+type Stub struct {
+	mu       sync.Mutex
+	settings Settings
+	rules    []RewardRule
+	orders   map[string]*order
+
+	windowStart time.Time
+	windowCount int
+
+	now func() time.Time
+}
+
+// NewStub creates a new Stub with no rules and no orders.
+func NewStub(settings Settings) *Stub {
+	return &Stub{
+		settings: settings,
+		orders:   make(map[string]*order),
+		now:      time.Now,
+	}
+}
+
+// AddRule registers a new reward rule.
+func (stub *Stub) AddRule(rule RewardRule) error {
+	if rule.Match == "" || rule.Reward < 0 ||
+		(rule.RewardType != RewardPercent && rule.RewardType != RewardPoints) {
+		return ErrorNotValidRule
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	for _, r := range stub.rules {
+		if r.Match == rule.Match {
+			return ErrorRuleExists
+		}
+	}
+	stub.rules = append(stub.rules, rule)
+	return nil
+}
+
+// RegisterOrder registers a new order for accrual calculation.
+func (stub *Stub) RegisterOrder(registration OrderRegistration) error {
+	if !utils.IsLuhnValid(registration.Order) || registration.Order == "" {
+		return ErrorNotValidOrder
+	}
+	switch registration.Status {
+	case "", StatusRegistered, StatusProcessing, StatusProcessed, StatusInvalid:
+	default:
+		return fmt.Errorf("%w: %s", ErrorNotValidStatus, registration.Status)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if _, exists := stub.orders[registration.Order]; exists {
+		return ErrorOrderExists
+	}
+	stub.orders[registration.Order] = &order{
+		registration: registration,
+		registeredAt: stub.now(),
+	}
+	return nil
+}
+
+// Load registers the rules and orders of the seed.
+func (stub *Stub) Load(seed Seed) error {
+	for _, rule := range seed.Goods {
+		if err := stub.AddRule(rule); err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Match, err)
+		}
+	}
+	for _, registration := range seed.Orders {
+		if err := stub.RegisterOrder(registration); err != nil {
+			return fmt.Errorf("order %q: %w", registration.Order, err)
+		}
+	}
+	return nil
+}
+
+// LoadFile reads a seed from the JSON file at path.
+func (stub *Stub) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var seed Seed
+	if err := json.Unmarshal(data, &seed); err != nil {
+		return err
+	}
+	return stub.Load(seed)
+}
+
+// Allow counts a request against the per-minute limit. When the limit is
+// exceeded it returns false and the time until the next request is allowed.
+func (stub *Stub) Allow() (bool, time.Duration) {
+	if stub.settings.RequestsPerMinute <= 0 {
+		return true, 0
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	now := stub.now()
+	if now.Sub(stub.windowStart) >= time.Minute {
+		stub.windowStart = now
+		stub.windowCount = 0
+	}
+	if stub.windowCount >= stub.settings.RequestsPerMinute {
+		return false, stub.windowStart.Add(time.Minute).Sub(now)
+	}
+	stub.windowCount++
+	return true, 0
+}
+
+// GetOrder returns the current accrual state of the order. The status
+// depends on the time elapsed since the order was registered.
+func (stub *Stub) GetOrder(number string) (service.OrderLoyaltyFormat, error) {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+
+	o, exists := stub.orders[number]
+	if !exists {
+		return service.OrderLoyaltyFormat{}, ErrorOrderNotRegistered
+	}
+
+	elapsed := stub.now().Sub(o.registeredAt)
+	status := o.registration.Status
+	switch {
+	case status == StatusRegistered || status == StatusProcessing:
+		return service.OrderLoyaltyFormat{Order: number, Status: status}, nil
+	case elapsed < stub.settings.ProcessingAfter:
+		return service.OrderLoyaltyFormat{Order: number, Status: StatusRegistered}, nil
+	case elapsed < stub.settings.ProcessedAfter:
+		return service.OrderLoyaltyFormat{Order: number, Status: StatusProcessing}, nil
+	case status == StatusInvalid:
+		return service.OrderLoyaltyFormat{Order: number, Status: StatusInvalid}, nil
+	}
+
+	accrual := stub.calculateAccrual(o.registration.Goods)
+	if o.registration.Accrual != nil {
+		accrual = *o.registration.Accrual
+	}
+	return service.OrderLoyaltyFormat{Order: number, Status: StatusProcessed, Accrual: money.FromFloat(accrual)}, nil
+}
+
+// calculateAccrual sums up the rewards of the goods. Every good is rewarded
+// by the first rule matching its description.
+func (stub *Stub) calculateAccrual(goods []Good) float64 {
+	var accrual float64
+	for _, good := range goods {
+		for _, rule := range stub.rules {
+			if !strings.Contains(good.Description, rule.Match) {
+				continue
+			}
+			if rule.RewardType == RewardPercent {
+				accrual += good.Price * rule.Reward / 100
+			} else {
+				accrual += rule.Reward
+			}
+			break
+		}
+	}
+	return math.Round(accrual*100) / 100
+}
@@ -0,0 +1,147 @@
+package accrualstub
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/order/service"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStub(settings Settings) (*Stub, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stub := NewStub(settings)
+	stub.now = func() time.Time { return now }
+	return stub, &now
+}
+
+func TestStub_GetOrderTransitions(t *testing.T) {
+	stub, now := newTestStub(
+		Settings{ProcessingAfter: time.Second, ProcessedAfter: 3 * time.Second},
+	)
+	assert.NoError(t, stub.AddRule(RewardRule{Match: "Bork", Reward: 10, RewardType: RewardPercent}))
+	assert.NoError(t, stub.AddRule(RewardRule{Match: "LG", Reward: 50, RewardType: RewardPoints}))
+	assert.NoError(
+		t, stub.RegisterOrder(
+			OrderRegistration{
+				Order: "79927398713",
+				Goods: []Good{
+					{Description: "Чайник Bork", Price: 7000.55},
+					{Description: "Телевизор LG", Price: 30000},
+					{Description: "Хлеб", Price: 50},
+				},
+			},
+		),
+	)
+
+	steps := []struct {
+		elapsed time.Duration
+		want    service.OrderLoyaltyFormat
+	}{
+		{0, service.OrderLoyaltyFormat{Order: "79927398713", Status: StatusRegistered}},
+		{time.Second, service.OrderLoyaltyFormat{Order: "79927398713", Status: StatusProcessing}},
+		{
+			2 * time.Second,
+			service.OrderLoyaltyFormat{Order: "79927398713", Status: StatusProcessed, Accrual: money.FromFloat(750.06)},
+		},
+	}
+	for _, step := range steps {
+		*now = now.Add(step.elapsed)
+		order, err := stub.GetOrder("79927398713")
+		assert.NoError(t, err)
+		assert.Equal(t, step.want, order)
+	}
+
+	_, err := stub.GetOrder("12345678903")
+	assert.ErrorIs(t, err, ErrorOrderNotRegistered)
+}
+
+func TestStub_Validation(t *testing.T) {
+	stub, _ := newTestStub(Settings{})
+
+	assert.ErrorIs(t, stub.AddRule(RewardRule{Match: "LG", RewardType: "x"}), ErrorNotValidRule)
+	assert.NoError(t, stub.AddRule(RewardRule{Match: "LG", Reward: 1, RewardType: RewardPoints}))
+	assert.ErrorIs(t, stub.AddRule(RewardRule{Match: "LG", Reward: 2, RewardType: RewardPoints}), ErrorRuleExists)
+
+	assert.ErrorIs(t, stub.RegisterOrder(OrderRegistration{Order: "123"}), ErrorNotValidOrder)
+	assert.ErrorIs(
+		t,
+		stub.RegisterOrder(OrderRegistration{Order: "79927398713", Status: "DONE"}),
+		ErrorNotValidStatus,
+	)
+	assert.NoError(t, stub.RegisterOrder(OrderRegistration{Order: "79927398713"}))
+	assert.ErrorIs(t, stub.RegisterOrder(OrderRegistration{Order: "79927398713"}), ErrorOrderExists)
+}
+
+func TestStub_LoadFile(t *testing.T) {
+	stub, _ := newTestStub(Settings{})
+	accrual := 729.98
+	seed := Seed{
+		Orders: []OrderRegistration{
+			{Order: "12345678903", Status: StatusInvalid},
+			{Order: "4561261212345467", Status: StatusProcessed, Accrual: &accrual},
+			{Order: "79927398713", Status: StatusProcessing},
+		},
+	}
+	data, _ := json.Marshal(seed)
+	path := filepath.Join(t.TempDir(), "seed.json")
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+
+	assert.NoError(t, stub.LoadFile(path))
+
+	order, _ := stub.GetOrder("12345678903")
+	assert.Equal(t, StatusInvalid, order.Status)
+	order, _ = stub.GetOrder("4561261212345467")
+	assert.Equal(t, service.OrderLoyaltyFormat{Order: "4561261212345467", Status: StatusProcessed, Accrual: money.FromFloat(729.98)}, order)
+	order, _ = stub.GetOrder("79927398713")
+	assert.Equal(t, StatusProcessing, order.Status)
+}
+
+func TestStub_Handlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stub, now := newTestStub(Settings{RequestsPerMinute: 2})
+	router := gin.New()
+	stub.RegisterRoutes(router)
+
+	serve := func(method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			_ = json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	rule := RewardRule{Match: "Bork", Reward: 10, RewardType: RewardPercent}
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/goods", rule).Code)
+	assert.Equal(t, http.StatusConflict, serve(http.MethodPost, "/api/goods", rule).Code)
+
+	registration := OrderRegistration{Order: "79927398713", Goods: []Good{{Description: "Bork", Price: 100}}}
+	assert.Equal(t, http.StatusAccepted, serve(http.MethodPost, "/api/orders", registration).Code)
+	assert.Equal(t, http.StatusConflict, serve(http.MethodPost, "/api/orders", registration).Code)
+
+	w := serve(http.MethodGet, "/api/orders/79927398713", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var order service.OrderLoyaltyFormat
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+	assert.Equal(t, service.OrderLoyaltyFormat{Order: "79927398713", Status: StatusProcessed, Accrual: money.FromFloat(10)}, order)
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodGet, "/api/orders/12345678903", nil).Code)
+
+	w = serve(http.MethodGet, "/api/orders/79927398713", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	*now = now.Add(time.Minute)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/orders/79927398713", nil).Code)
+}
@@ -14,12 +14,25 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"time"
 )
 
+var (
+	serverOnce sync.Once
+	server     *config.Settings
+)
+
+// testServer returns the settings shared by the examples, which define
+// the command line flags only once.
+func testServer() *config.Settings {
+	serverOnce.Do(func() { server = config.NewServer() })
+	return server
+}
+
 func ExampleAuthHandler_registerHandler() {
 	router := gin.Default()
-	params := config.NewServer()
+	params := testServer()
 
 	conn := db.Init(params.DatabaseDSN)
 	udb := userdb.NewUserModel(conn)
@@ -60,7 +73,7 @@ func ExampleAuthHandler_registerHandler() {
 
 func ExampleAuthHandler_loginHandler() {
 	router := gin.Default()
-	params := config.NewServer()
+	params := testServer()
 
 	conn := db.Init(params.DatabaseDSN)
 	udb := userdb.NewUserModel(conn)
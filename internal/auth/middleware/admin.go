@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/elina-chertova/loyalty-system/internal/auth/handlers"
+	"github.com/elina-chertova/loyalty-system/internal/db/userdb"
+	"github.com/elina-chertova/loyalty-system/internal/security"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth is a middleware function for the Gin framework that lets only
+// administrators through. It must be placed after JWTAuth, which stores
+// the validated token in the context.
+func AdminAuth(users userdb.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, exists := c.Get("token")
+		if !exists {
+			c.AbortWithStatusJSON(
+				http.StatusUnauthorized,
+				handlers.Response{
+					Message: "Token not found",
+					Status:  "Unauthorized",
+				},
+			)
+			return
+		}
+
+		userID, err := security.GetUserIDFromToken(fmt.Sprintf("%v", token))
+		if err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusUnauthorized,
+				handlers.Response{
+					Message: err.Error(),
+					Status:  "Unauthorized",
+				},
+			)
+			return
+		}
+
+		user, err := users.GetUserByID(userID)
+		if err != nil || !user.IsAdmin {
+			c.AbortWithStatusJSON(
+				http.StatusForbidden,
+				handlers.Response{
+					Message: "Administrator rights required",
+					Status:  "Forbidden",
+				},
+			)
+			return
+		}
+
+		c.Next()
+	}
+}
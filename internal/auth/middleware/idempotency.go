@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/elina-chertova/loyalty-system/internal/auth/handlers"
+	"github.com/elina-chertova/loyalty-system/internal/db/idempotencydb"
+	"github.com/elina-chertova/loyalty-system/internal/security"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Headers used by the Idempotency middleware.
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKeyLength limits the length of an idempotency key.
+const maxIdempotencyKeyLength = 255
+
+// Idempotency is a middleware function for the Gin framework that makes
+// retries of a request safe. A request with an Idempotency-Key header is
+// executed once per user and key: the response is stored, and replays of the
+// request with the same key return the stored response. Reusing a key for
+// a different request is rejected with 422, a replay of a request still in
+// progress with 409. Server errors are not stored, so such requests can be
+// retried with the same key; neither are the responses of handlers which
+// panicked or which could not be stored. A reservation left in progress by
+// a crashed replica is reclaimed after config.IdempotencyReservationTTL.
+// Requests without the header are not affected. It must run after JWTAuth.
+func Idempotency(keys idempotencydb.IdempotencyRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				handlers.Response{
+					Message: fmt.Sprintf("%s is too long", IdempotencyKeyHeader),
+					Status:  "Wrong entered data",
+				},
+			)
+			return
+		}
+
+		token, _ := c.Get("token")
+		userID, err := security.GetUserIDFromToken(fmt.Sprintf("%v", token))
+		if err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusUnauthorized,
+				handlers.Response{
+					Message: err.Error(),
+					Status:  "Unauthorized",
+				},
+			)
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				handlers.Response{
+					Message: err.Error(),
+					Status:  "Wrong entered data",
+				},
+			)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := requestHash(c.Request, body)
+		record, created, err := keys.ReserveKey(userID, key, hash)
+		if err != nil {
+			abortWithServerError(c, err)
+			return
+		}
+		if !created {
+			replay(c, record, hash)
+			return
+		}
+
+		// The reservation is released unless the response is stored,
+		// including when a handler panics.
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := keys.ReleaseKey(userID, key); err != nil {
+				logger.Logger.Error(
+					"Idempotency key has not been released",
+					zap.String("endpoint", c.Request.URL.Path),
+					zap.Error(err),
+				)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if recorder.Status() >= http.StatusInternalServerError {
+			return
+		}
+		err = keys.CompleteKey(
+			userID,
+			key,
+			recorder.Status(),
+			recorder.Header().Get("Content-Type"),
+			recorder.body.Bytes(),
+		)
+		if err != nil {
+			logger.Logger.Error(
+				"Idempotency key has not been stored",
+				zap.String("endpoint", c.Request.URL.Path),
+				zap.Error(err),
+			)
+			return
+		}
+		completed = true
+	}
+}
+
+// replay answers a repeated request with the stored response.
+func replay(c *gin.Context, record idempotencydb.IdempotencyKey, hash string) {
+	switch {
+	case record.RequestHash != hash:
+		c.AbortWithStatusJSON(
+			http.StatusUnprocessableEntity,
+			handlers.Response{
+				Message: fmt.Sprintf("%s has already been used for a different request", IdempotencyKeyHeader),
+				Status:  "Idempotency key reused",
+			},
+		)
+	case record.StatusCode == 0:
+		c.AbortWithStatusJSON(
+			http.StatusConflict,
+			handlers.Response{
+				Message: "Request with this idempotency key is in progress",
+				Status:  "Conflict",
+			},
+		)
+	default:
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Data(record.StatusCode, record.ContentType, record.Body)
+		c.Abort()
+	}
+}
+
+// requestHash identifies the request by its method, path and body.
+func requestHash(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// abortWithServerError aborts the request with 500.
+func abortWithServerError(c *gin.Context, err error) {
+	logger.Logger.Error(
+		"Server error",
+		zap.String("endpoint", c.Request.URL.Path),
+		zap.Error(err),
+	)
+	c.AbortWithStatusJSON(
+		http.StatusInternalServerError,
+		handlers.Response{
+			Message: err.Error(),
+			Status:  "Server error",
+		},
+	)
+}
+
+// responseRecorder copies the response body written by the handlers.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write writes the data to the response and keeps a copy of it.
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+// WriteString writes the string to the response and keeps a copy of it.
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+
+	"github.com/elina-chertova/loyalty-system/internal/db/idempotencydb"
+	"github.com/elina-chertova/loyalty-system/internal/security"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockIdempotencyRepository struct {
+	mu           sync.Mutex
+	Keys         map[string]idempotencydb.IdempotencyKey
+	FailComplete bool
+}
+
+func NewMockIdempotencyRepository() *MockIdempotencyRepository {
+	return &MockIdempotencyRepository{Keys: make(map[string]idempotencydb.IdempotencyKey)}
+}
+
+func (m *MockIdempotencyRepository) ReserveKey(
+	userID uuid.UUID,
+	key string,
+	requestHash string,
+) (idempotencydb.IdempotencyKey, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, exists := m.Keys[userID.String()+key]
+	stale := stored.StatusCode == 0 && stored.UpdatedAt.Before(time.Now().Add(-config.IdempotencyReservationTTL))
+	if exists && !stale {
+		return stored, false, nil
+	}
+	record := idempotencydb.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	m.Keys[userID.String()+key] = record
+	return record, true, nil
+}
+
+func (m *MockIdempotencyRepository) CompleteKey(
+	userID uuid.UUID,
+	key string,
+	statusCode int,
+	contentType string,
+	body []byte,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.FailComplete {
+		return errors.New("connection lost")
+	}
+	record := m.Keys[userID.String()+key]
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = body
+	m.Keys[userID.String()+key] = record
+	return nil
+}
+
+func (m *MockIdempotencyRepository) ReleaseKey(userID uuid.UUID, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.Keys, userID.String()+key)
+	return nil
+}
+
+func (m *MockIdempotencyRepository) DeleteExpiredKeys(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for k, record := range m.Keys {
+		if record.CreatedAt.Before(before) {
+			delete(m.Keys, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	calls := 0
+	status := http.StatusOK
+	router := gin.New()
+	router.POST(
+		"/withdraw",
+		func(c *gin.Context) {
+			c.Set("token", c.GetHeader("Authorization"))
+		},
+		Idempotency(NewMockIdempotencyRepository()),
+		func(c *gin.Context) {
+			calls++
+			c.JSON(status, gin.H{"call": calls})
+		},
+	)
+
+	owner, _ := security.GenerateToken(uuid.New())
+	stranger, _ := security.GenerateToken(uuid.New())
+	send := func(token, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/withdraw", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", token)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := send(owner, "key-1", `{"order": "2377225624", "sum": 751}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.JSONEq(t, `{"call": 1}`, first.Body.String())
+
+	replayed := send(owner, "key-1", `{"order": "2377225624", "sum": 751}`)
+	assert.Equal(t, http.StatusOK, replayed.Code)
+	assert.JSONEq(t, `{"call": 1}`, replayed.Body.String())
+	assert.Equal(t, "true", replayed.Header().Get(IdempotentReplayedHeader))
+
+	reused := send(owner, "key-1", `{"order": "2377225624", "sum": 1}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+
+	other := send(stranger, "key-1", `{"order": "2377225624", "sum": 751}`)
+	assert.JSONEq(t, `{"call": 2}`, other.Body.String())
+
+	withoutKey := send(owner, "", `{"order": "2377225624", "sum": 751}`)
+	assert.JSONEq(t, `{"call": 3}`, withoutKey.Body.String())
+
+	status = http.StatusInternalServerError
+	assert.Equal(t, http.StatusInternalServerError, send(owner, "key-2", `{}`).Code)
+	status = http.StatusOK
+	retried := send(owner, "key-2", `{}`)
+	assert.JSONEq(t, `{"call": 5}`, retried.Body.String(), "server errors are not stored")
+
+	assert.Equal(t, 5, calls)
+}
+
+func TestIdempotency_Release(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keys := NewMockIdempotencyRepository()
+	calls := 0
+	panics := true
+	router := gin.New()
+	router.Use(gin.RecoveryWithWriter(io.Discard))
+	router.POST(
+		"/withdraw",
+		func(c *gin.Context) {
+			c.Set("token", c.GetHeader("Authorization"))
+		},
+		Idempotency(keys),
+		func(c *gin.Context) {
+			calls++
+			if panics {
+				panic("handler failed")
+			}
+			c.JSON(http.StatusOK, gin.H{"call": calls})
+		},
+	)
+
+	userID := uuid.New()
+	token, _ := security.GenerateToken(userID)
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/withdraw", bytes.NewBufferString(`{}`))
+		req.Header.Set("Authorization", token)
+		req.Header.Set(IdempotencyKeyHeader, key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, send("key-1").Code)
+	assert.Empty(t, keys.Keys, "the reservation of a panicked request is released")
+	panics = false
+
+	keys.FailComplete = true
+	assert.JSONEq(t, `{"call": 2}`, send("key-1").Body.String())
+	assert.Empty(t, keys.Keys, "the reservation is released if the response cannot be stored")
+	keys.FailComplete = false
+
+	keys.Keys[userID.String()+"key-2"] = idempotencydb.IdempotencyKey{
+		UserID:      userID,
+		Key:         "key-2",
+		RequestHash: requestHash(httptest.NewRequest(http.MethodPost, "/withdraw", nil), []byte(`{}`)),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	assert.Equal(t, http.StatusConflict, send("key-2").Code)
+	abandoned := keys.Keys[userID.String()+"key-2"]
+	abandoned.UpdatedAt = time.Now().Add(-2 * config.IdempotencyReservationTTL)
+	keys.Keys[userID.String()+"key-2"] = abandoned
+	assert.JSONEq(t, `{"call": 3}`, send("key-2").Body.String(), "an abandoned reservation is reclaimed")
+
+	deleted, err := keys.DeleteExpiredKeys(time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
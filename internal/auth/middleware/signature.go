@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/elina-chertova/loyalty-system/internal/auth/handlers"
+	"github.com/elina-chertova/loyalty-system/internal/security"
+	"github.com/gin-gonic/gin"
+)
+
+// SignatureHeader is the header carrying the HMAC signature of the request body.
+const SignatureHeader = "X-Accrual-Signature"
+
+// SignatureAuth is a middleware function for the Gin framework that
+// authenticates requests from external systems. The request body must be
+// signed with the shared secret, see security.SignPayload, and the signature
+// passed in SignatureHeader. The body is restored for the next handlers.
+func SignatureAuth(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				handlers.Response{
+					Message: err.Error(),
+					Status:  "Wrong entered data",
+				},
+			)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		if !security.VerifySignature(secret, body, c.GetHeader(SignatureHeader)) {
+			c.AbortWithStatusJSON(
+				http.StatusUnauthorized,
+				handlers.Response{
+					Message: "Check request signature",
+					Status:  "Unauthorized",
+				},
+			)
+			return
+		}
+
+		c.Next()
+	}
+}
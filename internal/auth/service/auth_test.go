@@ -34,6 +34,10 @@ func (m *MockUserRepository) GetUserByName(login string) (userdb.User, error) {
 	return userdb.User{}, gorm.ErrRecordNotFound
 }
 
+func (m *MockUserRepository) GetUserByID(userID uuid.UUID) (userdb.User, error) {
+	return userdb.User{}, gorm.ErrRecordNotFound
+}
+
 func (m *MockUserRepository) AddUser(login, password string, isAdmin bool) error {
 	if login == "existingUser" {
 		return errors.New("user already exists")
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/balance/service"
+	"github.com/elina-chertova/loyalty-system/internal/db/balancedb"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminBalanceService interface {
+	ReverseWithdrawal(order, reason string) (service.WithdrawalFormat, error)
+	ExportAll(from, to time.Time, format service.ExportFormat, w io.Writer) error
+	CheckDrift(fix bool) ([]balancedb.Drift, error)
+}
+
+type AdminBalanceHandler struct {
+	balance AdminBalanceService
+}
+
+func NewAdminBalanceHandler(b AdminBalanceService) *AdminBalanceHandler {
+	return &AdminBalanceHandler{balance: b}
+}
+
+type reversal struct {
+	Reason string `json:"reason"`
+}
+
+type driftReport struct {
+	Fixed  bool              `json:"fixed"`
+	Drifts []balancedb.Drift `json:"drifts"`
+}
+
+// ReverseWithdrawalHandler reverses the withdrawal made for the order,
+// returning the points to the user's balance. Reversing a withdrawal again
+// returns it unchanged.
+func (balance *AdminBalanceHandler) ReverseWithdrawalHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var r reversal
+		if err := c.BindJSON(&r); err != nil {
+			respondWithError(c, http.StatusBadRequest, "Check json input", err)
+			return
+		}
+
+		withdrawal, err := balance.balance.ReverseWithdrawal(c.Param("order"), r.Reason)
+		switch {
+		case errors.Is(err, service.ErrorEmptyReason):
+			respondWithError(c, http.StatusBadRequest, "error in ReverseWithdrawal", err)
+			return
+		case errors.Is(err, service.ErrorWithdrawalNotFound):
+			respondWithError(c, http.StatusNotFound, "error in ReverseWithdrawal", err)
+			return
+		case errors.Is(err, service.ErrorNotReversible):
+			respondWithError(c, http.StatusConflict, "error in ReverseWithdrawal", err)
+			return
+		case err != nil:
+			respondWithError(c, http.StatusInternalServerError, "error in ReverseWithdrawal", err)
+			return
+		}
+
+		respondWithJSON(c, http.StatusOK, withdrawal)
+	}
+}
+
+// ExportHandler downloads the orders, accruals and withdrawals of every user
+// created within the from and to query parameters as CSV or JSON Lines.
+func (balance *AdminBalanceHandler) ExportHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format, err := service.ParseExportFormat(c.Query("format"))
+		if err != nil {
+			respondWithError(c, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		from, to, err := service.ParsePeriod(c.Query("from"), c.Query("to"))
+		if err != nil {
+			respondWithError(c, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+
+		name := "statement-all"
+		if !from.IsZero() {
+			name += "-from-" + from.UTC().Format("20060102")
+		}
+		if !to.IsZero() {
+			name += "-to-" + to.UTC().Format("20060102")
+		}
+		setExportHeaders(c, name, format)
+		if err := balance.balance.ExportAll(from, to, format, c.Writer); err != nil {
+			logExportError(c, err)
+		}
+	}
+}
+
+// ReconcileHandler recomputes the balances of all users from the source data
+// and reports the drifted ones. With the fix=true query parameter the drifted
+// balances are corrected by adjustments.
+func (balance *AdminBalanceHandler) ReconcileHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fix := c.Query("fix") == "true"
+		drifts, err := balance.balance.CheckDrift(fix)
+		if err != nil {
+			respondWithError(c, http.StatusInternalServerError, "error in CheckDrift", err)
+			return
+		}
+		if drifts == nil {
+			drifts = []balancedb.Drift{}
+		}
+		respondWithJSON(c, http.StatusOK, driftReport{Fixed: fix, Drifts: drifts})
+	}
+}
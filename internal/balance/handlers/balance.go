@@ -4,11 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/elina-chertova/loyalty-system/internal/auth/handlers"
 	"github.com/elina-chertova/loyalty-system/internal/balance/service"
 	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -16,9 +19,15 @@ import (
 
 type BalanceService interface {
 	GetBalance(token string) (service.UserBalanceFormat, error)
-	WithdrawFunds(token, order string, sum float64) error
+	WithdrawFunds(token, order string, sum money.Points) error
 	WithdrawalInfo(token string) ([]service.WithdrawalFormat, error)
 	AddInitialBalance(userID uuid.UUID) error
+	AuthorizeHold(token, order string, sum money.Points) (service.HoldFormat, error)
+	CaptureHold(token, holdID string) (service.WithdrawalFormat, error)
+	VoidHold(token, holdID string) (service.HoldFormat, error)
+	Transfer(token, recipient string, sum money.Points) (service.TransferFormat, error)
+	Statement(token string, query service.StatementQuery) (service.StatementFormat, error)
+	ExportStatement(token string, format service.ExportFormat, w io.Writer) error
 }
 
 type BalanceHandler struct {
@@ -32,8 +41,13 @@ func NewBalanceHandler(b BalanceService) *BalanceHandler {
 var ErrorTokenNotFound = errors.New("token not found")
 
 type withdraw struct {
-	Order string  `json:"order"`
-	Sum   float64 `json:"sum"`
+	Order string       `json:"order"`
+	Sum   money.Points `json:"sum"`
+}
+
+type transfer struct {
+	Recipient string       `json:"recipient" binding:"required"`
+	Sum       money.Points `json:"sum"`
 }
 
 // WithdrawalInfoHandler @Get Info About User Withdrawals
@@ -76,6 +90,109 @@ func (balance *BalanceHandler) WithdrawalInfoHandler() gin.HandlerFunc {
 	}
 }
 
+// StatementHandler @Get User Account Statement
+// @Description Get the accruals, withdrawals, incoming and outgoing transfers, expiries and adjustments of the user in chronological order with the running balance
+// @ID user-statement
+// @Tags Balance
+// @Produce json
+// @Param cursor query string false "Cursor of the page, next_cursor of the previous page"
+// @Param from query string false "Start of the period, RFC 3339 time or date"
+// @Param to query string false "End of the period, RFC 3339 time or date, inclusive"
+// @Param limit query int false "Number of lines per page"
+// @Success 200 {object} service.StatementFormat
+// @Failure 400 {object} Response
+// @Failure 401 {object} Response
+// @Failure 500 {object} Response
+// @Router /statement [get]
+func (balance *BalanceHandler) StatementHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, exists := c.Get("token")
+		if !exists {
+			respondWithError(
+				c,
+				http.StatusUnauthorized,
+				"Token not found",
+				ErrorTokenNotFound,
+			)
+			return
+		}
+
+		tokenStr := fmt.Sprintf("%v", token)
+		statement, err := balance.balance.Statement(
+			tokenStr, service.StatementQuery{
+				Cursor: c.Query("cursor"),
+				From:   c.Query("from"),
+				To:     c.Query("to"),
+				Limit:  c.Query("limit"),
+			},
+		)
+		switch {
+		case errors.Is(err, service.ErrorNotValidStatementQuery):
+			respondWithError(c, http.StatusBadRequest, err.Error(), err)
+		case err != nil:
+			respondWithError(c, http.StatusInternalServerError, "Error with Statement", err)
+		default:
+			c.Writer.Header().Set("Content-Type", "application/json")
+			respondWithJSON(c, http.StatusOK, statement)
+		}
+	}
+}
+
+// ExportStatementHandler @Export User Points History
+// @Description Download the orders, accruals and withdrawals of the user as CSV or JSON Lines
+// @ID user-statement-export
+// @Tags Balance
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param format query string true "Export format" Enums(csv, jsonl)
+// @Success 200 {file} file
+// @Failure 400 {object} Response
+// @Failure 401 {object} Response
+// @Router /statement/export [get]
+func (balance *BalanceHandler) ExportStatementHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, exists := c.Get("token")
+		if !exists {
+			respondWithError(
+				c,
+				http.StatusUnauthorized,
+				"Token not found",
+				ErrorTokenNotFound,
+			)
+			return
+		}
+		format, err := service.ParseExportFormat(c.Query("format"))
+		if err != nil {
+			respondWithError(c, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+
+		tokenStr := fmt.Sprintf("%v", token)
+		setExportHeaders(c, "statement-"+time.Now().UTC().Format("20060102"), format)
+		if err := balance.balance.ExportStatement(tokenStr, format, c.Writer); err != nil {
+			logExportError(c, err)
+		}
+	}
+}
+
+// setExportHeaders starts the download of an export in the format.
+func setExportHeaders(c *gin.Context, name string, format service.ExportFormat) {
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+string(format)))
+	c.Status(http.StatusOK)
+}
+
+// logExportError logs an error which interrupted an export. The export has
+// already been partially sent, so the client only sees a truncated file.
+func logExportError(c *gin.Context, err error) {
+	logger.Logger.Error(
+		"Export interrupted",
+		zap.String("endpoint", c.Request.URL.Path),
+		zap.Error(err),
+	)
+	c.Abort()
+}
+
 // GetBalanceHandler @Get User Balance
 // @Description Get User Balance
 // @ID user-balance
@@ -117,9 +234,11 @@ func (balance *BalanceHandler) GetBalanceHandler() gin.HandlerFunc {
 // @Accept json
 // @Produce json
 // @Param withdraw body withdraw true "Withdraw order and sum"
+// @Param Idempotency-Key header string false "Idempotency key of the request"
 // @Success 200 {object} Response
 // @Failure 401 {object} Response
 // @Failure 402 {object} Response
+// @Failure 409 {object} Response
 // @Failure 422 {object} Response
 // @Failure 500 {object} Response
 // @Router /balance/withdraw [post]
@@ -158,8 +277,12 @@ func (balance *BalanceHandler) RequestWithdrawFundsHandler() gin.HandlerFunc {
 			switch {
 			case errors.Is(err, service.ErrorNotValidOrderNumber):
 				respondWithError(c, http.StatusUnprocessableEntity, "error in WithdrawFunds", err)
+			case errors.Is(err, service.ErrorNotValidSum):
+				respondWithError(c, http.StatusBadRequest, "error in WithdrawFunds", err)
 			case errors.Is(err, service.ErrorInsufficientFunds):
 				respondWithError(c, http.StatusPaymentRequired, "error in WithdrawFunds", err)
+			case errors.Is(err, service.ErrorOrderWithdrawn):
+				respondWithError(c, http.StatusConflict, "error in WithdrawFunds", err)
 			default:
 				respondWithError(c, http.StatusInternalServerError, "error in WithdrawFunds", err)
 			}
@@ -175,6 +298,196 @@ func (balance *BalanceHandler) RequestWithdrawFundsHandler() gin.HandlerFunc {
 	}
 }
 
+// AuthorizeHoldHandler @Reserve Funds For An Order
+// @Description Reserve funds for an order until its payment settles
+// @ID hold-authorize
+// @Tags Balance
+// @Accept json
+// @Produce json
+// @Param withdraw body withdraw true "Order and sum to reserve"
+// @Param Idempotency-Key header string false "Idempotency key of the request"
+// @Success 201 {object} service.HoldFormat
+// @Failure 400 {object} Response
+// @Failure 401 {object} Response
+// @Failure 402 {object} Response
+// @Failure 409 {object} Response
+// @Failure 422 {object} Response
+// @Failure 500 {object} Response
+// @Router /balance/holds [post]
+func (balance *BalanceHandler) AuthorizeHoldHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var w withdraw
+		if err := c.BindJSON(&w); err != nil {
+			respondWithError(c, http.StatusBadRequest, "Check json input", err)
+			return
+		}
+
+		token, exists := c.Get("token")
+		if !exists {
+			respondWithError(
+				c,
+				http.StatusUnauthorized,
+				"Token not found",
+				ErrorTokenNotFound,
+			)
+			return
+		}
+
+		tokenStr := fmt.Sprintf("%v", token)
+		hold, err := balance.balance.AuthorizeHold(tokenStr, w.Order, w.Sum)
+		if err != nil {
+			respondWithHoldError(c, "error in AuthorizeHold", err)
+			return
+		}
+		respondWithJSON(c, http.StatusCreated, hold)
+	}
+}
+
+// CaptureHoldHandler @Capture Reserved Funds
+// @Description Withdraw the funds reserved by a hold
+// @ID hold-capture
+// @Tags Balance
+// @Produce json
+// @Param id path string true "Hold ID"
+// @Success 200 {object} service.WithdrawalFormat
+// @Failure 401 {object} Response
+// @Failure 402 {object} Response
+// @Failure 404 {object} Response
+// @Failure 409 {object} Response
+// @Failure 500 {object} Response
+// @Router /balance/holds/{id}/capture [post]
+func (balance *BalanceHandler) CaptureHoldHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, exists := c.Get("token")
+		if !exists {
+			respondWithError(
+				c,
+				http.StatusUnauthorized,
+				"Token not found",
+				ErrorTokenNotFound,
+			)
+			return
+		}
+
+		tokenStr := fmt.Sprintf("%v", token)
+		withdrawal, err := balance.balance.CaptureHold(tokenStr, c.Param("id"))
+		if err != nil {
+			respondWithHoldError(c, "error in CaptureHold", err)
+			return
+		}
+		respondWithJSON(c, http.StatusOK, withdrawal)
+	}
+}
+
+// VoidHoldHandler @Release Reserved Funds
+// @Description Release the funds reserved by a hold
+// @ID hold-void
+// @Tags Balance
+// @Produce json
+// @Param id path string true "Hold ID"
+// @Success 200 {object} service.HoldFormat
+// @Failure 401 {object} Response
+// @Failure 404 {object} Response
+// @Failure 409 {object} Response
+// @Failure 500 {object} Response
+// @Router /balance/holds/{id}/void [post]
+func (balance *BalanceHandler) VoidHoldHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, exists := c.Get("token")
+		if !exists {
+			respondWithError(
+				c,
+				http.StatusUnauthorized,
+				"Token not found",
+				ErrorTokenNotFound,
+			)
+			return
+		}
+
+		tokenStr := fmt.Sprintf("%v", token)
+		hold, err := balance.balance.VoidHold(tokenStr, c.Param("id"))
+		if err != nil {
+			respondWithHoldError(c, "error in VoidHold", err)
+			return
+		}
+		respondWithJSON(c, http.StatusOK, hold)
+	}
+}
+
+// TransferHandler @Transfer Points To Another User
+// @Description Transfer points to another user
+// @ID funds-transfer
+// @Tags Balance
+// @Accept json
+// @Produce json
+// @Param transfer body transfer true "Recipient login and sum"
+// @Param Idempotency-Key header string false "Idempotency key of the request"
+// @Success 200 {object} service.TransferFormat
+// @Failure 400 {object} Response
+// @Failure 401 {object} Response
+// @Failure 402 {object} Response
+// @Failure 404 {object} Response
+// @Failure 409 {object} Response
+// @Failure 422 {object} Response
+// @Failure 500 {object} Response
+// @Router /balance/transfer [post]
+func (balance *BalanceHandler) TransferHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var t transfer
+		if err := c.BindJSON(&t); err != nil {
+			respondWithError(c, http.StatusBadRequest, "Check json input", err)
+			return
+		}
+
+		token, exists := c.Get("token")
+		if !exists {
+			respondWithError(
+				c,
+				http.StatusUnauthorized,
+				"Token not found",
+				ErrorTokenNotFound,
+			)
+			return
+		}
+
+		tokenStr := fmt.Sprintf("%v", token)
+		result, err := balance.balance.Transfer(tokenStr, t.Recipient, t.Sum)
+		switch {
+		case errors.Is(err, service.ErrorNotValidSum), errors.Is(err, service.ErrorSelfTransfer):
+			respondWithError(c, http.StatusBadRequest, "error in Transfer", err)
+		case errors.Is(err, service.ErrorInsufficientFunds):
+			respondWithError(c, http.StatusPaymentRequired, "error in Transfer", err)
+		case errors.Is(err, service.ErrorRecipientNotFound):
+			respondWithError(c, http.StatusNotFound, "error in Transfer", err)
+		case errors.Is(err, service.ErrorTransferLimit):
+			respondWithError(c, http.StatusUnprocessableEntity, "error in Transfer", err)
+		case err != nil:
+			respondWithError(c, http.StatusInternalServerError, "error in Transfer", err)
+		default:
+			respondWithJSON(c, http.StatusOK, result)
+		}
+	}
+}
+
+// respondWithHoldError responds with the status code matching an error of
+// the hold operations.
+func respondWithHoldError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrorNotValidOrderNumber):
+		respondWithError(c, http.StatusUnprocessableEntity, message, err)
+	case errors.Is(err, service.ErrorNotValidSum):
+		respondWithError(c, http.StatusBadRequest, message, err)
+	case errors.Is(err, service.ErrorInsufficientFunds):
+		respondWithError(c, http.StatusPaymentRequired, message, err)
+	case errors.Is(err, service.ErrorHoldNotFound):
+		respondWithError(c, http.StatusNotFound, message, err)
+	case errors.Is(err, service.ErrorHoldNotActive), errors.Is(err, service.ErrorOrderWithdrawn):
+		respondWithError(c, http.StatusConflict, message, err)
+	default:
+		respondWithError(c, http.StatusInternalServerError, message, err)
+	}
+}
+
 func respondWithError(c *gin.Context, statusCode int, message string, err error) {
 	logger.Logger.Error(
 		message,
@@ -7,17 +7,45 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/elina-chertova/loyalty-system/internal/config"
 	"github.com/elina-chertova/loyalty-system/internal/db/balancedb"
+	"github.com/elina-chertova/loyalty-system/internal/db/orderdb"
+	"github.com/elina-chertova/loyalty-system/internal/db/userdb"
 	"github.com/elina-chertova/loyalty-system/internal/order/service"
 	"github.com/elina-chertova/loyalty-system/internal/order/utils"
 	"github.com/elina-chertova/loyalty-system/internal/security"
+	"github.com/elina-chertova/loyalty-system/internal/tier"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
 // UserBalance handles operations related to user balances.
+// UserRep resolves the recipients of transfers, which are bound by Limits.
+// Tiers are assigned from the accrual credited within TierWindow; without
+// Tiers accruals are credited as they are. Campaigns grant bonuses on top of
+// the accruals if set.
 type UserBalance struct {
 	balanceRep balancedb.BalanceRepository
+	UserRep    userdb.UserRepository
+	Limits     TransferLimits
+	Tiers      tier.Tiers
+	TierWindow time.Duration
+	Campaigns  CampaignBonuses
+}
+
+// CampaignBonuses evaluates the promotional campaigns for an order whose
+// accrual is being credited to a user of the given tier.
+type CampaignBonuses interface {
+	Bonuses(order orderdb.OrderAccrual, userTier string) ([]balancedb.Bonus, error)
+}
+
+// TransferLimits bounds the points a user can transfer to other users.
+type TransferLimits struct {
+	MaxAmount  money.Points
+	DailyLimit money.Points
 }
 
 // NewBalance creates a new instance of UserBalance with the given BalanceRepository.
@@ -30,6 +58,16 @@ var (
 	ErrorNotValidOrderNumber = errors.New("order number is not valid")
 	ErrorSystem              = errors.New("error in loyality system")
 	ErrorInsufficientFunds   = errors.New("insufficient funds")
+	ErrorNotValidSum         = errors.New("withdrawal sum must be positive")
+	ErrorWithdrawalNotFound  = errors.New("withdrawal not found")
+	ErrorEmptyReason         = errors.New("reversal reason is required")
+	ErrorHoldNotFound        = errors.New("hold not found")
+	ErrorHoldNotActive       = errors.New("hold is not active")
+	ErrorNotReversible       = errors.New("withdrawal cannot be reversed")
+	ErrorRecipientNotFound   = errors.New("recipient not found")
+	ErrorSelfTransfer        = errors.New("points cannot be transferred to yourself")
+	ErrorTransferLimit       = errors.New("transfer limit exceeded")
+	ErrorOrderWithdrawn      = errors.New("points have already been withdrawn for the order")
 )
 
 // AddInitialBalance sets the initial balance for a given user ID.
@@ -42,8 +80,9 @@ func (bal *UserBalance) AddInitialBalance(userID uuid.UUID) error {
 }
 
 // WithdrawFunds processes a withdrawal request for a user identified by a token.
-// It verifies the validity of the order number and checks if sufficient funds are available.
-func (bal *UserBalance) WithdrawFunds(token, order string, sum float64) error {
+// It verifies the validity of the order number and the sum. The balance is
+// checked and decremented atomically together with recording the withdrawal.
+func (bal *UserBalance) WithdrawFunds(token, order string, sum money.Points) error {
 	userID, err := security.GetUserIDFromToken(token)
 	if err != nil {
 		return fmt.Errorf("%w; %v", ErrorSystem, err)
@@ -52,28 +91,19 @@ func (bal *UserBalance) WithdrawFunds(token, order string, sum float64) error {
 	if !utils.IsLuhnValid(order) {
 		return ErrorNotValidOrderNumber
 	}
-
-	balance, err := bal.balanceRep.GetBalanceByUserID(userID)
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return err
-	}
-	if err != nil {
-		return fmt.Errorf("%w; %v", ErrorSystem, err)
+	if sum <= 0 {
+		return ErrorNotValidSum
 	}
 
-	current := balance.Current - sum
-	withdrawn := balance.Withdrawn + sum
-	if current < 0 {
+	err = bal.balanceRep.Withdraw(userID, order, sum)
+	switch {
+	case errors.Is(err, balancedb.ErrorInsufficientFunds):
 		return ErrorInsufficientFunds
-	}
-
-	err = bal.balanceRep.AddWithdrawFunds(userID, order, sum)
-	if err != nil {
-		return fmt.Errorf("%w; %v", ErrorSystem, err)
-	}
-
-	err = bal.balanceRep.UpdateBalance(userID, current, withdrawn)
-	if err != nil {
+	case errors.Is(err, balancedb.ErrorOrderAlreadyWithdrawn):
+		return ErrorOrderWithdrawn
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	case err != nil:
 		return fmt.Errorf("%w; %v", ErrorSystem, err)
 	}
 
@@ -81,26 +111,75 @@ func (bal *UserBalance) WithdrawFunds(token, order string, sum float64) error {
 }
 
 // GetBalance retrieves the current balance and withdrawn amount for a user identified by a token.
+// The balance is derived from the points ledger. Held are the points reserved
+// by active holds and Available the points which can still be withdrawn.
+// ExpiringSoon holds the points which expire within config.ExpiringSoonWindow.
 func (bal *UserBalance) GetBalance(token string) (UserBalanceFormat, error) {
 	userID, err := security.GetUserIDFromToken(token)
 	if err != nil {
 		return UserBalanceFormat{}, err
 	}
-	balance, err := bal.balanceRep.GetBalanceByUserID(userID)
+	balance, err := bal.balanceRep.GetLedgerBalance(userID)
+	if err != nil {
+		return UserBalanceFormat{}, err
+	}
+	expiring, err := bal.balanceRep.GetExpiringPoints(userID, time.Now().Add(config.ExpiringSoonWindow))
+	if err != nil {
+		return UserBalanceFormat{}, err
+	}
 
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return UserBalanceFormat{}, nil
-	} else if err != nil {
+	held, err := bal.balanceRep.GetHeldPoints(userID)
+	if err != nil {
+		return UserBalanceFormat{}, err
+	}
+	userTier, err := bal.tierOf(userID)
+	if err != nil {
+		return UserBalanceFormat{}, err
+	}
+	changes, err := bal.balanceRep.GetTierChanges(userID)
+	if err != nil {
 		return UserBalanceFormat{}, err
 	}
 
-	return *ConvertToUserBalanceFormat(balance), nil
+	userBalance := ConvertToUserBalanceFormat(balance)
+	userBalance.ExpiringSoon = expiring
+	userBalance.Held = held
+	userBalance.Available = balance.Current - held
+	if userBalance.Available < 0 {
+		userBalance.Available = 0
+	}
+	userBalance.Tier = userTier.Name
+	for _, change := range changes {
+		userBalance.TierChanges = append(
+			userBalance.TierChanges, TierChangeFormat{
+				OldTier:   change.OldTier,
+				NewTier:   change.NewTier,
+				Accrual:   change.Accrual,
+				ChangedAt: change.CreatedAt,
+			},
+		)
+	}
+	return *userBalance, nil
 }
 
 // UserBalanceFormat defines the format for representing user balances.
 type UserBalanceFormat struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current      money.Points       `json:"current"`
+	Available    money.Points       `json:"available"`
+	Held         money.Points       `json:"held"`
+	Withdrawn    money.Points       `json:"withdrawn"`
+	ExpiringSoon money.Points       `json:"expiring_soon"`
+	Tier         string             `json:"tier,omitempty"`
+	TierChanges  []TierChangeFormat `json:"tier_changes,omitempty"`
+}
+
+// TierChangeFormat defines the format for representing tier changes.
+// Accrual is the accrual over the rolling window which caused the change.
+type TierChangeFormat struct {
+	OldTier   string       `json:"old_tier,omitempty"`
+	NewTier   string       `json:"new_tier"`
+	Accrual   money.Points `json:"accrual"`
+	ChangedAt time.Time    `json:"changed_at"`
 }
 
 // ConvertToUserBalanceFormat converts a balancedb.Balance to UserBalanceFormat
@@ -113,10 +192,27 @@ func ConvertToUserBalanceFormat(originalBalance balancedb.Balance) *UserBalanceF
 }
 
 // WithdrawalFormat defines the format for representing user withdrawals.
+// A reversed withdrawal carries the reason and the time of the reversal.
 type WithdrawalFormat struct {
-	Order       string    `json:"order" gorm:"unique_index"`
-	Sum         float64   `json:"sum"`
-	ProcessedAt time.Time `json:"processed_at"`
+	Order          string       `json:"order" gorm:"unique_index"`
+	Sum            money.Points `json:"sum"`
+	ProcessedAt    time.Time    `json:"processed_at"`
+	Status         string       `json:"status"`
+	ReversalReason string       `json:"reversal_reason,omitempty"`
+	ReversedAt     *time.Time   `json:"reversed_at,omitempty"`
+}
+
+// ConvertToWithdrawalFormat converts a balancedb.Withdrawal to WithdrawalFormat
+// for external representation.
+func ConvertToWithdrawalFormat(w balancedb.Withdrawal) WithdrawalFormat {
+	return WithdrawalFormat{
+		Order:          w.Order,
+		Sum:            w.Sum,
+		ProcessedAt:    w.CreatedAt,
+		Status:         w.Status,
+		ReversalReason: w.ReversalReason,
+		ReversedAt:     w.ReversedAt,
+	}
 }
 
 // WithdrawalInfo retrieves the withdrawal information for a user identified by a token.
@@ -132,49 +228,409 @@ func (bal *UserBalance) WithdrawalInfo(token string) ([]WithdrawalFormat, error)
 
 	newWithdrawals := make([]WithdrawalFormat, 0, len(withdrawals))
 	for _, w := range withdrawals {
-		newWithdrawals = append(
-			newWithdrawals, WithdrawalFormat{
-				Order:       w.Order,
-				Sum:         w.Sum,
-				ProcessedAt: w.UpdatedAt,
-			},
-		)
+		newWithdrawals = append(newWithdrawals, ConvertToWithdrawalFormat(w))
 	}
 
 	return newWithdrawals, nil
 }
 
-// UpdateBalance updates the balance of users based on their recent order accruals.
+// HoldFormat defines the format for representing holds.
+type HoldFormat struct {
+	ID        uuid.UUID    `json:"id"`
+	Order     string       `json:"order"`
+	Sum       money.Points `json:"sum"`
+	Status    string       `json:"status"`
+	ExpiresAt time.Time    `json:"expires_at"`
+}
+
+// ConvertToHoldFormat converts a balancedb.Hold to HoldFormat for external representation.
+func ConvertToHoldFormat(h balancedb.Hold) HoldFormat {
+	return HoldFormat{
+		ID:        h.ID,
+		Order:     h.Order,
+		Sum:       h.Amount,
+		Status:    h.Status,
+		ExpiresAt: h.ExpiresAt,
+	}
+}
+
+// AuthorizeHold reserves sum points of the user identified by a token for
+// the order until the hold is captured or voided, or config.HoldTTL elapses.
+// The order number and the sum are validated as for a withdrawal.
+func (bal *UserBalance) AuthorizeHold(token, order string, sum money.Points) (HoldFormat, error) {
+	userID, err := security.GetUserIDFromToken(token)
+	if err != nil {
+		return HoldFormat{}, fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+
+	if !utils.IsLuhnValid(order) {
+		return HoldFormat{}, ErrorNotValidOrderNumber
+	}
+	if sum <= 0 {
+		return HoldFormat{}, ErrorNotValidSum
+	}
+
+	hold, err := bal.balanceRep.AuthorizeHold(userID, order, sum, config.HoldTTL)
+	switch {
+	case errors.Is(err, balancedb.ErrorInsufficientFunds):
+		return HoldFormat{}, ErrorInsufficientFunds
+	case errors.Is(err, balancedb.ErrorOrderAlreadyWithdrawn):
+		return HoldFormat{}, ErrorOrderWithdrawn
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return HoldFormat{}, err
+	case err != nil:
+		return HoldFormat{}, fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+
+	return ConvertToHoldFormat(hold), nil
+}
+
+// CaptureHold converts the hold of the user identified by a token into
+// a withdrawal. Capturing a hold again returns its withdrawal.
+func (bal *UserBalance) CaptureHold(token, holdID string) (WithdrawalFormat, error) {
+	userID, err := security.GetUserIDFromToken(token)
+	if err != nil {
+		return WithdrawalFormat{}, fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+	id, err := uuid.Parse(holdID)
+	if err != nil {
+		return WithdrawalFormat{}, ErrorHoldNotFound
+	}
+
+	withdrawal, err := bal.balanceRep.CaptureHold(userID, id)
+	if err != nil {
+		return WithdrawalFormat{}, holdError(err)
+	}
+	return ConvertToWithdrawalFormat(withdrawal), nil
+}
+
+// VoidHold releases the hold of the user identified by a token.
+// Voiding a hold again is a no-op.
+func (bal *UserBalance) VoidHold(token, holdID string) (HoldFormat, error) {
+	userID, err := security.GetUserIDFromToken(token)
+	if err != nil {
+		return HoldFormat{}, fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+	id, err := uuid.Parse(holdID)
+	if err != nil {
+		return HoldFormat{}, ErrorHoldNotFound
+	}
+
+	hold, err := bal.balanceRep.VoidHold(userID, id)
+	if err != nil {
+		return HoldFormat{}, holdError(err)
+	}
+	return ConvertToHoldFormat(hold), nil
+}
+
+// holdError maps the repository errors of settling a hold to the service errors.
+func holdError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrorHoldNotFound
+	case errors.Is(err, balancedb.ErrorHoldNotActive):
+		return ErrorHoldNotActive
+	case errors.Is(err, balancedb.ErrorInsufficientFunds):
+		return ErrorInsufficientFunds
+	case errors.Is(err, balancedb.ErrorOrderAlreadyWithdrawn):
+		return ErrorOrderWithdrawn
+	default:
+		return fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+}
+
+// ExpireHolds releases the active holds whose TTL has elapsed.
+// Returns the number of released holds.
+func (bal *UserBalance) ExpireHolds() (int, error) {
+	holdIDs, err := bal.balanceRep.GetExpiredHoldIDs(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, holdID := range holdIDs {
+		expired, err := bal.balanceRep.ExpireHold(holdID)
+		if err != nil {
+			return released, err
+		}
+		if expired {
+			released++
+		}
+	}
+	return released, nil
+}
+
+// TransferFormat defines the format for representing transfers.
+type TransferFormat struct {
+	Reference string       `json:"reference"`
+	Recipient string       `json:"recipient"`
+	Sum       money.Points `json:"sum"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// Transfer moves sum points from the user identified by a token to the user
+// with the recipient login. The sum must not exceed Limits.MaxAmount, and
+// the user's transfers within config.TransferLimitWindow must not exceed
+// Limits.DailyLimit. The transfer is listed in the withdrawals of the sender
+// and in the statements of both users, as a line of the type
+// balancedb.LedgerTransferOut and balancedb.LedgerTransferIn respectively.
+func (bal *UserBalance) Transfer(token, recipient string, sum money.Points) (TransferFormat, error) {
+	senderID, err := security.GetUserIDFromToken(token)
+	if err != nil {
+		return TransferFormat{}, fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+
+	if sum <= 0 {
+		return TransferFormat{}, ErrorNotValidSum
+	}
+	if sum > bal.Limits.MaxAmount {
+		return TransferFormat{}, ErrorTransferLimit
+	}
+	// An empty login would match any user.
+	if recipient == "" {
+		return TransferFormat{}, ErrorRecipientNotFound
+	}
+
+	user, err := bal.UserRep.GetUserByName(recipient)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return TransferFormat{}, ErrorRecipientNotFound
+	case err != nil:
+		return TransferFormat{}, fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+	if user.ID == senderID {
+		return TransferFormat{}, ErrorSelfTransfer
+	}
+
+	transfer, err := bal.balanceRep.Transfer(senderID, user.ID, sum, bal.Limits.DailyLimit)
+	switch {
+	case errors.Is(err, balancedb.ErrorInsufficientFunds):
+		return TransferFormat{}, ErrorInsufficientFunds
+	case errors.Is(err, balancedb.ErrorTransferLimitExceeded):
+		return TransferFormat{}, ErrorTransferLimit
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return TransferFormat{}, err
+	case err != nil:
+		return TransferFormat{}, fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+
+	logger.Logger.Info(
+		"Points transferred",
+		zap.String("reference", transfer.Reference),
+		zap.String("sender", senderID.String()),
+		zap.String("recipient", user.ID.String()),
+		zap.Stringer("sum", transfer.Amount),
+	)
+	return TransferFormat{
+		Reference: transfer.Reference,
+		Recipient: recipient,
+		Sum:       transfer.Amount,
+		CreatedAt: transfer.CreatedAt,
+	}, nil
+}
+
+// ReverseWithdrawal reverses the withdrawal made for the order, returning the
+// points to the user's balance. Reversing a withdrawal again returns it
+// unchanged.
+func (bal *UserBalance) ReverseWithdrawal(order, reason string) (WithdrawalFormat, error) {
+	if reason == "" {
+		return WithdrawalFormat{}, ErrorEmptyReason
+	}
+
+	withdrawal, err := bal.balanceRep.ReverseWithdrawal(order, reason)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return WithdrawalFormat{}, ErrorWithdrawalNotFound
+	case errors.Is(err, balancedb.ErrorNotReversible):
+		return WithdrawalFormat{}, ErrorNotReversible
+	case err != nil:
+		return WithdrawalFormat{}, fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+
+	logger.Logger.Info(
+		"Withdrawal reversed",
+		zap.String("order", withdrawal.Order),
+		zap.Stringer("sum", withdrawal.Sum),
+		zap.String("reason", withdrawal.ReversalReason),
+	)
+	return ConvertToWithdrawalFormat(withdrawal), nil
+}
+
+// UpdateBalance credits the accruals of processed orders to the balances of
+// their users, multiplied by the multipliers of the users' tiers. The points
+// added by a multiplier are credited as a separate tier bonus, and so are
+// the bonuses of the campaigns the order is eligible for. Every order is
+// credited in its own transaction which is a no-op for an order credited
+// before, so a crash midway or a concurrent run neither loses nor duplicates
+// points.
 func (bal *UserBalance) UpdateBalance(ord *service.UserOrder) error {
-	orderAccrual, err := ord.OrderRep.GetOrderAccrual()
+	orders, err := ord.OrderRep.GetPreparedOrders()
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return err
 	}
 
-	for _, rows := range orderAccrual {
-		balance, err := bal.balanceRep.GetBalanceByUserID(rows.UserID)
-		switch e := err; {
-		case errors.Is(e, gorm.ErrRecordNotFound):
-			err := bal.balanceRep.AddBalance(rows.UserID, rows.SumAccrual, 0.0)
+	for _, order := range orders {
+		userTier, err := bal.tierOf(order.UserID)
+		if err != nil {
+			return err
+		}
+		bonus := userTier.Multiplier.Bonus(order.SumAccrual)
+		bonuses := []balancedb.Bonus{{Kind: balancedb.LedgerTierBonus, Amount: bonus}}
+
+		var campaignBonus money.Points
+		if bal.Campaigns != nil {
+			campaignBonuses, err := bal.Campaigns.Bonuses(order, userTier.Name)
 			if err != nil {
 				return err
 			}
-			continue
-		case !errors.Is(e, gorm.ErrRecordNotFound) && e != nil:
-			return e
+			for _, b := range campaignBonuses {
+				campaignBonus += b.Amount
+			}
+			bonuses = append(bonuses, campaignBonuses...)
 		}
 
-		current := balance.Current + rows.SumAccrual
-
-		if err = bal.balanceRep.UpdateBalance(
-			rows.UserID,
-			current,
-			balance.Withdrawn,
-		); err != nil {
+		credited, err := bal.balanceRep.CreditOrder(order.Order, bonuses...)
+		if err != nil {
 			return err
 		}
-
+		if credited {
+			logger.Logger.Info(
+				"Order accrual credited",
+				zap.String("order", order.Order),
+				zap.Stringer("accrual", order.SumAccrual),
+				zap.String("tier", userTier.Name),
+				zap.Stringer("bonus", bonus),
+				zap.Stringer("campaign_bonus", campaignBonus),
+			)
+		}
 	}
 
 	return nil
 }
+
+// tierOf returns the tier assigned to the user, the lowest tier if the user
+// has not been assigned one yet, or a tier without a multiplier if there are
+// no tiers.
+func (bal *UserBalance) tierOf(userID uuid.UUID) (tier.Tier, error) {
+	if len(bal.Tiers) == 0 {
+		return tier.Tier{Multiplier: tier.One}, nil
+	}
+	userTier, err := bal.balanceRep.GetTier(userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return tier.Tier{}, err
+	}
+	return bal.Tiers.ByName(userTier.Tier), nil
+}
+
+// RecomputeTiers assigns every user the tier reached by the accrual credited
+// to the user within TierWindow and records the changed tiers.
+// Returns the number of users whose tier has changed.
+func (bal *UserBalance) RecomputeTiers() (int, error) {
+	if len(bal.Tiers) == 0 {
+		return 0, nil
+	}
+	accruals, err := bal.balanceRep.GetWindowAccruals(time.Now().Add(-bal.TierWindow))
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, accrual := range accruals {
+		userTier := bal.Tiers.For(accrual.Accrual)
+		ok, err := bal.balanceRep.SetTier(accrual.UserID, userTier.Name, accrual.Accrual)
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed++
+			logger.Logger.Info(
+				"Tier changed",
+				zap.String("user_id", accrual.UserID.String()),
+				zap.String("tier", userTier.Name),
+				zap.Stringer("accrual", accrual.Accrual),
+			)
+		}
+	}
+	return changed, nil
+}
+
+// Reconcile verifies the cached balances against the points ledger and logs
+// every user whose balance differs from the ledger.
+// Returns the discrepancies found.
+func (bal *UserBalance) Reconcile() ([]balancedb.Discrepancy, error) {
+	discrepancies, err := bal.balanceRep.Reconcile()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range discrepancies {
+		logger.Logger.Warn(
+			"Balance differs from the ledger",
+			zap.String("user_id", d.UserID.String()),
+			zap.Stringer("current", d.Current),
+			zap.Stringer("ledger_current", d.LedgerCurrent),
+			zap.Stringer("withdrawn", d.Withdrawn),
+			zap.Stringer("ledger_withdrawn", d.LedgerWithdrawn),
+		)
+	}
+	return discrepancies, nil
+}
+
+// CheckDrift recomputes the balances of all users from the orders,
+// withdrawals, transfers and expired points and logs every user whose stored
+// balance differs. With fix, the drifted balances are corrected by
+// adjustments.
+// Returns the drifts found.
+func (bal *UserBalance) CheckDrift(fix bool) ([]balancedb.Drift, error) {
+	drifts, err := bal.balanceRep.GetDrifts()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range drifts {
+		logger.Logger.Warn(
+			"Balance drifted from the source data",
+			zap.String("user_id", d.UserID.String()),
+			zap.Stringer("current", d.Current),
+			zap.Stringer("expected_current", d.ExpectedCurrent),
+			zap.Stringer("withdrawn", d.Withdrawn),
+			zap.Stringer("expected_withdrawn", d.ExpectedWithdrawn),
+		)
+		if !fix {
+			continue
+		}
+
+		fixed, err := bal.balanceRep.FixDrift(d.UserID)
+		if err != nil {
+			return drifts, err
+		}
+		if fixed != nil {
+			logger.Logger.Info(
+				"Balance drift fixed",
+				zap.String("user_id", fixed.UserID.String()),
+				zap.Stringer("current", fixed.ExpectedCurrent),
+				zap.Stringer("withdrawn", fixed.ExpectedWithdrawn),
+			)
+		}
+	}
+	return drifts, nil
+}
+
+// ExpirePoints expires the remaining points of every overdue lot.
+// Returns the total number of expired points.
+func (bal *UserBalance) ExpirePoints() (money.Points, error) {
+	lotIDs, err := bal.balanceRep.GetExpiredLotIDs(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	var total money.Points
+	for _, lotID := range lotIDs {
+		expired, err := bal.balanceRep.ExpireLot(lotID)
+		if err != nil {
+			return total, err
+		}
+		total += expired
+	}
+	return total, nil
+}
@@ -7,12 +7,53 @@ import (
 	"time"
 
 	"github.com/elina-chertova/loyalty-system/internal/db/balancedb"
+	"github.com/elina-chertova/loyalty-system/internal/db/orderdb"
+	"github.com/elina-chertova/loyalty-system/internal/db/userdb"
+	"github.com/elina-chertova/loyalty-system/internal/order/service"
 	"github.com/elina-chertova/loyalty-system/internal/security"
+	"github.com/elina-chertova/loyalty-system/internal/tier"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
 	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 )
 
-type MockBalanceRepository struct{}
+type MockBalanceRepository struct {
+	Credited  []string
+	Withdrawn []string
+	Reversed  []string
+	Holds     map[uuid.UUID]balancedb.Hold
+
+	Transferred money.Points
+	Fixed       []uuid.UUID
+
+	Bonuses map[string]money.Points
+	Tiers   map[uuid.UUID]string
+	Changes []balancedb.TierChange
+}
+
+type MockUserRepository struct{}
+
+func (m *MockUserRepository) GetUserByName(login string) (userdb.User, error) {
+	switch login {
+	case "sender":
+		userID, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
+		return userdb.User{ID: userID, Name: login}, nil
+	case "family", "":
+		// Like GORM, which ignores the empty name and finds any user.
+		userID, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019136")
+		return userdb.User{ID: userID, Name: login}, nil
+	}
+	return userdb.User{}, gorm.ErrRecordNotFound
+}
+
+func (m *MockUserRepository) GetUserByID(userID uuid.UUID) (userdb.User, error) {
+	return userdb.User{}, gorm.ErrRecordNotFound
+}
+
+func (m *MockUserRepository) AddUser(login, password string, isAdmin bool) error {
+	return nil
+}
 
 var (
 	ErrorDownloadingBalance       = errors.New("balance cannot be created")
@@ -37,12 +78,17 @@ func TestUserBalance_WithdrawFunds(t *testing.T) {
 	uuidIDTest, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
 	token, _ := security.GenerateToken(uuidIDTest)
 	order := "6231543915765652"
-	sum := 50.0
+	sum := money.FromFloat(50)
 
 	err := userBalance.WithdrawFunds(token, order, sum)
 	if err != nil {
 		t.Errorf("WithdrawFunds() error = %v", err)
 	}
+
+	assert.ErrorIs(t, userBalance.WithdrawFunds(token, order, sum), ErrorOrderWithdrawn)
+	assert.ErrorIs(t, userBalance.WithdrawFunds(token, "79927398713", money.FromFloat(1000)), ErrorInsufficientFunds)
+	assert.ErrorIs(t, userBalance.WithdrawFunds(token, order, money.FromFloat(-10)), ErrorNotValidSum)
+	assert.ErrorIs(t, userBalance.WithdrawFunds(token, "123", sum), ErrorNotValidOrderNumber)
 }
 
 func TestUserBalance_GetBalance(t *testing.T) {
@@ -92,6 +138,287 @@ func TestUserBalance_GetBalance(t *testing.T) {
 	}
 }
 
+type preparedOrders struct {
+	orderdb.OrderRepository
+	orders []orderdb.OrderAccrual
+}
+
+func (p *preparedOrders) GetPreparedOrders() ([]orderdb.OrderAccrual, error) {
+	return p.orders, nil
+}
+
+func TestUserBalance_UpdateBalance(t *testing.T) {
+	rep := &MockBalanceRepository{}
+	userBalance := NewBalance(rep)
+	ord := service.NewOrder(
+		&preparedOrders{
+			orders: []orderdb.OrderAccrual{
+				{UserID: uuid.New(), Order: "79927398713", SumAccrual: money.FromFloat(500)},
+				{UserID: uuid.New(), Order: "12345678903", SumAccrual: money.FromFloat(100)},
+			},
+		},
+		nil,
+	)
+
+	assert.NoError(t, userBalance.UpdateBalance(ord))
+	assert.NoError(t, userBalance.UpdateBalance(ord))
+	assert.Equal(t, []string{"79927398713", "12345678903"}, rep.Credited)
+}
+
+func TestUserBalance_UpdateBalance_TierBonus(t *testing.T) {
+	gold, silver := uuid.New(), uuid.New()
+	rep := &MockBalanceRepository{Tiers: map[uuid.UUID]string{gold: "gold", silver: "silver"}}
+	userBalance := NewBalance(rep)
+	userBalance.Tiers, _ = tier.Parse("bronze:0:1,silver:1000:1.1,gold:5000:1.25")
+	ord := service.NewOrder(
+		&preparedOrders{
+			orders: []orderdb.OrderAccrual{
+				{UserID: gold, Order: "79927398713", SumAccrual: money.FromFloat(729.98)},
+				{UserID: silver, Order: "12345678903", SumAccrual: money.FromFloat(100)},
+				{UserID: uuid.New(), Order: "6231543915765652", SumAccrual: money.FromFloat(100)},
+			},
+		},
+		nil,
+	)
+
+	assert.NoError(t, userBalance.UpdateBalance(ord))
+	assert.Equal(
+		t, map[string]money.Points{
+			"79927398713/" + balancedb.LedgerTierBonus: money.FromFloat(182.5),
+			"12345678903/" + balancedb.LedgerTierBonus: money.FromFloat(10),
+		}, rep.Bonuses,
+	)
+}
+
+// campaignBonuses grants bonus to the orders of the users of tier.
+type campaignBonuses struct {
+	bonus money.Points
+	tier  string
+}
+
+func (c campaignBonuses) Bonuses(order orderdb.OrderAccrual, userTier string) ([]balancedb.Bonus, error) {
+	if userTier != c.tier {
+		return nil, nil
+	}
+	campaignID := uint(7)
+	return []balancedb.Bonus{{Kind: balancedb.LedgerCampaignBonus, Amount: c.bonus, CampaignID: &campaignID}}, nil
+}
+
+func TestUserBalance_UpdateBalance_CampaignBonus(t *testing.T) {
+	gold := uuid.New()
+	rep := &MockBalanceRepository{Tiers: map[uuid.UUID]string{gold: "gold"}}
+	userBalance := NewBalance(rep)
+	userBalance.Tiers, _ = tier.Parse("bronze:0:1,gold:5000:1.25")
+	userBalance.Campaigns = campaignBonuses{bonus: money.FromFloat(100), tier: "gold"}
+	ord := service.NewOrder(
+		&preparedOrders{
+			orders: []orderdb.OrderAccrual{
+				{UserID: gold, Order: "79927398713", SumAccrual: money.FromFloat(400)},
+				{UserID: uuid.New(), Order: "12345678903", SumAccrual: money.FromFloat(400)},
+			},
+		},
+		nil,
+	)
+
+	assert.NoError(t, userBalance.UpdateBalance(ord))
+	assert.Equal(
+		t, map[string]money.Points{
+			"79927398713/" + balancedb.LedgerTierBonus:     money.FromFloat(100),
+			"79927398713/" + balancedb.LedgerCampaignBonus: money.FromFloat(100),
+		}, rep.Bonuses,
+	)
+}
+
+func TestUserBalance_RecomputeTiers(t *testing.T) {
+	rep := &MockBalanceRepository{}
+	userBalance := NewBalance(rep)
+	userBalance.Tiers, _ = tier.Parse("bronze:0:1,silver:1000:1.1,gold:5000:1.25")
+	userBalance.TierWindow = 365 * 24 * time.Hour
+	userID, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
+	token, _ := security.GenerateToken(userID)
+
+	balance, err := userBalance.GetBalance(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "bronze", balance.Tier)
+	assert.Empty(t, balance.TierChanges)
+
+	changed, err := userBalance.RecomputeTiers()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, changed)
+	changed, err = userBalance.RecomputeTiers()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, changed)
+
+	balance, err = userBalance.GetBalance(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "silver", balance.Tier)
+	assert.Len(t, balance.TierChanges, 1)
+	assert.Equal(t, "silver", balance.TierChanges[0].NewTier)
+}
+
+func TestUserBalance_ExpirePoints(t *testing.T) {
+	userBalance := NewBalance(&MockBalanceRepository{})
+
+	expired, err := userBalance.ExpirePoints()
+	assert.NoError(t, err)
+	assert.Equal(t, money.FromFloat(20), expired)
+}
+
+func TestUserBalance_GetBalance_ExpiringSoon(t *testing.T) {
+	userBalance := NewBalance(&MockBalanceRepository{})
+	userID, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
+	token, _ := security.GenerateToken(userID)
+
+	balance, err := userBalance.GetBalance(token)
+	assert.NoError(t, err)
+	assert.Equal(t, money.FromFloat(545.6), balance.Current)
+	assert.Equal(t, money.FromFloat(25), balance.ExpiringSoon)
+}
+
+func TestUserBalance_Reconcile(t *testing.T) {
+	userBalance := NewBalance(&MockBalanceRepository{})
+
+	discrepancies, err := userBalance.Reconcile()
+	assert.NoError(t, err)
+	assert.Len(t, discrepancies, 1)
+}
+
+func TestUserBalance_ReverseWithdrawal(t *testing.T) {
+	rep := &MockBalanceRepository{}
+	userBalance := NewBalance(rep)
+
+	_, err := userBalance.ReverseWithdrawal("79927398713", "")
+	assert.ErrorIs(t, err, ErrorEmptyReason)
+	_, err = userBalance.ReverseWithdrawal("12345678903", "order cancelled")
+	assert.ErrorIs(t, err, ErrorWithdrawalNotFound)
+
+	for i := 0; i < 2; i++ {
+		withdrawal, err := userBalance.ReverseWithdrawal("79927398713", "order cancelled")
+		assert.NoError(t, err)
+		assert.Equal(t, balancedb.WithdrawalReversed, withdrawal.Status)
+		assert.Equal(t, "order cancelled", withdrawal.ReversalReason)
+		assert.NotNil(t, withdrawal.ReversedAt)
+	}
+	assert.Equal(t, []string{"79927398713"}, rep.Reversed)
+}
+
+func TestUserBalance_Holds(t *testing.T) {
+	rep := &MockBalanceRepository{}
+	userBalance := NewBalance(rep)
+	userID, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
+	token, _ := security.GenerateToken(userID)
+	order := "6231543915765652"
+
+	_, err := userBalance.AuthorizeHold(token, "123", money.FromFloat(10))
+	assert.ErrorIs(t, err, ErrorNotValidOrderNumber)
+	_, err = userBalance.AuthorizeHold(token, order, 0)
+	assert.ErrorIs(t, err, ErrorNotValidSum)
+
+	hold, err := userBalance.AuthorizeHold(token, order, money.FromFloat(500))
+	assert.NoError(t, err)
+	assert.Equal(t, balancedb.HoldActive, hold.Status)
+	_, err = userBalance.AuthorizeHold(token, order, money.FromFloat(50))
+	assert.ErrorIs(t, err, ErrorInsufficientFunds, "held points cannot be reserved again")
+
+	balance, err := userBalance.GetBalance(token)
+	assert.NoError(t, err)
+	assert.Equal(t, money.FromFloat(500), balance.Held)
+	assert.Equal(t, money.FromFloat(45.6), balance.Available)
+
+	withdrawal, err := userBalance.CaptureHold(token, hold.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, money.FromFloat(500), withdrawal.Sum)
+	_, err = userBalance.VoidHold(token, hold.ID.String())
+	assert.ErrorIs(t, err, ErrorHoldNotActive)
+
+	hold, err = userBalance.AuthorizeHold(token, order, money.FromFloat(20))
+	assert.NoError(t, err)
+	voided, err := userBalance.VoidHold(token, hold.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, balancedb.HoldVoided, voided.Status)
+	_, err = userBalance.CaptureHold(token, hold.ID.String())
+	assert.ErrorIs(t, err, ErrorHoldNotActive)
+
+	_, err = userBalance.CaptureHold(token, "not-a-hold")
+	assert.ErrorIs(t, err, ErrorHoldNotFound)
+	_, err = userBalance.VoidHold(token, uuid.New().String())
+	assert.ErrorIs(t, err, ErrorHoldNotFound)
+}
+
+func TestUserBalance_ExpireHolds(t *testing.T) {
+	rep := &MockBalanceRepository{}
+	userBalance := NewBalance(rep)
+	userID, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
+
+	hold, err := rep.AuthorizeHold(userID, "6231543915765652", money.FromFloat(10), -time.Minute)
+	assert.NoError(t, err)
+	_, err = rep.AuthorizeHold(userID, "6231543915765652", money.FromFloat(10), time.Minute)
+	assert.NoError(t, err)
+
+	released, err := userBalance.ExpireHolds()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+	assert.Equal(t, balancedb.HoldExpired, rep.Holds[hold.ID].Status)
+}
+
+func TestUserBalance_Transfer(t *testing.T) {
+	rep := &MockBalanceRepository{}
+	userBalance := NewBalance(rep)
+	userBalance.UserRep = &MockUserRepository{}
+	userBalance.Limits = TransferLimits{
+		MaxAmount:  money.FromFloat(100),
+		DailyLimit: money.FromFloat(150),
+	}
+	userID, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
+	token, _ := security.GenerateToken(userID)
+
+	tests := []struct {
+		name      string
+		recipient string
+		sum       money.Points
+		wantErr   error
+	}{
+		{"transfer", "family", money.FromFloat(100), nil},
+		{"non-positive sum", "family", 0, ErrorNotValidSum},
+		{"over per-transfer limit", "family", money.FromFloat(100.01), ErrorTransferLimit},
+		{"unknown recipient", "stranger", money.FromFloat(10), ErrorRecipientNotFound},
+		{"empty recipient", "", money.FromFloat(10), ErrorRecipientNotFound},
+		{"to yourself", "sender", money.FromFloat(10), ErrorSelfTransfer},
+		{"over daily limit", "family", money.FromFloat(60), ErrorTransferLimit},
+		{"within daily limit", "family", money.FromFloat(50), nil},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				transfer, err := userBalance.Transfer(token, tt.recipient, tt.sum)
+				if tt.wantErr != nil {
+					assert.ErrorIs(t, err, tt.wantErr)
+					return
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, tt.recipient, transfer.Recipient)
+				assert.Equal(t, tt.sum, transfer.Sum)
+			},
+		)
+	}
+	assert.Equal(t, money.FromFloat(150), rep.Transferred)
+}
+
+func TestUserBalance_CheckDrift(t *testing.T) {
+	rep := &MockBalanceRepository{}
+	userBalance := NewBalance(rep)
+
+	drifts, err := userBalance.CheckDrift(false)
+	assert.NoError(t, err)
+	assert.Len(t, drifts, 1)
+	assert.Empty(t, rep.Fixed)
+
+	drifts, err = userBalance.CheckDrift(true)
+	assert.NoError(t, err)
+	assert.Len(t, drifts, 1)
+	assert.Equal(t, []uuid.UUID{drifts[0].UserID}, rep.Fixed)
+}
+
 func BenchmarkUserBalance_AddInitialBalance(b *testing.B) {
 	rep := &MockBalanceRepository{}
 	userBalance := NewBalance(rep)
@@ -111,7 +438,7 @@ func BenchmarkUserBalance_WithdrawFunds(b *testing.B) {
 	uuidTest, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
 	token, _ := security.GenerateToken(uuidTest)
 	order := "6231543915765652"
-	sum := 50.0
+	sum := money.FromFloat(50)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -134,8 +461,8 @@ func BenchmarkUserBalance_GetBalance(b *testing.B) {
 
 func (m *MockBalanceRepository) AddBalance(
 	userID uuid.UUID,
-	current float64,
-	withdrawn float64,
+	current money.Points,
+	withdrawn money.Points,
 ) error {
 	uuidIDTest, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
 	if userID == uuidIDTest {
@@ -144,15 +471,24 @@ func (m *MockBalanceRepository) AddBalance(
 	return nil
 }
 
-func (m *MockBalanceRepository) AddWithdrawFunds(
+func (m *MockBalanceRepository) Withdraw(
 	userID uuid.UUID,
 	order string,
-	sum float64,
+	sum money.Points,
 ) error {
-	uuidIDTest, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
-	if userID != uuidIDTest {
-		return fmt.Errorf("%w: %v", ErrorDownloadingWithdrawFunds, gorm.ErrRecordNotFound)
+	for _, withdrawn := range m.Withdrawn {
+		if withdrawn == order {
+			return balancedb.ErrorOrderAlreadyWithdrawn
+		}
+	}
+	balance, err := m.GetBalanceByUserID(userID)
+	if err != nil {
+		return gorm.ErrRecordNotFound
+	}
+	if balance.Current < sum {
+		return balancedb.ErrorInsufficientFunds
 	}
+	m.Withdrawn = append(m.Withdrawn, order)
 	return nil
 }
 
@@ -162,18 +498,14 @@ func (m *MockBalanceRepository) GetBalanceByUserID(userID uuid.UUID) (balancedb.
 	if uuidIDTest1 == userID {
 		return balancedb.Balance{
 			UserID:    uuidIDTest1,
-			Current:   545.6,
-			Withdrawn: 53,
+			Current:   money.FromFloat(545.6),
+			Withdrawn: money.FromFloat(53),
 			UpdatedAt: time.Now(),
 		}, nil
 	}
 	return balancedb.Balance{}, errors.New("null balance")
 }
 
-func (m *MockBalanceRepository) UpdateBalance(userID uuid.UUID, current, withdrawn float64) error {
-	return nil
-}
-
 func (m *MockBalanceRepository) GetOrdersWithdrawFunds() ([]string, error) {
 	var orders []string
 	return orders, nil
@@ -186,3 +518,322 @@ func (m *MockBalanceRepository) GetWithdrawalByUserID(userID uuid.UUID) (
 	var withdrawals []balancedb.Withdrawal
 	return withdrawals, nil
 }
+
+func (m *MockBalanceRepository) CreditOrder(orderID string, bonuses ...balancedb.Bonus) (bool, error) {
+	for _, credited := range m.Credited {
+		if credited == orderID {
+			return false, nil
+		}
+	}
+	m.Credited = append(m.Credited, orderID)
+	for _, bonus := range bonuses {
+		if bonus.Amount > 0 {
+			if m.Bonuses == nil {
+				m.Bonuses = make(map[string]money.Points)
+			}
+			m.Bonuses[orderID+"/"+bonus.Kind] += bonus.Amount
+		}
+	}
+	return true, nil
+}
+
+func (m *MockBalanceRepository) GetLedgerBalance(userID uuid.UUID) (balancedb.Balance, error) {
+	return m.GetBalanceByUserID(userID)
+}
+
+func (m *MockBalanceRepository) Reconcile() ([]balancedb.Discrepancy, error) {
+	uuidIDTest, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
+	return []balancedb.Discrepancy{
+		{
+			UserID:          uuidIDTest,
+			Current:         money.FromFloat(545.6),
+			Withdrawn:       money.FromFloat(53),
+			LedgerCurrent:   money.FromFloat(500),
+			LedgerWithdrawn: money.FromFloat(53),
+		},
+	}, nil
+}
+
+func (m *MockBalanceRepository) GetExpiredLotIDs(before time.Time) ([]uint, error) {
+	return []uint{1, 2}, nil
+}
+
+func (m *MockBalanceRepository) ExpireLot(lotID uint) (money.Points, error) {
+	return money.FromFloat(10), nil
+}
+
+func (m *MockBalanceRepository) GetExpiringPoints(
+	userID uuid.UUID,
+	before time.Time,
+) (money.Points, error) {
+	return money.FromFloat(25), nil
+}
+
+func (m *MockBalanceRepository) ReverseWithdrawal(
+	order string,
+	reason string,
+) (balancedb.Withdrawal, error) {
+	if order != "79927398713" {
+		return balancedb.Withdrawal{}, gorm.ErrRecordNotFound
+	}
+	reversedAt := time.Now()
+	withdrawal := balancedb.Withdrawal{
+		Order:          order,
+		Sum:            money.FromFloat(10),
+		Status:         balancedb.WithdrawalReversed,
+		ReversalReason: reason,
+		ReversedAt:     &reversedAt,
+	}
+	for _, reversed := range m.Reversed {
+		if reversed == order {
+			return withdrawal, nil
+		}
+	}
+	m.Reversed = append(m.Reversed, order)
+	return withdrawal, nil
+}
+
+func (m *MockBalanceRepository) AuthorizeHold(
+	userID uuid.UUID,
+	order string,
+	amount money.Points,
+	ttl time.Duration,
+) (balancedb.Hold, error) {
+	balance, err := m.GetBalanceByUserID(userID)
+	if err != nil {
+		return balancedb.Hold{}, gorm.ErrRecordNotFound
+	}
+	held, _ := m.GetHeldPoints(userID)
+	if balance.Current-held < amount {
+		return balancedb.Hold{}, balancedb.ErrorInsufficientFunds
+	}
+
+	if m.Holds == nil {
+		m.Holds = make(map[uuid.UUID]balancedb.Hold)
+	}
+	hold := balancedb.Hold{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Order:     order,
+		Amount:    amount,
+		Status:    balancedb.HoldActive,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	m.Holds[hold.ID] = hold
+	return hold, nil
+}
+
+func (m *MockBalanceRepository) CaptureHold(
+	userID uuid.UUID,
+	holdID uuid.UUID,
+) (balancedb.Withdrawal, error) {
+	hold, ok := m.Holds[holdID]
+	if !ok || hold.UserID != userID {
+		return balancedb.Withdrawal{}, gorm.ErrRecordNotFound
+	}
+	if hold.Status != balancedb.HoldActive && hold.Status != balancedb.HoldCaptured {
+		return balancedb.Withdrawal{}, balancedb.ErrorHoldNotActive
+	}
+	hold.Status = balancedb.HoldCaptured
+	m.Holds[holdID] = hold
+	return balancedb.Withdrawal{
+		UserID: userID,
+		Order:  hold.Order,
+		Sum:    hold.Amount,
+		Status: balancedb.WithdrawalCompleted,
+	}, nil
+}
+
+func (m *MockBalanceRepository) VoidHold(userID uuid.UUID, holdID uuid.UUID) (balancedb.Hold, error) {
+	hold, ok := m.Holds[holdID]
+	if !ok || hold.UserID != userID {
+		return balancedb.Hold{}, gorm.ErrRecordNotFound
+	}
+	if hold.Status != balancedb.HoldActive && hold.Status != balancedb.HoldVoided {
+		return balancedb.Hold{}, balancedb.ErrorHoldNotActive
+	}
+	hold.Status = balancedb.HoldVoided
+	m.Holds[holdID] = hold
+	return hold, nil
+}
+
+func (m *MockBalanceRepository) GetExpiredHoldIDs(before time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for id, hold := range m.Holds {
+		if hold.Status == balancedb.HoldActive && !hold.ExpiresAt.After(before) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *MockBalanceRepository) ExpireHold(holdID uuid.UUID) (bool, error) {
+	hold, ok := m.Holds[holdID]
+	if !ok || hold.Status != balancedb.HoldActive {
+		return false, nil
+	}
+	hold.Status = balancedb.HoldExpired
+	m.Holds[holdID] = hold
+	return true, nil
+}
+
+func (m *MockBalanceRepository) GetHeldPoints(userID uuid.UUID) (money.Points, error) {
+	var held money.Points
+	for _, hold := range m.Holds {
+		if hold.UserID == userID && hold.Status == balancedb.HoldActive {
+			held += hold.Amount
+		}
+	}
+	return held, nil
+}
+
+func (m *MockBalanceRepository) Transfer(
+	senderID uuid.UUID,
+	recipientID uuid.UUID,
+	amount money.Points,
+	dailyLimit money.Points,
+) (balancedb.Transfer, error) {
+	if m.Transferred+amount > dailyLimit {
+		return balancedb.Transfer{}, balancedb.ErrorTransferLimitExceeded
+	}
+	m.Transferred += amount
+	return balancedb.Transfer{
+		Reference:   "transfer:" + uuid.NewString(),
+		SenderID:    senderID,
+		RecipientID: recipientID,
+		Amount:      amount,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+func (m *MockBalanceRepository) GetStatement(
+	userID uuid.UUID,
+	filter balancedb.StatementFilter,
+) ([]balancedb.StatementLine, error) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var balance money.Points
+	var lines []balancedb.StatementLine
+	for id := uint(1); id <= 5; id++ {
+		line := balancedb.StatementLine{
+			ID:        id,
+			Kind:      balancedb.LedgerAccrual,
+			Reference: fmt.Sprintf("order-%d", id),
+			Amount:    money.FromFloat(10),
+			CreatedAt: start.AddDate(0, 0, int(id)),
+		}
+		if id == 5 {
+			line.Kind = balancedb.LedgerTransferIn
+			line.Reference = "transfer:69359037-9599-48e7-b8f2-48393c019137"
+		}
+		balance += line.Amount
+		line.Balance = balance
+		if id <= filter.After ||
+			!filter.From.IsZero() && line.CreatedAt.Before(filter.From) ||
+			!filter.To.IsZero() && !line.CreatedAt.Before(filter.To) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > filter.Limit {
+		lines = lines[:filter.Limit]
+	}
+	return lines, nil
+}
+
+func (m *MockBalanceRepository) Export(
+	filter balancedb.ExportFilter,
+	fn func(balancedb.ExportRow) error,
+) error {
+	accrual := money.FromFloat(10.5)
+	rows := []balancedb.ExportRow{
+		{
+			UserID:    filter.UserID,
+			Type:      balancedb.ExportTypeOrder,
+			Reference: "79927398713",
+			Status:    "PROCESSED",
+			Amount:    &accrual,
+			CreatedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			UserID:    filter.UserID,
+			Type:      balancedb.ExportTypeOrder,
+			Reference: "12345678903",
+			Status:    "STUCK",
+			CreatedAt: time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			UserID:    filter.UserID,
+			Type:      balancedb.LedgerAccrual,
+			Reference: "79927398713",
+			Amount:    &accrual,
+			Balance:   &accrual,
+			CreatedAt: time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, row := range rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MockBalanceRepository) GetDrifts() ([]balancedb.Drift, error) {
+	userID, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
+	return []balancedb.Drift{
+		{
+			UserID:            userID,
+			Current:           money.FromFloat(545.6),
+			Withdrawn:         money.FromFloat(53),
+			ExpectedCurrent:   money.FromFloat(545.6),
+			ExpectedWithdrawn: money.FromFloat(50),
+		},
+	}, nil
+}
+
+func (m *MockBalanceRepository) FixDrift(userID uuid.UUID) (*balancedb.Drift, error) {
+	m.Fixed = append(m.Fixed, userID)
+	return &balancedb.Drift{UserID: userID}, nil
+}
+
+func (m *MockBalanceRepository) GetTier(userID uuid.UUID) (balancedb.UserTier, error) {
+	name, ok := m.Tiers[userID]
+	if !ok {
+		return balancedb.UserTier{}, gorm.ErrRecordNotFound
+	}
+	return balancedb.UserTier{UserID: userID, Tier: name}, nil
+}
+
+func (m *MockBalanceRepository) GetTierChanges(userID uuid.UUID) ([]balancedb.TierChange, error) {
+	var changes []balancedb.TierChange
+	for _, change := range m.Changes {
+		if change.UserID == userID {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func (m *MockBalanceRepository) GetWindowAccruals(since time.Time) ([]balancedb.WindowAccrual, error) {
+	userID, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
+	return []balancedb.WindowAccrual{{UserID: userID, Accrual: money.FromFloat(1500)}}, nil
+}
+
+func (m *MockBalanceRepository) SetTier(userID uuid.UUID, name string, accrual money.Points) (bool, error) {
+	if m.Tiers == nil {
+		m.Tiers = make(map[uuid.UUID]string)
+	}
+	if m.Tiers[userID] == name {
+		return false, nil
+	}
+	m.Changes = append(
+		m.Changes, balancedb.TierChange{
+			UserID:  userID,
+			OldTier: m.Tiers[userID],
+			NewTier: name,
+			Accrual: accrual,
+		},
+	)
+	m.Tiers[userID] = name
+	return true, nil
+}
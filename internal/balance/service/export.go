@@ -0,0 +1,193 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/internal/db/balancedb"
+	"github.com/elina-chertova/loyalty-system/internal/security"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+)
+
+// ErrorNotValidExportFormat is returned for an unsupported export format.
+var ErrorNotValidExportFormat = errors.New("export format is not valid")
+
+// ExportFormat is the file format of the points history export.
+type ExportFormat string
+
+// Supported export formats.
+const (
+	ExportCSV   ExportFormat = "csv"
+	ExportJSONL ExportFormat = "jsonl"
+)
+
+// ExportColumns are the columns of the CSV export, in order. They match
+// the keys of the JSON Lines export.
+var ExportColumns = []string{"user_id", "type", "reference", "status", "amount", "balance", "created_at"}
+
+// ParseExportFormat returns the export format with the given name.
+func ParseExportFormat(name string) (ExportFormat, error) {
+	switch format := ExportFormat(name); format {
+	case ExportCSV, ExportJSONL:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrorNotValidExportFormat, name)
+	}
+}
+
+// ContentType returns the media type of the export in the format.
+func (format ExportFormat) ContentType() string {
+	if format == ExportCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// ExportRowFormat defines the format of a row of the points history export.
+// Amount of an order is empty until the order is processed; Balance is empty
+// for orders.
+type ExportRowFormat struct {
+	UserID    uuid.UUID     `json:"user_id"`
+	Type      string        `json:"type"`
+	Reference string        `json:"reference"`
+	Status    string        `json:"status"`
+	Amount    *money.Points `json:"amount"`
+	Balance   *money.Points `json:"balance"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// ExportStatement writes the full points history of the user identified by
+// a token to w in the format: the uploaded orders and every ledger entry
+// with the running balance.
+func (bal *UserBalance) ExportStatement(token string, format ExportFormat, w io.Writer) error {
+	userID, err := security.GetUserIDFromToken(token)
+	if err != nil {
+		return fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+	return bal.export(balancedb.ExportFilter{UserID: userID}, format, w, true)
+}
+
+// ExportAll writes the points history of every user within [from, to)
+// to w in the format.
+func (bal *UserBalance) ExportAll(from, to time.Time, format ExportFormat, w io.Writer) error {
+	return bal.export(balancedb.ExportFilter{From: from, To: to}, format, w, false)
+}
+
+// export streams the rows selected by the filter to w. The orders of users
+// are given the statuses the users see.
+func (bal *UserBalance) export(
+	filter balancedb.ExportFilter,
+	format ExportFormat,
+	w io.Writer,
+	user bool,
+) error {
+	var rows exportWriter
+	switch format {
+	case ExportCSV:
+		rows = newCSVExportWriter(w)
+	case ExportJSONL:
+		rows = &jsonlExportWriter{encoder: json.NewEncoder(w)}
+	default:
+		return fmt.Errorf("%w: %q", ErrorNotValidExportFormat, format)
+	}
+
+	err := bal.balanceRep.Export(
+		filter, func(row balancedb.ExportRow) error {
+			if user && row.Status == config.Stuck {
+				row.Status = config.Processing
+			}
+			return rows.write(
+				ExportRowFormat{
+					UserID:    row.UserID,
+					Type:      row.Type,
+					Reference: row.Reference,
+					Status:    row.Status,
+					Amount:    row.Amount,
+					Balance:   row.Balance,
+					CreatedAt: row.CreatedAt,
+				},
+			)
+		},
+	)
+	if err != nil {
+		return err
+	}
+	return rows.flush()
+}
+
+// exportWriter writes the rows of the export in a specific format.
+type exportWriter interface {
+	write(row ExportRowFormat) error
+	flush() error
+}
+
+// csvExportWriter writes the export as CSV with a header of ExportColumns.
+type csvExportWriter struct {
+	writer *csv.Writer
+	header bool
+}
+
+func newCSVExportWriter(w io.Writer) *csvExportWriter {
+	return &csvExportWriter{writer: csv.NewWriter(w)}
+}
+
+func (e *csvExportWriter) write(row ExportRowFormat) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.writer.Write(
+		[]string{
+			row.UserID.String(),
+			row.Type,
+			row.Reference,
+			row.Status,
+			formatPoints(row.Amount),
+			formatPoints(row.Balance),
+			row.CreatedAt.UTC().Format(time.RFC3339),
+		},
+	)
+}
+
+// writeHeader writes the header once, so that an empty export still has it.
+func (e *csvExportWriter) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.writer.Write(ExportColumns)
+}
+
+func (e *csvExportWriter) flush() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// formatPoints formats optional points, an empty string standing for none.
+func formatPoints(p *money.Points) string {
+	if p == nil {
+		return ""
+	}
+	return p.String()
+}
+
+// jsonlExportWriter writes the export as JSON Lines, an object per row.
+type jsonlExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (e *jsonlExportWriter) write(row ExportRowFormat) error {
+	return e.encoder.Encode(row)
+}
+
+func (e *jsonlExportWriter) flush() error {
+	return nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/elina-chertova/loyalty-system/internal/security"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserBalance_ExportStatement(t *testing.T) {
+	userBalance := NewBalance(&MockBalanceRepository{})
+	userID, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
+	token, _ := security.GenerateToken(userID)
+
+	var out bytes.Buffer
+	assert.NoError(t, userBalance.ExportStatement(token, ExportCSV, &out))
+	assert.Equal(
+		t,
+		"user_id,type,reference,status,amount,balance,created_at\n"+
+			userID.String()+",order,79927398713,PROCESSED,10.5,,2024-01-01T12:00:00Z\n"+
+			userID.String()+",order,12345678903,PROCESSING,,,2024-01-01T12:30:00Z\n"+
+			userID.String()+",accrual,79927398713,,10.5,10.5,2024-01-01T13:00:00Z\n",
+		out.String(),
+	)
+
+	out.Reset()
+	assert.NoError(t, userBalance.ExportStatement(token, ExportJSONL, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	var row map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &row))
+	keys := make([]string, 0, len(row))
+	for key := range row {
+		keys = append(keys, key)
+	}
+	assert.ElementsMatch(t, ExportColumns, keys)
+	assert.Nil(t, row["amount"])
+}
+
+func TestParseExportFormat(t *testing.T) {
+	format, err := ParseExportFormat("jsonl")
+	assert.NoError(t, err)
+	assert.Equal(t, ExportJSONL, format)
+
+	_, err = ParseExportFormat("xlsx")
+	assert.ErrorIs(t, err, ErrorNotValidExportFormat)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/internal/db/balancedb"
+	"github.com/elina-chertova/loyalty-system/internal/security"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+)
+
+// ErrorNotValidStatementQuery is returned when the cursor, the period or
+// the limit of a statement cannot be parsed.
+// ErrorNotValidPeriod is returned when a period cannot be parsed.
+var (
+	ErrorNotValidStatementQuery = errors.New("statement query is not valid")
+	ErrorNotValidPeriod         = errors.New("period is not valid")
+)
+
+// dateLayout is the layout of the dates which select whole days.
+const dateLayout = "2006-01-02"
+
+// StatementQuery holds the raw parameters of a statement request. From and To
+// are RFC 3339 times or dates; a date in To includes the whole day. Cursor is
+// the NextCursor of the previous page.
+type StatementQuery struct {
+	Cursor string
+	From   string
+	To     string
+	Limit  string
+}
+
+// StatementLineFormat defines the format for representing statement lines.
+type StatementLineFormat struct {
+	Type      string       `json:"type"`
+	Reference string       `json:"reference"`
+	Amount    money.Points `json:"amount"`
+	Balance   money.Points `json:"balance"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// StatementFormat defines the format for representing a page of a statement.
+// NextCursor is empty on the last page.
+type StatementFormat struct {
+	Lines      []StatementLineFormat `json:"lines"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// Statement retrieves a page of the account statement of the user identified
+// by a token: the credited accruals, withdrawals, transfers, expiries and
+// adjustments in chronological order, each with the running balance.
+func (bal *UserBalance) Statement(token string, query StatementQuery) (StatementFormat, error) {
+	userID, err := security.GetUserIDFromToken(token)
+	if err != nil {
+		return StatementFormat{}, fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+	filter, err := parseStatementQuery(query)
+	if err != nil {
+		return StatementFormat{}, err
+	}
+
+	// One line more than requested tells whether there is a next page.
+	limit := filter.Limit
+	filter.Limit++
+	lines, err := bal.balanceRep.GetStatement(userID, filter)
+	if err != nil {
+		return StatementFormat{}, fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+
+	statement := StatementFormat{Lines: make([]StatementLineFormat, 0, len(lines))}
+	if len(lines) > limit {
+		lines = lines[:limit]
+		statement.NextCursor = strconv.FormatUint(uint64(lines[limit-1].ID), 10)
+	}
+	for _, line := range lines {
+		statement.Lines = append(
+			statement.Lines, StatementLineFormat{
+				Type:      line.Kind,
+				Reference: line.Reference,
+				Amount:    line.Amount,
+				Balance:   line.Balance,
+				CreatedAt: line.CreatedAt,
+			},
+		)
+	}
+	return statement, nil
+}
+
+// parseStatementQuery converts the raw parameters of a statement request
+// to the filter of the statement lines.
+func parseStatementQuery(query StatementQuery) (balancedb.StatementFilter, error) {
+	filter := balancedb.StatementFilter{Limit: config.DefaultStatementLimit}
+
+	if query.Cursor != "" {
+		after, err := strconv.ParseUint(query.Cursor, 10, 0)
+		if err != nil {
+			return filter, fmt.Errorf("%w: cursor %q", ErrorNotValidStatementQuery, query.Cursor)
+		}
+		filter.After = uint(after)
+	}
+	if query.Limit != "" {
+		limit, err := strconv.Atoi(query.Limit)
+		if err != nil || limit <= 0 || limit > config.MaxStatementLimit {
+			return filter, fmt.Errorf("%w: limit %q", ErrorNotValidStatementQuery, query.Limit)
+		}
+		filter.Limit = limit
+	}
+
+	var err error
+	filter.From, filter.To, err = ParsePeriod(query.From, query.To)
+	if err != nil {
+		return filter, fmt.Errorf("%w: %v", ErrorNotValidStatementQuery, err)
+	}
+	return filter, nil
+}
+
+// ParsePeriod parses the bounds of a period, RFC 3339 times or dates; a date
+// ending the period includes the whole day. Empty bounds leave the period open.
+func ParsePeriod(from, to string) (time.Time, time.Time, error) {
+	start, err := parsePeriodTime(from, false)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := parsePeriodTime(to, true)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: from must precede to", ErrorNotValidPeriod)
+	}
+	return start, end, nil
+}
+
+// parsePeriodTime parses an RFC 3339 time or a date. A date which ends
+// the period is moved to the end of the day.
+func parsePeriodTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: time %q", ErrorNotValidPeriod, value)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/elina-chertova/loyalty-system/internal/security"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserBalance_Statement(t *testing.T) {
+	userBalance := NewBalance(&MockBalanceRepository{})
+	userID, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
+	token, _ := security.GenerateToken(userID)
+
+	page, err := userBalance.Statement(token, StatementQuery{Limit: "2"})
+	assert.NoError(t, err)
+	assert.Len(t, page.Lines, 2)
+	assert.Equal(t, money.FromFloat(20), page.Lines[1].Balance)
+	assert.Equal(t, "2", page.NextCursor)
+
+	page, err = userBalance.Statement(token, StatementQuery{Cursor: page.NextCursor, Limit: "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "order-3", page.Lines[0].Reference)
+	assert.Equal(t, money.FromFloat(30), page.Lines[0].Balance)
+
+	page, err = userBalance.Statement(token, StatementQuery{Cursor: "4"})
+	assert.NoError(t, err)
+	assert.Equal(t, "transfer_in", page.Lines[0].Type, "incoming transfers are listed")
+	assert.Equal(t, money.FromFloat(50), page.Lines[0].Balance)
+
+	page, err = userBalance.Statement(token, StatementQuery{From: "2024-01-03", To: "2024-01-04"})
+	assert.NoError(t, err)
+	assert.Len(t, page.Lines, 2, "a date ending the period includes the whole day")
+	assert.Equal(t, money.FromFloat(30), page.Lines[1].Balance, "running balance counts earlier lines")
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestUserBalance_Statement_NotValidQuery(t *testing.T) {
+	userBalance := NewBalance(&MockBalanceRepository{})
+	userID, _ := uuid.Parse("69359037-9599-48e7-b8f2-48393c019135")
+	token, _ := security.GenerateToken(userID)
+
+	tests := []struct {
+		name  string
+		query StatementQuery
+	}{
+		{"cursor", StatementQuery{Cursor: "abc"}},
+		{"zero limit", StatementQuery{Limit: "0"}},
+		{"limit over maximum", StatementQuery{Limit: "100000"}},
+		{"from", StatementQuery{From: "yesterday"}},
+		{"to before from", StatementQuery{From: "2024-01-05", To: "2024-01-01"}},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				_, err := userBalance.Statement(token, tt.query)
+				assert.ErrorIs(t, err, ErrorNotValidStatementQuery)
+			},
+		)
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/elina-chertova/loyalty-system/internal/auth/handlers"
+	"github.com/elina-chertova/loyalty-system/internal/campaign/service"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type CampaignService interface {
+	CreateCampaign(request service.CampaignRequest) (service.CampaignFormat, error)
+	GetCampaigns() ([]service.CampaignFormat, error)
+	GetCampaign(campaignID string) (service.CampaignFormat, error)
+	UpdateCampaign(campaignID string, request service.CampaignRequest) (service.CampaignFormat, error)
+	DeleteCampaign(campaignID string) error
+}
+
+type CampaignHandler struct {
+	campaign CampaignService
+}
+
+func NewCampaignHandler(c CampaignService) *CampaignHandler {
+	return &CampaignHandler{campaign: c}
+}
+
+// CreateCampaignHandler creates a promotional campaign.
+func (campaign *CampaignHandler) CreateCampaignHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request service.CampaignRequest
+		if err := c.BindJSON(&request); err != nil {
+			respondWithError(c, http.StatusBadRequest, "Check json input", err)
+			return
+		}
+
+		created, err := campaign.campaign.CreateCampaign(request)
+		if err != nil {
+			respondWithCampaignError(c, "error in CreateCampaign", err)
+			return
+		}
+		respondWithJSON(c, http.StatusCreated, created)
+	}
+}
+
+// GetCampaignsHandler lists the promotional campaigns with the points they
+// have cost so far.
+func (campaign *CampaignHandler) GetCampaignsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		campaigns, err := campaign.campaign.GetCampaigns()
+		if err != nil {
+			respondWithError(c, http.StatusInternalServerError, "error in GetCampaigns", err)
+			return
+		}
+		respondWithJSON(c, http.StatusOK, campaigns)
+	}
+}
+
+// GetCampaignHandler retrieves the promotional campaign with the points it
+// has cost so far.
+func (campaign *CampaignHandler) GetCampaignHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		found, err := campaign.campaign.GetCampaign(c.Param("id"))
+		if err != nil {
+			respondWithCampaignError(c, "error in GetCampaign", err)
+			return
+		}
+		respondWithJSON(c, http.StatusOK, found)
+	}
+}
+
+// UpdateCampaignHandler replaces the definition of the promotional campaign.
+func (campaign *CampaignHandler) UpdateCampaignHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request service.CampaignRequest
+		if err := c.BindJSON(&request); err != nil {
+			respondWithError(c, http.StatusBadRequest, "Check json input", err)
+			return
+		}
+
+		updated, err := campaign.campaign.UpdateCampaign(c.Param("id"), request)
+		if err != nil {
+			respondWithCampaignError(c, "error in UpdateCampaign", err)
+			return
+		}
+		respondWithJSON(c, http.StatusOK, updated)
+	}
+}
+
+// DeleteCampaignHandler deletes the promotional campaign. The bonuses it has
+// granted are kept.
+func (campaign *CampaignHandler) DeleteCampaignHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := campaign.campaign.DeleteCampaign(c.Param("id")); err != nil {
+			respondWithCampaignError(c, "error in DeleteCampaign", err)
+			return
+		}
+		respondWithJSON(
+			c, http.StatusOK, handlers.Response{
+				Message: "Campaign is deleted",
+				Status:  http.StatusText(http.StatusOK),
+			},
+		)
+	}
+}
+
+func respondWithCampaignError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, service.ErrorNotValidCampaign):
+		respondWithError(c, http.StatusBadRequest, err.Error(), err)
+	case errors.Is(err, service.ErrorCampaignNotFound):
+		respondWithError(c, http.StatusNotFound, message, err)
+	default:
+		respondWithError(c, http.StatusInternalServerError, message, err)
+	}
+}
+
+func respondWithError(c *gin.Context, statusCode int, message string, err error) {
+	logger.Logger.Error(
+		message,
+		zap.String("endpoint", c.Request.URL.Path),
+		zap.Error(err),
+	)
+	c.AbortWithStatusJSON(
+		statusCode, handlers.Response{
+			Message: message,
+			Status:  http.StatusText(statusCode),
+		},
+	)
+}
+
+func respondWithJSON(c *gin.Context, statusCode int, data interface{}) {
+	result, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, "Server error", err)
+		return
+	}
+
+	c.Writer.WriteHeader(statusCode)
+	_, err = c.Writer.Write(result)
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,330 @@
+// Package service provides functionalities for managing the promotional
+// campaigns of the loyalty system and for evaluating the bonuses they grant.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/db/balancedb"
+	"github.com/elina-chertova/loyalty-system/internal/db/campaigndb"
+	"github.com/elina-chertova/loyalty-system/internal/db/orderdb"
+	"github.com/elina-chertova/loyalty-system/internal/tier"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"gorm.io/gorm"
+)
+
+// Campaigns handles operations related to promotional campaigns.
+// Tiers are the loyalty tiers which campaigns can be restricted to.
+type Campaigns struct {
+	campaignRep campaigndb.CampaignRepository
+	Tiers       tier.Tiers
+}
+
+// NewCampaigns creates a new instance of Campaigns with the given CampaignRepository.
+func NewCampaigns(model campaigndb.CampaignRepository) *Campaigns {
+	return &Campaigns{campaignRep: model}
+}
+
+// Predefined errors for campaign operations.
+var (
+	ErrorSystem           = errors.New("error in loyality system")
+	ErrorNotValidCampaign = errors.New("campaign is not valid")
+	ErrorCampaignNotFound = errors.New("campaign not found")
+)
+
+// CampaignRequest defines a campaign. Multiplier is used by the campaigns of
+// the multiplier bonus type and Amount by the fixed ones.
+type CampaignRequest struct {
+	Name           string          `json:"name"`
+	StartsAt       time.Time       `json:"starts_at"`
+	EndsAt         time.Time       `json:"ends_at"`
+	BonusType      string          `json:"bonus_type"`
+	Multiplier     tier.Multiplier `json:"multiplier,omitempty"`
+	Amount         money.Points    `json:"amount,omitempty"`
+	FirstOrderOnly bool            `json:"first_order_only"`
+	MinAccrual     money.Points    `json:"min_accrual,omitempty"`
+	Tiers          []string        `json:"tiers,omitempty"`
+}
+
+// CampaignFormat is a campaign together with the number of orders it has
+// granted a bonus for and the points it has cost so far.
+type CampaignFormat struct {
+	ID uint `json:"id"`
+	CampaignRequest
+	Active    bool         `json:"active"`
+	Orders    int64        `json:"orders"`
+	Cost      money.Points `json:"cost"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// CreateCampaign validates and stores a new campaign.
+func (c *Campaigns) CreateCampaign(request CampaignRequest) (CampaignFormat, error) {
+	campaign, err := c.toCampaign(request)
+	if err != nil {
+		return CampaignFormat{}, err
+	}
+	if err := c.campaignRep.CreateCampaign(&campaign); err != nil {
+		return CampaignFormat{}, fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+	return ConvertToCampaignFormat(campaign, campaigndb.CampaignCost{}), nil
+}
+
+// GetCampaigns lists all campaigns with their costs.
+func (c *Campaigns) GetCampaigns() ([]CampaignFormat, error) {
+	campaigns, err := c.campaignRep.GetCampaigns()
+	if err != nil {
+		return nil, fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+	ids := make([]uint, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		ids = append(ids, campaign.ID)
+	}
+	costs, err := c.costs(ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	formatted := make([]CampaignFormat, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		formatted = append(formatted, ConvertToCampaignFormat(campaign, costs[campaign.ID]))
+	}
+	return formatted, nil
+}
+
+// GetCampaign retrieves the campaign with its cost.
+func (c *Campaigns) GetCampaign(campaignID string) (CampaignFormat, error) {
+	id, err := parseCampaignID(campaignID)
+	if err != nil {
+		return CampaignFormat{}, err
+	}
+	campaign, err := c.campaignRep.GetCampaign(id)
+	if err != nil {
+		return CampaignFormat{}, campaignError(err)
+	}
+	costs, err := c.costs(id)
+	if err != nil {
+		return CampaignFormat{}, err
+	}
+	return ConvertToCampaignFormat(campaign, costs[id]), nil
+}
+
+// UpdateCampaign replaces the definition of the campaign. The bonuses already
+// granted by the campaign are not affected.
+func (c *Campaigns) UpdateCampaign(campaignID string, request CampaignRequest) (CampaignFormat, error) {
+	id, err := parseCampaignID(campaignID)
+	if err != nil {
+		return CampaignFormat{}, err
+	}
+	campaign, err := c.toCampaign(request)
+	if err != nil {
+		return CampaignFormat{}, err
+	}
+	campaign.ID = id
+	if err := c.campaignRep.UpdateCampaign(&campaign); err != nil {
+		return CampaignFormat{}, campaignError(err)
+	}
+	return c.GetCampaign(campaignID)
+}
+
+// DeleteCampaign stops the campaign and removes it from the list. The bonuses
+// already granted by the campaign stay attributed to it.
+func (c *Campaigns) DeleteCampaign(campaignID string) error {
+	id, err := parseCampaignID(campaignID)
+	if err != nil {
+		return err
+	}
+	if err := c.campaignRep.DeleteCampaign(id); err != nil {
+		return campaignError(err)
+	}
+	return nil
+}
+
+// Bonuses evaluates the campaigns which were running when the order was
+// uploaded and returns the bonuses of those the order is eligible for,
+// each attributed to its campaign. userTier is the name of the loyalty tier
+// of the order's user.
+func (c *Campaigns) Bonuses(order orderdb.OrderAccrual, userTier string) ([]balancedb.Bonus, error) {
+	campaigns, err := c.campaignRep.GetActiveCampaigns(order.UploadedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	var bonuses []balancedb.Bonus
+	var firstOrder *bool
+	for i := range campaigns {
+		campaign := campaigns[i]
+		if order.SumAccrual < campaign.MinAccrual || !hasTier(campaign.Tiers, userTier) {
+			continue
+		}
+		if campaign.FirstOrderOnly {
+			if firstOrder == nil {
+				credited, err := c.campaignRep.HasCreditedOrders(order.UserID)
+				if err != nil {
+					return nil, err
+				}
+				first := !credited
+				firstOrder = &first
+			}
+			if !*firstOrder {
+				continue
+			}
+		}
+
+		bonus := balancedb.Bonus{
+			Kind:       balancedb.LedgerCampaignBonus,
+			Amount:     campaign.Amount,
+			CampaignID: &campaign.ID,
+		}
+		if campaign.BonusType == campaigndb.BonusMultiplier {
+			bonus.Amount = campaign.Multiplier.Bonus(order.SumAccrual)
+		}
+		bonuses = append(bonuses, bonus)
+	}
+	return bonuses, nil
+}
+
+// ConvertToCampaignFormat converts a campaign and its cost to CampaignFormat.
+func ConvertToCampaignFormat(campaign campaigndb.Campaign, cost campaigndb.CampaignCost) CampaignFormat {
+	now := time.Now()
+	formatted := CampaignFormat{
+		ID: campaign.ID,
+		CampaignRequest: CampaignRequest{
+			Name:           campaign.Name,
+			StartsAt:       campaign.StartsAt,
+			EndsAt:         campaign.EndsAt,
+			BonusType:      campaign.BonusType,
+			Multiplier:     campaign.Multiplier,
+			Amount:         campaign.Amount,
+			FirstOrderOnly: campaign.FirstOrderOnly,
+			MinAccrual:     campaign.MinAccrual,
+		},
+		Active:    !now.Before(campaign.StartsAt) && now.Before(campaign.EndsAt),
+		Orders:    cost.Orders,
+		Cost:      cost.Bonus,
+		CreatedAt: campaign.CreatedAt,
+		UpdatedAt: campaign.UpdatedAt,
+	}
+	if campaign.Tiers != "" {
+		formatted.Tiers = strings.Split(campaign.Tiers, ",")
+	}
+	return formatted
+}
+
+// toCampaign validates the request and converts it to a campaign.
+func (c *Campaigns) toCampaign(request CampaignRequest) (campaigndb.Campaign, error) {
+	name := strings.TrimSpace(request.Name)
+	switch {
+	case name == "":
+		return campaigndb.Campaign{}, fmt.Errorf("%w: name is required", ErrorNotValidCampaign)
+	case request.StartsAt.IsZero() || request.EndsAt.IsZero():
+		return campaigndb.Campaign{}, fmt.Errorf("%w: starts_at and ends_at are required", ErrorNotValidCampaign)
+	case !request.EndsAt.After(request.StartsAt):
+		return campaigndb.Campaign{}, fmt.Errorf("%w: ends_at must be after starts_at", ErrorNotValidCampaign)
+	case request.MinAccrual < 0:
+		return campaigndb.Campaign{}, fmt.Errorf("%w: min_accrual must not be negative", ErrorNotValidCampaign)
+	}
+
+	switch request.BonusType {
+	case campaigndb.BonusMultiplier:
+		if request.Multiplier <= tier.One || request.Amount != 0 {
+			return campaigndb.Campaign{}, fmt.Errorf(
+				"%w: multiplier campaigns need a multiplier above 1 and no amount",
+				ErrorNotValidCampaign,
+			)
+		}
+	case campaigndb.BonusFixed:
+		if request.Amount <= 0 || request.Multiplier != 0 {
+			return campaigndb.Campaign{}, fmt.Errorf(
+				"%w: fixed campaigns need a positive amount and no multiplier",
+				ErrorNotValidCampaign,
+			)
+		}
+	default:
+		return campaigndb.Campaign{}, fmt.Errorf(
+			"%w: bonus_type must be %q or %q",
+			ErrorNotValidCampaign,
+			campaigndb.BonusMultiplier,
+			campaigndb.BonusFixed,
+		)
+	}
+
+	for _, name := range request.Tiers {
+		if !c.isTier(name) {
+			return campaigndb.Campaign{}, fmt.Errorf("%w: unknown tier %q", ErrorNotValidCampaign, name)
+		}
+	}
+
+	return campaigndb.Campaign{
+		Name:           name,
+		StartsAt:       request.StartsAt,
+		EndsAt:         request.EndsAt,
+		BonusType:      request.BonusType,
+		Multiplier:     request.Multiplier,
+		Amount:         request.Amount,
+		FirstOrderOnly: request.FirstOrderOnly,
+		MinAccrual:     request.MinAccrual,
+		Tiers:          strings.Join(request.Tiers, ","),
+	}, nil
+}
+
+// isTier reports whether name is one of the loyalty tiers.
+func (c *Campaigns) isTier(name string) bool {
+	for _, t := range c.Tiers {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// costs returns the costs of the campaigns by their IDs.
+func (c *Campaigns) costs(ids ...uint) (map[uint]campaigndb.CampaignCost, error) {
+	costs := make(map[uint]campaigndb.CampaignCost, len(ids))
+	if len(ids) == 0 {
+		return costs, nil
+	}
+	rows, err := c.campaignRep.GetCampaignCosts(ids)
+	if err != nil {
+		return nil, fmt.Errorf("%w; %v", ErrorSystem, err)
+	}
+	for _, cost := range rows {
+		costs[cost.CampaignID] = cost
+	}
+	return costs, nil
+}
+
+// hasTier reports whether the comma-separated tiers include userTier.
+// Empty tiers include every tier.
+func hasTier(tiers string, userTier string) bool {
+	if tiers == "" {
+		return true
+	}
+	for _, name := range strings.Split(tiers, ",") {
+		if name == userTier {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCampaignID converts the campaign ID from a path parameter.
+func parseCampaignID(campaignID string) (uint, error) {
+	id, err := strconv.ParseUint(campaignID, 10, 64)
+	if err != nil || id == 0 {
+		return 0, ErrorCampaignNotFound
+	}
+	return uint(id), nil
+}
+
+// campaignError maps the repository errors to the errors of the service.
+func campaignError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrorCampaignNotFound
+	}
+	return fmt.Errorf("%w; %v", ErrorSystem, err)
+}
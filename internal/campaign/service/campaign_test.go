@@ -0,0 +1,253 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/db/balancedb"
+	"github.com/elina-chertova/loyalty-system/internal/db/campaigndb"
+	"github.com/elina-chertova/loyalty-system/internal/db/orderdb"
+	"github.com/elina-chertova/loyalty-system/internal/tier"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type MockCampaignRepository struct {
+	Campaigns []campaigndb.Campaign
+	Costs     []campaigndb.CampaignCost
+	Credited  map[uuid.UUID]bool
+}
+
+func (m *MockCampaignRepository) CreateCampaign(campaign *campaigndb.Campaign) error {
+	campaign.ID = uint(len(m.Campaigns) + 1)
+	m.Campaigns = append(m.Campaigns, *campaign)
+	return nil
+}
+
+func (m *MockCampaignRepository) GetCampaign(id uint) (campaigndb.Campaign, error) {
+	for _, campaign := range m.Campaigns {
+		if campaign.ID == id {
+			return campaign, nil
+		}
+	}
+	return campaigndb.Campaign{}, gorm.ErrRecordNotFound
+}
+
+func (m *MockCampaignRepository) GetCampaigns() ([]campaigndb.Campaign, error) {
+	return m.Campaigns, nil
+}
+
+func (m *MockCampaignRepository) UpdateCampaign(campaign *campaigndb.Campaign) error {
+	for i := range m.Campaigns {
+		if m.Campaigns[i].ID == campaign.ID {
+			m.Campaigns[i] = *campaign
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (m *MockCampaignRepository) DeleteCampaign(id uint) error {
+	for i := range m.Campaigns {
+		if m.Campaigns[i].ID == id {
+			m.Campaigns = append(m.Campaigns[:i], m.Campaigns[i+1:]...)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (m *MockCampaignRepository) GetActiveCampaigns(at time.Time) ([]campaigndb.Campaign, error) {
+	var active []campaigndb.Campaign
+	for _, campaign := range m.Campaigns {
+		if !at.Before(campaign.StartsAt) && at.Before(campaign.EndsAt) {
+			active = append(active, campaign)
+		}
+	}
+	return active, nil
+}
+
+func (m *MockCampaignRepository) GetCampaignCosts(ids []uint) ([]campaigndb.CampaignCost, error) {
+	return m.Costs, nil
+}
+
+func (m *MockCampaignRepository) HasCreditedOrders(userID uuid.UUID) (bool, error) {
+	return m.Credited[userID], nil
+}
+
+var weekend = time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+
+func TestCampaigns_CreateCampaign(t *testing.T) {
+	campaigns := NewCampaigns(&MockCampaignRepository{})
+	campaigns.Tiers, _ = tier.Parse("bronze:0:1,gold:5000:1.25")
+
+	valid := CampaignRequest{
+		Name:       " Double points ",
+		StartsAt:   weekend,
+		EndsAt:     weekend.Add(48 * time.Hour),
+		BonusType:  campaigndb.BonusMultiplier,
+		Multiplier: 200,
+		Tiers:      []string{"gold"},
+	}
+	created, err := campaigns.CreateCampaign(valid)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), created.ID)
+	assert.Equal(t, "Double points", created.Name)
+	assert.Equal(t, []string{"gold"}, created.Tiers)
+
+	tests := []struct {
+		name   string
+		modify func(r *CampaignRequest)
+	}{
+		{"empty name", func(r *CampaignRequest) { r.Name = " " }},
+		{"no start", func(r *CampaignRequest) { r.StartsAt = time.Time{} }},
+		{"ends before start", func(r *CampaignRequest) { r.EndsAt = r.StartsAt }},
+		{"unknown bonus type", func(r *CampaignRequest) { r.BonusType = "percent" }},
+		{"multiplier of 1", func(r *CampaignRequest) { r.Multiplier = tier.One }},
+		{"multiplier with amount", func(r *CampaignRequest) { r.Amount = money.FromFloat(100) }},
+		{"fixed without amount", func(r *CampaignRequest) { r.BonusType = campaigndb.BonusFixed }},
+		{"negative min accrual", func(r *CampaignRequest) { r.MinAccrual = -1 }},
+		{"unknown tier", func(r *CampaignRequest) { r.Tiers = []string{"platinum"} }},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				request := valid
+				tt.modify(&request)
+				_, err := campaigns.CreateCampaign(request)
+				assert.ErrorIs(t, err, ErrorNotValidCampaign)
+			},
+		)
+	}
+}
+
+func TestCampaigns_Crud(t *testing.T) {
+	rep := &MockCampaignRepository{
+		Costs: []campaigndb.CampaignCost{{CampaignID: 1, Orders: 3, Bonus: money.FromFloat(300)}},
+	}
+	campaigns := NewCampaigns(rep)
+	request := CampaignRequest{
+		Name:      "First order",
+		StartsAt:  weekend,
+		EndsAt:    weekend.AddDate(1, 0, 0),
+		BonusType: campaigndb.BonusFixed,
+		Amount:    money.FromFloat(100),
+	}
+	_, err := campaigns.CreateCampaign(request)
+	require.NoError(t, err)
+
+	found, err := campaigns.GetCampaign("1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), found.Orders)
+	assert.Equal(t, money.FromFloat(300), found.Cost)
+
+	request.FirstOrderOnly = true
+	updated, err := campaigns.UpdateCampaign("1", request)
+	require.NoError(t, err)
+	assert.True(t, updated.FirstOrderOnly)
+
+	list, err := campaigns.GetCampaigns()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, money.FromFloat(300), list[0].Cost)
+
+	require.NoError(t, campaigns.DeleteCampaign("1"))
+	assert.ErrorIs(t, campaigns.DeleteCampaign("1"), ErrorCampaignNotFound)
+	_, err = campaigns.GetCampaign("x")
+	assert.ErrorIs(t, err, ErrorCampaignNotFound)
+	_, err = campaigns.UpdateCampaign("2", request)
+	assert.ErrorIs(t, err, ErrorCampaignNotFound)
+}
+
+func TestCampaigns_Bonuses(t *testing.T) {
+	returning, newcomer := uuid.New(), uuid.New()
+	rep := &MockCampaignRepository{
+		Campaigns: []campaigndb.Campaign{
+			{
+				Model:      gorm.Model{ID: 1},
+				StartsAt:   weekend,
+				EndsAt:     weekend.Add(48 * time.Hour),
+				BonusType:  campaigndb.BonusMultiplier,
+				Multiplier: 200,
+			},
+			{
+				Model:          gorm.Model{ID: 2},
+				StartsAt:       weekend.AddDate(0, -1, 0),
+				EndsAt:         weekend.AddDate(0, 1, 0),
+				BonusType:      campaigndb.BonusFixed,
+				Amount:         money.FromFloat(100),
+				FirstOrderOnly: true,
+			},
+			{
+				Model:      gorm.Model{ID: 3},
+				StartsAt:   weekend.AddDate(0, -1, 0),
+				EndsAt:     weekend.AddDate(0, 1, 0),
+				BonusType:  campaigndb.BonusFixed,
+				Amount:     money.FromFloat(50),
+				MinAccrual: money.FromFloat(500),
+				Tiers:      "silver,gold",
+			},
+		},
+		Credited: map[uuid.UUID]bool{returning: true},
+	}
+	campaigns := NewCampaigns(rep)
+
+	bonusesOf := func(bonuses []balancedb.Bonus) map[uint]money.Points {
+		amounts := make(map[uint]money.Points)
+		for _, bonus := range bonuses {
+			assert.Equal(t, balancedb.LedgerCampaignBonus, bonus.Kind)
+			amounts[*bonus.CampaignID] = bonus.Amount
+		}
+		return amounts
+	}
+
+	tests := []struct {
+		name  string
+		order orderdb.OrderAccrual
+		tier  string
+		want  map[uint]money.Points
+	}{
+		{
+			name: "weekend order of a returning gold user",
+			order: orderdb.OrderAccrual{
+				UserID:     returning,
+				SumAccrual: money.FromFloat(729.98),
+				UploadedAt: weekend.Add(time.Hour),
+			},
+			tier: "gold",
+			want: map[uint]money.Points{1: money.FromFloat(729.98), 3: money.FromFloat(50)},
+		},
+		{
+			name: "first order of a newcomer after the weekend",
+			order: orderdb.OrderAccrual{
+				UserID:     newcomer,
+				SumAccrual: money.FromFloat(100),
+				UploadedAt: weekend.Add(48 * time.Hour),
+			},
+			tier: "bronze",
+			want: map[uint]money.Points{2: money.FromFloat(100)},
+		},
+		{
+			name: "small order of a silver user before the campaigns",
+			order: orderdb.OrderAccrual{
+				UserID:     returning,
+				SumAccrual: money.FromFloat(100),
+				UploadedAt: weekend.AddDate(0, -2, 0),
+			},
+			tier: "silver",
+			want: map[uint]money.Points{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				bonuses, err := campaigns.Bonuses(tt.order, tt.tier)
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, bonusesOf(bonuses))
+			},
+		)
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"github.com/joho/godotenv"
 )
 
-var SecretKey string
+var (
+	SecretKey             string
+	AccrualCallbackSecret string
+)
 
 func LoadEnv() {
 	if err := godotenv.Load(); err != nil {
@@ -14,4 +17,5 @@ func LoadEnv() {
 	}
 
 	SecretKey = os.Getenv("SECRET_KEY")
+	AccrualCallbackSecret = os.Getenv("ACCRUAL_CALLBACK_SECRET")
 }
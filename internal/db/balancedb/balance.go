@@ -5,10 +5,15 @@ package balancedb
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // BalanceModel represents the model for managing balance and withdrawal data in the database.
@@ -25,47 +30,71 @@ func NewBalanceModel(db *gorm.DB) *BalanceModel {
 // BalanceRepository defines the interface for balance data operations. It abstracts
 // the methods to interact with user balances and withdrawals in the database.
 type BalanceRepository interface {
-	AddBalance(uuid.UUID, float64, float64) error
+	AddBalance(uuid.UUID, money.Points, money.Points) error
 	GetBalanceByUserID(uuid.UUID) (Balance, error)
-	UpdateBalance(uuid.UUID, float64, float64) error
 
-	AddWithdrawFunds(uuid.UUID, string, float64) error
+	Withdraw(uuid.UUID, string, money.Points) error
 	GetOrdersWithdrawFunds() ([]string, error)
 	GetWithdrawalByUserID(userID uuid.UUID) ([]Withdrawal, error)
+
+	CreditOrder(orderID string, bonuses ...Bonus) (bool, error)
+	GetLedgerBalance(uuid.UUID) (Balance, error)
+	Reconcile() ([]Discrepancy, error)
+
+	GetExpiredLotIDs(before time.Time) ([]uint, error)
+	ExpireLot(lotID uint) (money.Points, error)
+	GetExpiringPoints(userID uuid.UUID, before time.Time) (money.Points, error)
+
+	ReverseWithdrawal(order string, reason string) (Withdrawal, error)
+
+	AuthorizeHold(userID uuid.UUID, order string, amount money.Points, ttl time.Duration) (Hold, error)
+	CaptureHold(userID uuid.UUID, holdID uuid.UUID) (Withdrawal, error)
+	VoidHold(userID uuid.UUID, holdID uuid.UUID) (Hold, error)
+	GetExpiredHoldIDs(before time.Time) ([]uuid.UUID, error)
+	ExpireHold(holdID uuid.UUID) (bool, error)
+	GetHeldPoints(userID uuid.UUID) (money.Points, error)
+
+	Transfer(senderID uuid.UUID, recipientID uuid.UUID, amount money.Points, dailyLimit money.Points) (Transfer, error)
+
+	GetStatement(userID uuid.UUID, filter StatementFilter) ([]StatementLine, error)
+	Export(filter ExportFilter, fn func(ExportRow) error) error
+
+	GetDrifts() ([]Drift, error)
+	FixDrift(userID uuid.UUID) (*Drift, error)
+
+	GetTier(userID uuid.UUID) (UserTier, error)
+	GetTierChanges(userID uuid.UUID) ([]TierChange, error)
+	GetWindowAccruals(since time.Time) ([]WindowAccrual, error)
+	SetTier(userID uuid.UUID, tier string, accrual money.Points) (bool, error)
 }
 
 // ErrorDownloadingBalance and ErrorDownloadingWithdrawFunds represent errors
 // encountered during balance and withdrawal operations, respectively.
+// ErrorInsufficientFunds is returned when the balance does not cover a withdrawal.
+// ErrorHoldNotActive is returned when a hold has already been settled or has expired.
+// ErrorNotReversible is returned when a withdrawal cannot be reversed.
+// ErrorTransferLimitExceeded is returned when a transfer exceeds the daily limit.
+// ErrorOrderAlreadyWithdrawn is returned when points have already been
+// withdrawn for the order, by the same or another user.
 var (
 	ErrorDownloadingBalance       = errors.New("balance cannot be created")
 	ErrorDownloadingWithdrawFunds = errors.New("WithdrawFunds cannot be created")
+	ErrorInsufficientFunds        = errors.New("insufficient funds")
+	ErrorHoldNotActive            = errors.New("hold is not active")
+	ErrorNotReversible            = errors.New("withdrawal cannot be reversed")
+	ErrorTransferLimitExceeded    = errors.New("daily transfer limit exceeded")
+	ErrorOrderAlreadyWithdrawn    = errors.New("points have already been withdrawn for the order")
 )
 
-// UpdateBalance updates the balance record in the database for a specific user.
-// userID: Unique identifier of the user.
-// current: Updated current balance to be set.
-// withdrawn: Updated withdrawn amount to be set.
-// Returns an error if the update operation fails.
-func (balanceDB *BalanceModel) UpdateBalance(userID uuid.UUID, current, withdrawn float64) error {
-	updateResult := balanceDB.DB.Table(config.TableBalance).Where("user_id = ?", userID).
-		Updates(
-			map[string]interface{}{
-				"current":   current,
-				"withdrawn": withdrawn,
-			},
-		)
-	if updateResult.Error != nil {
-		return updateResult.Error
-	}
-	return nil
-}
+// uniqueViolation is the SQLSTATE of a unique constraint violation.
+const uniqueViolation = "23505"
 
 // AddBalance adds a new balance entry to the database for the specified user.
 // Returns an error if the balance cannot be created.
 func (balanceDB *BalanceModel) AddBalance(
 	userID uuid.UUID,
-	current float64,
-	withdrawn float64,
+	current money.Points,
+	withdrawn money.Points,
 ) error {
 	result := balanceDB.DB.Create(
 		&Balance{
@@ -91,29 +120,197 @@ func (balanceDB *BalanceModel) GetBalanceByUserID(userID uuid.UUID) (Balance, er
 	return balance, nil
 }
 
-// AddWithdrawFunds adds a withdrawal record to the database for a specific order.
+// Withdraw withdraws funds from the user's balance for a specific order.
+// In a single transaction it decrements the balance only if the points which
+// are not held cover the sum, consumes the lots which expire first, records
+// the withdrawal and writes a ledger entry referencing the order, so
+// concurrent withdrawals can never overdraw the balance. Points are withdrawn
+// at most once per order, so the order identifies the withdrawal.
 // userID: Unique identifier of the user.
 // order: Identifier of the order for which the withdrawal is made.
 // sum: Amount of funds to be withdrawn.
-// Returns an error if the operation fails.
-func (balanceDB *BalanceModel) AddWithdrawFunds(
+// Returns ErrorInsufficientFunds if the balance does not cover the sum,
+// ErrorOrderAlreadyWithdrawn if points have already been withdrawn for
+// the order, gorm.ErrRecordNotFound if the user has no balance, or an error
+// if the operation fails.
+func (balanceDB *BalanceModel) Withdraw(
 	userID uuid.UUID,
 	order string,
-	sum float64,
+	sum money.Points,
 ) error {
-	result := balanceDB.DB.Table(config.TableWithdrawal).Create(
-		&Withdrawal{
-			UserID: userID,
-			Order:  order,
-			Sum:    sum,
+	return balanceDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			_, err := withdraw(tx, userID, order, sum)
+			return err
+		},
+	)
+}
+
+// withdraw withdraws sum from the user's balance for the order within
+// the transaction tx. See Withdraw.
+func withdraw(tx *gorm.DB, userID uuid.UUID, order string, sum money.Points) (Withdrawal, error) {
+	if err := orderNotWithdrawn(tx, order); err != nil {
+		return Withdrawal{}, err
+	}
+
+	result := tx.Table(config.TableBalance).
+		Where("user_id = ? AND current - held >= ?", userID, sum).
+		Updates(
+			map[string]interface{}{
+				"current":    gorm.Expr("current - ?", sum),
+				"withdrawn":  gorm.Expr("withdrawn + ?", sum),
+				"updated_at": time.Now(),
+			},
+		)
+	if result.Error != nil {
+		return Withdrawal{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Withdrawal{}, insufficientFunds(tx, userID)
+	}
+
+	if _, err := consumeLots(tx, userID, LedgerWithdrawal, order, sum); err != nil {
+		return Withdrawal{}, err
+	}
+
+	result = tx.Create(
+		&LedgerEntry{
+			UserID:        userID,
+			Kind:          LedgerWithdrawal,
+			Reference:     order,
+			Amount:        -sum,
+			ContraAccount: AccountWithdrawals,
 		},
 	)
+	if isUniqueViolation(result.Error) {
+		// A concurrent withdrawal for the same order has won the race.
+		return Withdrawal{}, ErrorOrderAlreadyWithdrawn
+	}
+	if result.Error != nil {
+		return Withdrawal{}, fmt.Errorf("%w: %v", ErrorDownloadingWithdrawFunds, result.Error)
+	}
+
+	withdrawal := Withdrawal{
+		UserID: userID,
+		Order:  order,
+		Sum:    sum,
+		Status: WithdrawalCompleted,
+	}
+	result = tx.Table(config.TableWithdrawal).Create(&withdrawal)
 	if result.Error != nil {
-		return fmt.Errorf("%w: %v", ErrorDownloadingWithdrawFunds, result.Error)
+		return Withdrawal{}, fmt.Errorf("%w: %v", ErrorDownloadingWithdrawFunds, result.Error)
+	}
+	return withdrawal, nil
+}
+
+// orderNotWithdrawn returns ErrorOrderAlreadyWithdrawn within the transaction
+// tx if points have already been withdrawn for the order.
+func orderNotWithdrawn(tx *gorm.DB, order string) error {
+	var withdrawals int64
+	err := tx.Model(&Withdrawal{}).Unscoped().Where(&Withdrawal{Order: order}).Count(&withdrawals).Error
+	if err != nil {
+		return err
+	}
+	if withdrawals > 0 {
+		return ErrorOrderAlreadyWithdrawn
 	}
 	return nil
 }
 
+// isUniqueViolation reports whether err is a violation of a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+// insufficientFunds explains within the transaction tx why the user's balance
+// could not be decremented: returns gorm.ErrRecordNotFound if the user has no
+// balance and ErrorInsufficientFunds otherwise.
+func insufficientFunds(tx *gorm.DB, userID uuid.UUID) error {
+	var balances int64
+	err := tx.Table(config.TableBalance).Where("user_id = ?", userID).Count(&balances).Error
+	if err != nil {
+		return err
+	}
+	if balances == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return ErrorInsufficientFunds
+}
+
+// ReverseWithdrawal reverses the withdrawal made for a specific order, e.g.
+// when the purchase it paid for is cancelled. In a single transaction it writes
+// a reversal ledger entry referencing the order, returns the points to the
+// balance and to the lots they were taken from, and marks the withdrawal
+// reversed with the reason. Reversing a withdrawal again is a no-op. Points
+// are withdrawn at most once per order, so the order identifies the withdrawal.
+// Transfers cannot be reversed.
+// Returns the withdrawal, gorm.ErrRecordNotFound if there is no withdrawal
+// for the order, or ErrorNotReversible if the withdrawal is a transfer.
+func (balanceDB *BalanceModel) ReverseWithdrawal(order string, reason string) (Withdrawal, error) {
+	var withdrawal Withdrawal
+	err := balanceDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where(&Withdrawal{Order: order}).
+				Take(&withdrawal)
+			if result.Error != nil {
+				return result.Error
+			}
+			if withdrawal.Status == WithdrawalReversed {
+				return nil
+			}
+			if strings.HasPrefix(withdrawal.Order, config.TransferReferencePrefix) {
+				return ErrorNotReversible
+			}
+
+			result = tx.Create(
+				&LedgerEntry{
+					UserID:        withdrawal.UserID,
+					Kind:          LedgerReversal,
+					Reference:     order,
+					Amount:        withdrawal.Sum,
+					ContraAccount: AccountWithdrawals,
+				},
+			)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			result = tx.Table(config.TableBalance).Where("user_id = ?", withdrawal.UserID).Updates(
+				map[string]interface{}{
+					"current":    gorm.Expr("current + ?", withdrawal.Sum),
+					"withdrawn":  gorm.Expr("withdrawn - ?", withdrawal.Sum),
+					"updated_at": time.Now(),
+				},
+			)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			if err := restoreLots(tx, LedgerWithdrawal, order, LedgerReversal); err != nil {
+				return err
+			}
+
+			now := time.Now()
+			withdrawal.Status = WithdrawalReversed
+			withdrawal.ReversalReason = reason
+			withdrawal.ReversedAt = &now
+			return tx.Model(&withdrawal).Updates(
+				map[string]interface{}{
+					"status":          withdrawal.Status,
+					"reversal_reason": withdrawal.ReversalReason,
+					"reversed_at":     withdrawal.ReversedAt,
+				},
+			).Error
+		},
+	)
+	if err != nil {
+		return Withdrawal{}, err
+	}
+	return withdrawal, nil
+}
+
 // GetOrdersWithdrawFunds retrieves a list of order IDs for which funds have been withdrawn.
 // Returns a slice of order IDs and an error if retrieval fails.
 func (balanceDB *BalanceModel) GetOrdersWithdrawFunds() ([]string, error) {
@@ -135,7 +332,7 @@ func (balanceDB *BalanceModel) GetOrdersWithdrawFunds() ([]string, error) {
 // Returns a slice of Withdrawal objects and an error if retrieval fails.
 func (balanceDB *BalanceModel) GetWithdrawalByUserID(userID uuid.UUID) ([]Withdrawal, error) {
 	var withdrawals []Withdrawal
-	result := balanceDB.DB.Order("updated_at desc").Where(&Withdrawal{UserID: userID}).Find(&withdrawals)
+	result := balanceDB.DB.Order("created_at desc").Where(&Withdrawal{UserID: userID}).Find(&withdrawals)
 	if result.Error != nil {
 		return withdrawals, result.Error
 	}
@@ -0,0 +1,679 @@
+package balancedb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/internal/db/dbtest"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// openTestDB connects to the test database and migrates the balance models.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return dbtest.Open(
+		t,
+		&Balance{},
+		&Withdrawal{},
+		&LedgerEntry{},
+		&PointLot{},
+		&PointLotUsage{},
+		&Hold{},
+		&Transfer{},
+		&UserTier{},
+		&TierChange{},
+	)
+}
+
+func TestBalanceModel_Withdraw_Concurrent(t *testing.T) {
+	db := openTestDB(t)
+	model := NewBalanceModel(db)
+
+	const (
+		initial     = money.Points(1000 * money.Scale)
+		sum         = money.Points(10 * money.Scale)
+		withdrawals = 300
+	)
+	userID := uuid.New()
+	require.NoError(t, model.AddBalance(userID, initial, 0))
+	t.Cleanup(
+		func() {
+			db.Unscoped().Where("user_id = ?", userID).Delete(&Balance{})
+			db.Unscoped().Where("user_id = ?", userID).Delete(&Withdrawal{})
+			db.Where("user_id = ?", userID).Delete(&LedgerEntry{})
+			db.Where("user_id = ?", userID).Delete(&PointLot{})
+		},
+	)
+
+	var succeeded, insufficient int64
+	var wg sync.WaitGroup
+	for i := 0; i < withdrawals; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := model.Withdraw(userID, fmt.Sprintf("%s-%d", userID, i), sum)
+			switch {
+			case err == nil:
+				atomic.AddInt64(&succeeded, 1)
+			case errors.Is(err, ErrorInsufficientFunds):
+				atomic.AddInt64(&insufficient, 1)
+			default:
+				t.Errorf("Withdraw() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(initial/sum), succeeded)
+	assert.Equal(t, int64(withdrawals-initial/sum), insufficient)
+
+	balance, err := model.GetBalanceByUserID(userID)
+	require.NoError(t, err)
+	assert.Equal(t, money.Points(0), balance.Current)
+	assert.Equal(t, initial, balance.Withdrawn)
+
+	err = db.Table(config.TableBalance).
+		Where("user_id = ?", userID).
+		Update("current", -1).Error
+	assert.Error(t, err, "check constraint keeps the balance non-negative")
+}
+
+func TestBalanceModel_BackfillLedger(t *testing.T) {
+	db := openTestDB(t)
+	model := NewBalanceModel(db)
+
+	userID, driftedID := uuid.New(), uuid.New()
+	require.NoError(t, model.AddBalance(userID, money.FromFloat(70), money.FromFloat(30)))
+	require.NoError(t, model.AddBalance(driftedID, money.FromFloat(50), 0))
+	require.NoError(
+		t, db.Create(
+			&LedgerEntry{
+				UserID:        driftedID,
+				Kind:          LedgerAdjustment,
+				Reference:     driftedID.String(),
+				Amount:        money.FromFloat(40),
+				ContraAccount: AccountAdjustments,
+			},
+		).Error,
+	)
+	t.Cleanup(
+		func() {
+			for _, id := range []uuid.UUID{userID, driftedID} {
+				db.Unscoped().Where("user_id = ?", id).Delete(&Balance{})
+				db.Where("user_id = ?", id).Delete(&LedgerEntry{})
+			}
+		},
+	)
+
+	hasDiscrepancy := func(id uuid.UUID) bool {
+		discrepancies, err := model.Reconcile()
+		require.NoError(t, err)
+		for _, d := range discrepancies {
+			if d.UserID == id {
+				return true
+			}
+		}
+		return false
+	}
+	assert.True(t, hasDiscrepancy(userID))
+	assert.True(t, hasDiscrepancy(driftedID))
+
+	require.NoError(t, model.BackfillLedger())
+	require.NoError(t, model.BackfillLedger())
+	assert.False(t, hasDiscrepancy(userID))
+	assert.True(t, hasDiscrepancy(driftedID), "drift of a user with ledger entries is left for reconcile")
+
+	balance, err := model.GetLedgerBalance(userID)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(70), balance.Current)
+	assert.Equal(t, money.FromFloat(30), balance.Withdrawn)
+
+	drifted, err := model.GetLedgerBalance(driftedID)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(40), drifted.Current)
+}
+
+func TestBalanceModel_Lots(t *testing.T) {
+	db := openTestDB(t)
+	model := NewBalanceModel(db)
+
+	userID := uuid.New()
+	require.NoError(t, model.AddBalance(userID, money.FromFloat(100), 0))
+	now := time.Now()
+	lots := []PointLot{
+		{Reference: "late", Amount: money.FromFloat(60), ExpiresAt: now.Add(time.Hour)},
+		{Reference: "early", Amount: money.FromFloat(40), ExpiresAt: now.Add(-time.Hour)},
+	}
+	for i := range lots {
+		lots[i].UserID = userID
+		lots[i].Kind = LedgerAccrual
+		lots[i].Reference += userID.String()
+		lots[i].Remaining = lots[i].Amount
+		lots[i].EarnedAt = now
+		require.NoError(t, db.Create(&lots[i]).Error)
+	}
+	t.Cleanup(
+		func() {
+			db.Unscoped().Where("user_id = ?", userID).Delete(&Balance{})
+			db.Unscoped().Where("user_id = ?", userID).Delete(&Withdrawal{})
+			db.Where("user_id = ?", userID).Delete(&LedgerEntry{})
+			db.Where("lot_id IN ?", []uint{lots[0].ID, lots[1].ID}).Delete(&PointLotUsage{})
+			db.Where("user_id = ?", userID).Delete(&PointLot{})
+		},
+	)
+
+	require.NoError(t, model.Withdraw(userID, "withdraw-"+userID.String(), money.FromFloat(30)))
+	require.NoError(t, db.Find(&lots, []uint{lots[0].ID, lots[1].ID}).Error)
+	remaining := map[uint]money.Points{lots[0].ID: lots[0].Remaining, lots[1].ID: lots[1].Remaining}
+	assert.Equal(t, money.FromFloat(10), remaining[lots[1].ID], "the lot expiring first is consumed first")
+	assert.Equal(t, money.FromFloat(60), remaining[lots[0].ID])
+
+	expiring, err := model.GetExpiringPoints(userID, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(70), expiring)
+
+	expired, err := model.ExpireLot(lots[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(10), expired)
+	expired, err = model.ExpireLot(lots[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, money.Points(0), expired)
+
+	balance, err := model.GetBalanceByUserID(userID)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(60), balance.Current)
+}
+
+func TestBalanceModel_ReverseWithdrawal(t *testing.T) {
+	db := openTestDB(t)
+	model := NewBalanceModel(db)
+
+	userID := uuid.New()
+	order := "reverse-" + userID.String()
+	require.NoError(t, model.AddBalance(userID, 0, 0))
+	require.NoError(t, db.Create(
+		&PointLot{
+			UserID:    userID,
+			Kind:      LedgerAdjustment,
+			Reference: userID.String(),
+			Amount:    money.FromFloat(50),
+			Remaining: money.FromFloat(50),
+			EarnedAt:  time.Now(),
+			ExpiresAt: time.Now().Add(time.Hour),
+		},
+	).Error)
+	require.NoError(t, db.Table(config.TableBalance).Where("user_id = ?", userID).
+		Update("current", money.FromFloat(50)).Error)
+	require.NoError(t, db.Create(
+		&LedgerEntry{
+			UserID:        userID,
+			Kind:          LedgerAdjustment,
+			Reference:     userID.String(),
+			Amount:        money.FromFloat(50),
+			ContraAccount: AccountAdjustments,
+		},
+	).Error)
+	t.Cleanup(
+		func() {
+			var lot PointLot
+			db.Where("user_id = ?", userID).Take(&lot)
+			db.Where("lot_id = ?", lot.ID).Delete(&PointLotUsage{})
+			db.Unscoped().Where("user_id = ?", userID).Delete(&Balance{})
+			db.Unscoped().Where("user_id = ?", userID).Delete(&Withdrawal{})
+			db.Where("user_id = ?", userID).Delete(&LedgerEntry{})
+			db.Where("user_id = ?", userID).Delete(&PointLot{})
+		},
+	)
+
+	_, err := model.ReverseWithdrawal(order, "order cancelled")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	require.NoError(t, model.Withdraw(userID, order, money.FromFloat(20)))
+	for i := 0; i < 2; i++ {
+		withdrawal, err := model.ReverseWithdrawal(order, "order cancelled")
+		require.NoError(t, err)
+		assert.Equal(t, WithdrawalReversed, withdrawal.Status)
+		assert.Equal(t, "order cancelled", withdrawal.ReversalReason)
+	}
+
+	balance, err := model.GetBalanceByUserID(userID)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(50), balance.Current)
+	assert.Equal(t, money.Points(0), balance.Withdrawn)
+
+	ledger, err := model.GetLedgerBalance(userID)
+	require.NoError(t, err)
+	assert.Equal(t, balance.Current, ledger.Current)
+	assert.Equal(t, balance.Withdrawn, ledger.Withdrawn)
+
+	var lot PointLot
+	require.NoError(t, db.Where("user_id = ?", userID).Take(&lot).Error)
+	assert.Equal(t, money.FromFloat(50), lot.Remaining, "reversed points return to their lot")
+}
+
+func TestBalanceModel_Holds(t *testing.T) {
+	db := openTestDB(t)
+	model := NewBalanceModel(db)
+
+	userID := uuid.New()
+	require.NoError(t, model.AddBalance(userID, money.FromFloat(100), 0))
+	t.Cleanup(
+		func() {
+			db.Unscoped().Where("user_id = ?", userID).Delete(&Balance{})
+			db.Unscoped().Where("user_id = ?", userID).Delete(&Withdrawal{})
+			db.Where("user_id = ?", userID).Delete(&LedgerEntry{})
+			db.Where("user_id = ?", userID).Delete(&Hold{})
+		},
+	)
+
+	hold, err := model.AuthorizeHold(userID, "hold-"+userID.String(), money.FromFloat(80), time.Minute)
+	require.NoError(t, err)
+	_, err = model.AuthorizeHold(userID, "other-"+userID.String(), money.FromFloat(30), time.Minute)
+	assert.ErrorIs(t, err, ErrorInsufficientFunds)
+	assert.ErrorIs(t, model.Withdraw(userID, "other-"+userID.String(), money.FromFloat(30)), ErrorInsufficientFunds)
+
+	held, err := model.GetHeldPoints(userID)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(80), held)
+
+	for i := 0; i < 2; i++ {
+		withdrawal, err := model.CaptureHold(userID, hold.ID)
+		require.NoError(t, err)
+		assert.Equal(t, money.FromFloat(80), withdrawal.Sum)
+	}
+	_, err = model.VoidHold(userID, hold.ID)
+	assert.ErrorIs(t, err, ErrorHoldNotActive)
+
+	expiring, err := model.AuthorizeHold(userID, "expiring-"+userID.String(), money.FromFloat(20), -time.Minute)
+	require.NoError(t, err)
+	_, err = model.CaptureHold(userID, expiring.ID)
+	assert.ErrorIs(t, err, ErrorHoldNotActive)
+	expired, err := model.ExpireHold(expiring.ID)
+	require.NoError(t, err)
+	assert.True(t, expired)
+
+	balance, err := model.GetBalanceByUserID(userID)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(20), balance.Current)
+	assert.Equal(t, money.FromFloat(80), balance.Withdrawn)
+	assert.Equal(t, money.Points(0), balance.Held)
+}
+
+func TestBalanceModel_ExpireLot_Held(t *testing.T) {
+	db := openTestDB(t)
+	model := NewBalanceModel(db)
+
+	userID := uuid.New()
+	require.NoError(t, model.AddBalance(userID, 0, 0))
+	lot := PointLot{
+		UserID:    userID,
+		Kind:      LedgerAdjustment,
+		Reference: userID.String(),
+		Amount:    money.FromFloat(100),
+		Remaining: money.FromFloat(100),
+		EarnedAt:  time.Now().Add(-2 * time.Hour),
+		ExpiresAt: time.Now().Add(-time.Hour),
+	}
+	require.NoError(t, db.Create(&lot).Error)
+	require.NoError(t, db.Table(config.TableBalance).Where("user_id = ?", userID).
+		Update("current", money.FromFloat(100)).Error)
+	require.NoError(t, db.Create(
+		&LedgerEntry{
+			UserID:        userID,
+			Kind:          LedgerAdjustment,
+			Reference:     userID.String(),
+			Amount:        money.FromFloat(100),
+			ContraAccount: AccountAdjustments,
+		},
+	).Error)
+	t.Cleanup(
+		func() {
+			db.Where("lot_id = ?", lot.ID).Delete(&PointLotUsage{})
+			db.Unscoped().Where("user_id = ?", userID).Delete(&Balance{})
+			db.Unscoped().Where("user_id = ?", userID).Delete(&Withdrawal{})
+			db.Where("user_id = ?", userID).Delete(&LedgerEntry{})
+			db.Where("user_id = ?", userID).Delete(&Hold{})
+			db.Where("user_id = ?", userID).Delete(&PointLot{})
+		},
+	)
+
+	captured, err := model.AuthorizeHold(userID, "captured-"+userID.String(), money.FromFloat(50), time.Minute)
+	require.NoError(t, err)
+	voided, err := model.AuthorizeHold(userID, "voided-"+userID.String(), money.FromFloat(30), time.Minute)
+	require.NoError(t, err)
+
+	expired, err := model.ExpireLot(lot.ID)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(20), expired, "held points do not expire")
+	expired, err = model.ExpireLot(lot.ID)
+	require.NoError(t, err)
+	assert.Equal(t, money.Points(0), expired)
+
+	_, err = model.CaptureHold(userID, captured.ID)
+	require.NoError(t, err)
+	_, err = model.VoidHold(userID, voided.ID)
+	require.NoError(t, err)
+	expired, err = model.ExpireLot(lot.ID)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(30), expired, "released points expire with the next run")
+
+	balance, err := model.GetBalanceByUserID(userID)
+	require.NoError(t, err)
+	assert.Equal(t, money.Points(0), balance.Current)
+	assert.Equal(t, money.FromFloat(50), balance.Withdrawn)
+	assert.Equal(t, money.Points(0), balance.Held)
+
+	ledger, err := model.GetLedgerBalance(userID)
+	require.NoError(t, err)
+	assert.Equal(t, balance.Current, ledger.Current)
+
+	require.NoError(t, db.Take(&lot, lot.ID).Error)
+	assert.Equal(t, money.Points(0), lot.Remaining)
+}
+
+func TestBalanceModel_Transfer(t *testing.T) {
+	db := openTestDB(t)
+	model := NewBalanceModel(db)
+
+	senderID, recipientID := uuid.New(), uuid.New()
+	require.NoError(t, model.AddBalance(senderID, money.FromFloat(100), 0))
+	earned := time.Now().AddDate(0, -6, 0).Truncate(time.Second)
+	lots := []PointLot{
+		{Reference: "soon", Amount: money.FromFloat(20), ExpiresAt: earned.AddDate(0, 7, 0)},
+		{Reference: "late", Amount: money.FromFloat(80), ExpiresAt: earned.AddDate(0, 12, 0)},
+	}
+	for i := range lots {
+		lots[i].UserID = senderID
+		lots[i].Kind = LedgerAccrual
+		lots[i].Reference += senderID.String()
+		lots[i].Remaining = lots[i].Amount
+		lots[i].EarnedAt = earned
+		require.NoError(t, db.Create(&lots[i]).Error)
+	}
+	t.Cleanup(
+		func() {
+			db.Where("lot_id IN ?", []uint{lots[0].ID, lots[1].ID}).Delete(&PointLotUsage{})
+			for _, userID := range []uuid.UUID{senderID, recipientID} {
+				db.Unscoped().Where("user_id = ?", userID).Delete(&Balance{})
+				db.Unscoped().Where("user_id = ?", userID).Delete(&Withdrawal{})
+				db.Where("user_id = ?", userID).Delete(&LedgerEntry{})
+				db.Where("user_id = ?", userID).Delete(&PointLot{})
+			}
+			db.Where("sender_id = ?", senderID).Delete(&Transfer{})
+		},
+	)
+
+	transfer, err := model.Transfer(senderID, recipientID, money.FromFloat(30), money.FromFloat(50))
+	require.NoError(t, err)
+	_, err = model.Transfer(senderID, recipientID, money.FromFloat(30), money.FromFloat(50))
+	assert.ErrorIs(t, err, ErrorTransferLimitExceeded)
+	_, err = model.Transfer(senderID, recipientID, money.FromFloat(80), money.FromFloat(500))
+	assert.ErrorIs(t, err, ErrorInsufficientFunds)
+
+	sender, err := model.GetBalanceByUserID(senderID)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(70), sender.Current)
+	assert.Equal(t, money.FromFloat(30), sender.Withdrawn)
+	recipient, err := model.GetBalanceByUserID(recipientID)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(30), recipient.Current)
+
+	withdrawals, err := model.GetWithdrawalByUserID(senderID)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, transfer.Reference, withdrawals[0].Order)
+	_, err = model.ReverseWithdrawal(transfer.Reference, "gift returned")
+	assert.ErrorIs(t, err, ErrorNotReversible)
+
+	var gifted []PointLot
+	require.NoError(t, db.Where("user_id = ?", recipientID).Order("expires_at").Find(&gifted).Error)
+	require.Len(t, gifted, 2, "gifted points keep the expiry of their lots")
+	for i, want := range []PointLot{
+		{Amount: money.FromFloat(20), ExpiresAt: lots[0].ExpiresAt},
+		{Amount: money.FromFloat(10), ExpiresAt: lots[1].ExpiresAt},
+	} {
+		assert.Equal(t, LedgerTransferIn, gifted[i].Kind)
+		assert.Equal(t, want.Amount, gifted[i].Remaining)
+		assert.WithinDuration(t, earned, gifted[i].EarnedAt, time.Second)
+		assert.WithinDuration(t, want.ExpiresAt, gifted[i].ExpiresAt, time.Second)
+	}
+
+	lines, err := model.GetStatement(recipientID, StatementFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, lines, 1, "the recipient sees the transfer in the statement")
+	assert.Equal(t, LedgerTransferIn, lines[0].Kind)
+	assert.Equal(t, transfer.Reference, lines[0].Reference)
+	assert.Equal(t, money.FromFloat(30), lines[0].Amount)
+}
+
+func TestBalanceModel_GetStatement(t *testing.T) {
+	db := openTestDB(t)
+	model := NewBalanceModel(db)
+
+	userID := uuid.New()
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, db.Create(
+			&LedgerEntry{
+				UserID:        userID,
+				Kind:          LedgerAdjustment,
+				Reference:     fmt.Sprintf("%s-%d", userID, i),
+				Amount:        money.FromFloat(float64(i)),
+				ContraAccount: AccountAdjustments,
+			},
+		).Error)
+	}
+	t.Cleanup(
+		func() {
+			db.Where("user_id = ?", userID).Delete(&LedgerEntry{})
+		},
+	)
+
+	lines, err := model.GetStatement(userID, StatementFilter{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	assert.Equal(t, money.FromFloat(3), lines[1].Balance)
+
+	lines, err = model.GetStatement(userID, StatementFilter{After: lines[1].ID, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, lines, 1)
+	assert.Equal(t, money.FromFloat(6), lines[0].Balance)
+
+	lines, err = model.GetStatement(userID, StatementFilter{From: time.Now().Add(time.Hour), Limit: 2})
+	require.NoError(t, err)
+	assert.Empty(t, lines)
+}
+
+func TestBalanceModel_Export(t *testing.T) {
+	db := openTestDB(t)
+	model := NewBalanceModel(db)
+
+	userID := uuid.New()
+	for i := 1; i <= 2; i++ {
+		require.NoError(t, db.Create(
+			&LedgerEntry{
+				UserID:        userID,
+				Kind:          LedgerAdjustment,
+				Reference:     fmt.Sprintf("%s-%d", userID, i),
+				Amount:        money.FromFloat(5),
+				ContraAccount: AccountAdjustments,
+			},
+		).Error)
+	}
+	t.Cleanup(
+		func() {
+			db.Where("user_id = ?", userID).Delete(&LedgerEntry{})
+		},
+	)
+
+	var rows []ExportRow
+	err := model.Export(
+		ExportFilter{UserID: userID}, func(row ExportRow) error {
+			rows = append(rows, row)
+			return nil
+		},
+	)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, LedgerAdjustment, rows[1].Type)
+	require.NotNil(t, rows[1].Balance)
+	assert.Equal(t, money.FromFloat(10), *rows[1].Balance)
+
+	stop := errors.New("stop")
+	err = model.Export(
+		ExportFilter{UserID: userID}, func(row ExportRow) error {
+			return stop
+		},
+	)
+	assert.ErrorIs(t, err, stop)
+}
+
+func TestBalanceModel_FixDrift(t *testing.T) {
+	db := openTestDB(t)
+	model := NewBalanceModel(db)
+
+	userID := uuid.New()
+	require.NoError(t, model.AddBalance(userID, money.FromFloat(15), money.FromFloat(5)))
+	t.Cleanup(
+		func() {
+			db.Unscoped().Where("user_id = ?", userID).Delete(&Balance{})
+			db.Where("user_id = ?", userID).Delete(&LedgerEntry{})
+			db.Where("user_id = ?", userID).Delete(&PointLot{})
+		},
+	)
+
+	findDrift := func() *Drift {
+		drifts, err := model.GetDrifts()
+		require.NoError(t, err)
+		for _, d := range drifts {
+			if d.UserID == userID {
+				return &d
+			}
+		}
+		return nil
+	}
+	drift := findDrift()
+	require.NotNil(t, drift)
+	assert.Equal(t, money.Points(0), drift.ExpectedCurrent)
+	assert.Equal(t, money.Points(0), drift.ExpectedWithdrawn)
+
+	fixed, err := model.FixDrift(userID)
+	require.NoError(t, err)
+	require.NotNil(t, fixed)
+	assert.Nil(t, findDrift())
+	fixed, err = model.FixDrift(userID)
+	require.NoError(t, err)
+	assert.Nil(t, fixed)
+
+	balance, err := model.GetBalanceByUserID(userID)
+	require.NoError(t, err)
+	assert.Equal(t, money.Points(0), balance.Current)
+	assert.Equal(t, money.Points(0), balance.Withdrawn)
+}
+
+func TestBalanceModel_SetTier(t *testing.T) {
+	db := openTestDB(t)
+	model := NewBalanceModel(db)
+
+	userID := uuid.New()
+	require.NoError(
+		t, db.Create(
+			&LedgerEntry{
+				UserID:        userID,
+				Kind:          LedgerAccrual,
+				Reference:     userID.String(),
+				Amount:        money.FromFloat(1200),
+				ContraAccount: AccountIssuance,
+			},
+		).Error,
+	)
+	t.Cleanup(
+		func() {
+			db.Where("user_id = ?", userID).Delete(&LedgerEntry{})
+			db.Where("user_id = ?", userID).Delete(&UserTier{})
+			db.Where("user_id = ?", userID).Delete(&TierChange{})
+		},
+	)
+
+	_, err := model.GetTier(userID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	accruals, err := model.GetWindowAccruals(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Contains(t, accruals, WindowAccrual{UserID: userID, Accrual: money.FromFloat(1200)})
+
+	changed, err := model.SetTier(userID, "silver", money.FromFloat(1200))
+	require.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = model.SetTier(userID, "silver", money.FromFloat(1200))
+	require.NoError(t, err)
+	assert.False(t, changed)
+	changed, err = model.SetTier(userID, "bronze", 0)
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	tier, err := model.GetTier(userID)
+	require.NoError(t, err)
+	assert.Equal(t, "bronze", tier.Tier)
+
+	changes, err := model.GetTierChanges(userID)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "silver", changes[0].OldTier)
+	assert.Equal(t, "bronze", changes[0].NewTier)
+	assert.Equal(t, "", changes[1].OldTier)
+}
+
+func TestBalanceModel_Withdraw_SameOrder(t *testing.T) {
+	db := openTestDB(t)
+	model := NewBalanceModel(db)
+
+	userID, otherID := uuid.New(), uuid.New()
+	order := "same-" + userID.String()
+	require.NoError(t, model.AddBalance(userID, money.FromFloat(100), 0))
+	require.NoError(t, model.AddBalance(otherID, money.FromFloat(100), 0))
+	t.Cleanup(
+		func() {
+			for _, id := range []uuid.UUID{userID, otherID} {
+				db.Unscoped().Where("user_id = ?", id).Delete(&Balance{})
+				db.Unscoped().Where("user_id = ?", id).Delete(&Withdrawal{})
+				db.Where("user_id = ?", id).Delete(&LedgerEntry{})
+				db.Where("user_id = ?", id).Delete(&Hold{})
+			}
+		},
+	)
+
+	require.NoError(t, model.Withdraw(userID, order, money.FromFloat(10)))
+	assert.ErrorIs(t, model.Withdraw(userID, order, money.FromFloat(10)), ErrorOrderAlreadyWithdrawn)
+	assert.ErrorIs(t, model.Withdraw(otherID, order, money.FromFloat(10)), ErrorOrderAlreadyWithdrawn)
+	_, err := model.AuthorizeHold(otherID, order, money.FromFloat(10), time.Minute)
+	assert.ErrorIs(t, err, ErrorOrderAlreadyWithdrawn)
+
+	_, err = model.ReverseWithdrawal(order, "order cancelled")
+	require.NoError(t, err)
+	assert.ErrorIs(t, model.Withdraw(userID, order, money.FromFloat(10)), ErrorOrderAlreadyWithdrawn)
+
+	held := "held-" + userID.String()
+	first, err := model.AuthorizeHold(userID, held, money.FromFloat(10), time.Minute)
+	require.NoError(t, err)
+	second, err := model.AuthorizeHold(otherID, held, money.FromFloat(10), time.Minute)
+	require.NoError(t, err)
+	_, err = model.CaptureHold(userID, first.ID)
+	require.NoError(t, err)
+	_, err = model.CaptureHold(otherID, second.ID)
+	assert.ErrorIs(t, err, ErrorOrderAlreadyWithdrawn)
+
+	other, err := model.GetBalanceByUserID(otherID)
+	require.NoError(t, err)
+	assert.Equal(t, money.FromFloat(100), other.Current)
+	assert.Equal(t, money.Points(0), other.Withdrawn)
+	assert.Equal(t, money.FromFloat(10), other.Held, "a failed capture leaves the hold active")
+}
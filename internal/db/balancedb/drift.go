@@ -0,0 +1,200 @@
+package balancedb
+
+import (
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// reconcileReference is the prefix of the references of the entries which
+// correct drifted balances.
+const reconcileReference = "reconcile:"
+
+// Drift describes a user whose stored balance differs from the balance
+// recomputed from the source data.
+type Drift struct {
+	UserID            uuid.UUID    `json:"user_id" gorm:"column:user_id"`
+	Current           money.Points `json:"current" gorm:"column:current"`
+	Withdrawn         money.Points `json:"withdrawn" gorm:"column:withdrawn"`
+	ExpectedCurrent   money.Points `json:"expected_current" gorm:"column:expected_current"`
+	ExpectedWithdrawn money.Points `json:"expected_withdrawn" gorm:"column:expected_withdrawn"`
+}
+
+// bonusKinds are the kinds of the ledger entries of the bonuses credited
+// together with the accruals of orders.
+var bonusKinds = []string{LedgerTierBonus, LedgerCampaignBonus}
+
+// driftQuery recomputes the balances from the source data and selects the ones
+// differing from the stored balances. The expected withdrawn points are the
+// sum of the completed withdrawals, transfers to other users included.
+// The expected current points are the credited accruals of the processed
+// orders, the bonuses credited with them and the points received from other
+// users, less the withdrawn and the expired points. The bonuses have no source
+// other than their ledger entries. The @user condition is appended by
+// the caller.
+const driftQuery = `
+WITH accruals AS (
+    SELECT user_id, SUM(accrual) AS amount FROM ` + config.TableOrder + `
+    WHERE deleted_at IS NULL AND status = @processed AND credited
+    GROUP BY user_id
+), withdrawals AS (
+    SELECT user_id, SUM("sum") AS amount FROM ` + config.TableWithdrawal + `
+    WHERE deleted_at IS NULL AND status = @completed
+    GROUP BY user_id
+), bonuses AS (
+    SELECT user_id, SUM(amount) AS amount FROM ledger_entries
+    WHERE kind IN @bonuses
+    GROUP BY user_id
+), received AS (
+    SELECT recipient_id AS user_id, SUM(amount) AS amount FROM transfers
+    GROUP BY recipient_id
+), expired AS (
+    SELECT l.user_id, SUM(u.amount) AS amount FROM point_lot_usages u
+    JOIN point_lots l ON l.id = u.lot_id
+    WHERE u.kind = @expiry
+    GROUP BY l.user_id
+), stored AS (
+    SELECT user_id, SUM(current) AS current, SUM(withdrawn) AS withdrawn FROM ` + config.TableBalance + `
+    WHERE deleted_at IS NULL
+    GROUP BY user_id
+), users AS (
+    SELECT user_id FROM accruals UNION SELECT user_id FROM withdrawals
+    UNION SELECT user_id FROM received UNION SELECT user_id FROM stored
+    UNION SELECT user_id FROM bonuses
+), balances AS (
+    SELECT users.user_id,
+           COALESCE(stored.current, 0) AS current,
+           COALESCE(stored.withdrawn, 0) AS withdrawn,
+           COALESCE(accruals.amount, 0) + COALESCE(bonuses.amount, 0) + COALESCE(received.amount, 0)
+               - COALESCE(withdrawals.amount, 0) - COALESCE(expired.amount, 0) AS expected_current,
+           COALESCE(withdrawals.amount, 0) AS expected_withdrawn
+    FROM users
+    LEFT JOIN stored ON stored.user_id = users.user_id
+    LEFT JOIN accruals ON accruals.user_id = users.user_id
+    LEFT JOIN bonuses ON bonuses.user_id = users.user_id
+    LEFT JOIN withdrawals ON withdrawals.user_id = users.user_id
+    LEFT JOIN received ON received.user_id = users.user_id
+    LEFT JOIN expired ON expired.user_id = users.user_id
+)
+SELECT * FROM balances
+WHERE (current <> expected_current OR withdrawn <> expected_withdrawn)`
+
+// driftParams returns the parameters of driftQuery.
+func driftParams(userID uuid.UUID) map[string]interface{} {
+	return map[string]interface{}{
+		"processed": config.Processed,
+		"completed": WithdrawalCompleted,
+		"expiry":    LedgerExpiry,
+		"bonuses":   bonusKinds,
+		"user":      userID,
+	}
+}
+
+// GetDrifts recomputes the balance of every user from the source data: the
+// orders, the withdrawals, the transfers and the expired lots.
+// Returns the users whose stored balances differ from the recomputed ones.
+func (balanceDB *BalanceModel) GetDrifts() ([]Drift, error) {
+	var drifts []Drift
+	result := balanceDB.DB.Raw(driftQuery+" ORDER BY user_id", driftParams(uuid.Nil)).Scan(&drifts)
+	if result.Error != nil {
+		return []Drift{}, result.Error
+	}
+	return drifts, nil
+}
+
+// FixDrift corrects the stored balance of the user to the balance recomputed
+// from the source data. In a single transaction it recomputes the balance
+// under the lock of the stored one, updates the stored balance, writes the
+// correcting ledger entries and adds or consumes a lot for the difference,
+// so that the ledger and the lots follow the stored balance.
+// Returns the corrected drift, or nil if the balance has not drifted.
+func (balanceDB *BalanceModel) FixDrift(userID uuid.UUID) (*Drift, error) {
+	var fixed *Drift
+	err := balanceDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			var balances []Balance
+			result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("user_id = ?", userID).
+				Find(&balances)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			var drifts []Drift
+			result = tx.Raw(driftQuery+" AND user_id = @user", driftParams(userID)).Scan(&drifts)
+			if result.Error != nil || len(drifts) == 0 {
+				return result.Error
+			}
+			d := drifts[0]
+
+			if len(balances) == 0 {
+				result = tx.Create(&Balance{UserID: userID, Current: d.ExpectedCurrent, Withdrawn: d.ExpectedWithdrawn})
+			} else {
+				result = tx.Table(config.TableBalance).Where("user_id = ?", userID).Updates(
+					map[string]interface{}{
+						"current":    d.ExpectedCurrent,
+						"withdrawn":  d.ExpectedWithdrawn,
+						"updated_at": time.Now(),
+					},
+				)
+			}
+			if result.Error != nil {
+				return result.Error
+			}
+
+			reference := reconcileReference + uuid.New().String()
+			current := d.ExpectedCurrent - d.Current
+			withdrawn := d.ExpectedWithdrawn - d.Withdrawn
+			entries := make([]LedgerEntry, 0, 2)
+			if withdrawn != 0 {
+				entries = append(
+					entries, LedgerEntry{
+						UserID:        userID,
+						Kind:          LedgerWithdrawal,
+						Reference:     reference,
+						Amount:        -withdrawn,
+						ContraAccount: AccountWithdrawals,
+					},
+				)
+			}
+			if current+withdrawn != 0 {
+				entries = append(
+					entries, LedgerEntry{
+						UserID:        userID,
+						Kind:          LedgerAdjustment,
+						Reference:     reference,
+						Amount:        current + withdrawn,
+						ContraAccount: AccountAdjustments,
+					},
+				)
+			}
+			if len(entries) > 0 {
+				if err := tx.Create(&entries).Error; err != nil {
+					return err
+				}
+			}
+
+			switch {
+			case current > 0:
+				if err := addLot(tx, userID, LedgerAdjustment, reference, current); err != nil {
+					return err
+				}
+			case current < 0:
+				if _, err := consumeLots(tx, userID, LedgerAdjustment, reference, -current); err != nil {
+					return err
+				}
+			}
+
+			fixed = &d
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return fixed, nil
+}
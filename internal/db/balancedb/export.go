@@ -0,0 +1,93 @@
+package balancedb
+
+import (
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+)
+
+// ExportTypeOrder is the type of the export rows describing uploaded orders.
+// The other rows describe ledger entries and have the type of their kind.
+const ExportTypeOrder = "order"
+
+// ExportRow is a row of the points history export: an uploaded order or
+// a ledger entry. Amount of an order is its accrual once it is processed.
+// Balance is the running balance of the user after a ledger entry.
+type ExportRow struct {
+	UserID    uuid.UUID     `gorm:"column:user_id"`
+	Type      string        `gorm:"column:type"`
+	Reference string        `gorm:"column:reference"`
+	Status    string        `gorm:"column:status"`
+	Amount    *money.Points `gorm:"column:amount"`
+	Balance   *money.Points `gorm:"column:balance"`
+	CreatedAt time.Time     `gorm:"column:created_at"`
+}
+
+// ExportFilter selects the rows of the export: the rows of UserID, or of
+// every user if it is uuid.Nil, created within [From, To). Zero From and To
+// leave the period open.
+type ExportFilter struct {
+	UserID uuid.UUID
+	From   time.Time
+	To     time.Time
+}
+
+// Export streams the orders and the ledger entries selected by the filter to
+// fn ordered by user and time, one row at a time, so that the history is never
+// loaded into memory at once. Export stops at the first error returned by fn.
+func (balanceDB *BalanceModel) Export(filter ExportFilter, fn func(ExportRow) error) error {
+	orders := "deleted_at IS NULL"
+	entries := "TRUE"
+	if filter.UserID != uuid.Nil {
+		orders += " AND user_id = @user"
+		entries = "user_id = @user"
+	}
+	period := "TRUE"
+	if !filter.From.IsZero() {
+		period += " AND created_at >= @from"
+	}
+	if !filter.To.IsZero() {
+		period += " AND created_at < @to"
+	}
+	rows, err := balanceDB.DB.Raw(
+		`
+SELECT user_id, type, reference, status, amount, balance, created_at FROM (
+    SELECT user_id, CAST(@order AS text) AS type, order_id AS reference, status,
+           CASE WHEN status = @processed THEN accrual END AS amount,
+           NULL::numeric AS balance, created_at, 0 AS seq
+    FROM `+config.TableOrder+`
+    WHERE `+orders+`
+    UNION ALL
+    SELECT user_id, kind, reference, '', amount,
+           SUM(amount) OVER (PARTITION BY user_id ORDER BY id), created_at, id
+    FROM ledger_entries
+    WHERE `+entries+`
+) history
+WHERE `+period+`
+ORDER BY user_id, created_at, seq`,
+		map[string]interface{}{
+			"user":      filter.UserID,
+			"from":      filter.From,
+			"to":        filter.To,
+			"order":     ExportTypeOrder,
+			"processed": config.Processed,
+		},
+	).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row ExportRow
+		if err := balanceDB.DB.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
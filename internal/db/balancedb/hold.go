@@ -0,0 +1,201 @@
+package balancedb
+
+import (
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AuthorizeHold reserves amount points of the user for the order until ttl
+// elapses. The hold is placed only if the points which are not held yet cover
+// the amount.
+// Returns the hold, ErrorInsufficientFunds if the balance does not cover
+// the amount, ErrorOrderAlreadyWithdrawn if points have already been withdrawn
+// for the order, or gorm.ErrRecordNotFound if the user has no balance.
+func (balanceDB *BalanceModel) AuthorizeHold(
+	userID uuid.UUID,
+	order string,
+	amount money.Points,
+	ttl time.Duration,
+) (Hold, error) {
+	hold := Hold{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Order:     order,
+		Amount:    amount,
+		Status:    HoldActive,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	err := balanceDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			if err := orderNotWithdrawn(tx, order); err != nil {
+				return err
+			}
+			result := tx.Table(config.TableBalance).
+				Where("user_id = ? AND current - held >= ?", userID, amount).
+				Updates(
+					map[string]interface{}{
+						"held":       gorm.Expr("held + ?", amount),
+						"updated_at": time.Now(),
+					},
+				)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return insufficientFunds(tx, userID)
+			}
+			return tx.Create(&hold).Error
+		},
+	)
+	if err != nil {
+		return Hold{}, err
+	}
+	return hold, nil
+}
+
+// CaptureHold converts the active hold of the user into a withdrawal for
+// the order of the hold. Capturing a hold again returns its withdrawal.
+// Returns the withdrawal, gorm.ErrRecordNotFound if the user has no such hold,
+// or ErrorHoldNotActive if the hold has been voided or has expired.
+func (balanceDB *BalanceModel) CaptureHold(userID uuid.UUID, holdID uuid.UUID) (Withdrawal, error) {
+	var withdrawal Withdrawal
+	err := balanceDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			hold, err := lockHold(tx, userID, holdID)
+			if err != nil {
+				return err
+			}
+			if hold.Status == HoldCaptured {
+				return tx.Where(&Withdrawal{UserID: userID, Order: hold.Order}).Take(&withdrawal).Error
+			}
+			if hold.Status != HoldActive || !hold.ExpiresAt.After(time.Now()) {
+				return ErrorHoldNotActive
+			}
+
+			if err := releaseHold(tx, &hold, HoldCaptured); err != nil {
+				return err
+			}
+			withdrawal, err = withdraw(tx, userID, hold.Order, hold.Amount)
+			return err
+		},
+	)
+	if err != nil {
+		return Withdrawal{}, err
+	}
+	return withdrawal, nil
+}
+
+// VoidHold releases the active hold of the user. Voiding a hold again is
+// a no-op.
+// Returns the hold, gorm.ErrRecordNotFound if the user has no such hold,
+// or ErrorHoldNotActive if the hold has been captured or has expired.
+func (balanceDB *BalanceModel) VoidHold(userID uuid.UUID, holdID uuid.UUID) (Hold, error) {
+	var hold Hold
+	err := balanceDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			var err error
+			hold, err = lockHold(tx, userID, holdID)
+			if err != nil {
+				return err
+			}
+			switch hold.Status {
+			case HoldVoided:
+				return nil
+			case HoldActive:
+				return releaseHold(tx, &hold, HoldVoided)
+			default:
+				return ErrorHoldNotActive
+			}
+		},
+	)
+	if err != nil {
+		return Hold{}, err
+	}
+	return hold, nil
+}
+
+// GetExpiredHoldIDs retrieves the active holds which expired before the given time.
+func (balanceDB *BalanceModel) GetExpiredHoldIDs(before time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	result := balanceDB.DB.Model(&Hold{}).
+		Where("status = ? AND expires_at <= ?", HoldActive, before).
+		Order("expires_at").
+		Pluck("id", &ids)
+	if result.Error != nil {
+		return []uuid.UUID{}, result.Error
+	}
+	return ids, nil
+}
+
+// ExpireHold releases an overdue active hold. Expiring a hold which has been
+// settled in the meantime is a no-op.
+// Returns true if the hold was released.
+func (balanceDB *BalanceModel) ExpireHold(holdID uuid.UUID) (bool, error) {
+	expired := false
+	err := balanceDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			var hold Hold
+			result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND status = ? AND expires_at <= ?", holdID, HoldActive, time.Now()).
+				Limit(1).
+				Find(&hold)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+
+			expired = true
+			return releaseHold(tx, &hold, HoldExpired)
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return expired, nil
+}
+
+// GetHeldPoints returns the number of the user's points reserved by active holds.
+func (balanceDB *BalanceModel) GetHeldPoints(userID uuid.UUID) (money.Points, error) {
+	var held money.Points
+	result := balanceDB.DB.Model(&Hold{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("user_id = ? AND status = ?", userID, HoldActive).
+		Scan(&held)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return held, nil
+}
+
+// lockHold locks the hold of the user within the transaction tx.
+func lockHold(tx *gorm.DB, userID uuid.UUID, holdID uuid.UUID) (Hold, error) {
+	var hold Hold
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ?", holdID, userID).
+		Take(&hold)
+	if result.Error != nil {
+		return Hold{}, result.Error
+	}
+	return hold, nil
+}
+
+// releaseHold returns the points reserved by the hold to the user's balance
+// within the transaction tx and moves the hold to the status.
+func releaseHold(tx *gorm.DB, hold *Hold, status string) error {
+	result := tx.Table(config.TableBalance).Where("user_id = ?", hold.UserID).Updates(
+		map[string]interface{}{
+			"held":       gorm.Expr("held - ?", hold.Amount),
+			"updated_at": time.Now(),
+		},
+	)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	hold.Status = status
+	return tx.Model(hold).Update("status", status).Error
+}
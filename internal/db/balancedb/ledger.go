@@ -0,0 +1,298 @@
+package balancedb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Kinds of the ledger entries.
+const (
+	LedgerAccrual       = "accrual"
+	LedgerWithdrawal    = "withdrawal"
+	LedgerAdjustment    = "adjustment"
+	LedgerExpiry        = "expiry"
+	LedgerReversal      = "reversal"
+	LedgerTransferOut   = "transfer_out"
+	LedgerTransferIn    = "transfer_in"
+	LedgerTierBonus     = "tier_bonus"
+	LedgerCampaignBonus = "campaign_bonus"
+)
+
+// System accounts which are the counterparts of the users' accounts.
+// Points are issued from AccountIssuance when orders are credited and end up
+// in AccountWithdrawals when users spend them.
+const (
+	AccountIssuance    = "issuance"
+	AccountWithdrawals = "withdrawals"
+	AccountAdjustments = "adjustments"
+	AccountExpired     = "expired"
+	AccountTransfers   = "transfers"
+)
+
+// openingReference is the reference of the entries which carry the balances
+// accumulated before the ledger was introduced.
+const openingReference = "opening:"
+
+// creditableOrder holds the fields of an order needed to credit its accrual.
+type creditableOrder struct {
+	UserID   uuid.UUID    `gorm:"column:user_id"`
+	Accrual  money.Points `gorm:"column:accrual"`
+	Credited bool         `gorm:"column:credited"`
+}
+
+// Bonus is an amount of points credited on top of the accrual of an order,
+// e.g. by the multiplier of the user's tier. Kind is the kind of its ledger
+// entry and lot. The ledger entry of a bonus granted by a campaign is
+// attributed to the campaign by CampaignID.
+type Bonus struct {
+	Kind       string
+	Amount     money.Points
+	CampaignID *uint
+}
+
+// reference returns the reference of the bonus for the order. Bonuses of
+// campaigns are referenced per campaign, so that several campaigns can grant
+// a bonus for the same order.
+func (bonus Bonus) reference(orderID string) string {
+	if bonus.CampaignID == nil {
+		return orderID
+	}
+	return fmt.Sprintf("%s%d:%s", config.CampaignReferencePrefix, *bonus.CampaignID, orderID)
+}
+
+// CreditOrder credits the accrual of a processed order and the bonuses to
+// the order's user's balance. In a single transaction it writes a ledger entry
+// referencing the order and one per bonus, increments the balance, adds lots
+// of points expiring after config.PointsLifetimeMonths and marks the order
+// credited. The ledger entry is unique per order, so crediting an order again
+// is a no-op.
+// Returns true if the balance was incremented, gorm.ErrRecordNotFound if there
+// is no such processed order, or an error if the transaction fails.
+func (balanceDB *BalanceModel) CreditOrder(orderID string, bonuses ...Bonus) (bool, error) {
+	credited := false
+	err := balanceDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			var order creditableOrder
+			result := tx.Table(config.TableOrder).
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Select("user_id, accrual, credited").
+				Where("order_id = ? AND status = ?", orderID, config.Processed).
+				Take(&order)
+			if result.Error != nil {
+				return result.Error
+			}
+			if order.Credited {
+				return nil
+			}
+
+			result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(
+				&LedgerEntry{
+					UserID:        order.UserID,
+					Kind:          LedgerAccrual,
+					Reference:     orderID,
+					Amount:        order.Accrual,
+					ContraAccount: AccountIssuance,
+				},
+			)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				if err := incrementBalance(tx, order.UserID, order.Accrual); err != nil {
+					return err
+				}
+				if err := addLot(tx, order.UserID, LedgerAccrual, orderID, order.Accrual); err != nil {
+					return err
+				}
+				if err := creditBonuses(tx, order.UserID, orderID, bonuses); err != nil {
+					return err
+				}
+				credited = true
+			}
+
+			return tx.Table(config.TableOrder).
+				Where("order_id = ?", orderID).
+				Update("credited", true).Error
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return credited, nil
+}
+
+// creditBonuses credits the bonuses for the order to the user within
+// the transaction tx.
+func creditBonuses(tx *gorm.DB, userID uuid.UUID, orderID string, bonuses []Bonus) error {
+	for _, bonus := range bonuses {
+		if bonus.Amount <= 0 {
+			continue
+		}
+		reference := bonus.reference(orderID)
+		result := tx.Create(
+			&LedgerEntry{
+				UserID:        userID,
+				Kind:          bonus.Kind,
+				Reference:     reference,
+				Amount:        bonus.Amount,
+				ContraAccount: AccountIssuance,
+				CampaignID:    bonus.CampaignID,
+			},
+		)
+		if result.Error != nil {
+			return result.Error
+		}
+		if err := incrementBalance(tx, userID, bonus.Amount); err != nil {
+			return err
+		}
+		if err := addLot(tx, userID, bonus.Kind, reference, bonus.Amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// incrementBalance adds amount to the current balance of the user within
+// the transaction tx, creating the balance if the user has none yet.
+func incrementBalance(tx *gorm.DB, userID uuid.UUID, amount money.Points) error {
+	result := tx.Table(config.TableBalance).Where("user_id = ?", userID).Updates(
+		map[string]interface{}{
+			"current":    gorm.Expr("current + ?", amount),
+			"updated_at": time.Now(),
+		},
+	)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	return tx.Create(&Balance{UserID: userID, Current: amount}).Error
+}
+
+// ledgerTotals aggregates the ledger into the current and withdrawn points of
+// every user. Withdrawn points are the ones moved to AccountWithdrawals or
+// transferred to other users.
+const ledgerTotals = `
+SELECT user_id,
+       COALESCE(SUM(amount), 0) AS current,
+       COALESCE(-SUM(amount) FILTER (
+           WHERE contra_account = '` + AccountWithdrawals + `' OR kind = '` + LedgerTransferOut + `'
+       ), 0) AS withdrawn
+FROM ledger_entries
+GROUP BY user_id`
+
+// GetLedgerBalance derives the balance of the user from the ledger.
+// A user without ledger entries has a zero balance.
+func (balanceDB *BalanceModel) GetLedgerBalance(userID uuid.UUID) (Balance, error) {
+	balance := Balance{UserID: userID}
+	result := balanceDB.DB.Raw(
+		"SELECT current, withdrawn FROM ("+ledgerTotals+") totals WHERE user_id = ?",
+		userID,
+	).Scan(&balance)
+	if result.Error != nil {
+		return Balance{}, result.Error
+	}
+	return balance, nil
+}
+
+// Discrepancy describes a user whose cached balance differs from the ledger.
+type Discrepancy struct {
+	UserID          uuid.UUID    `json:"user_id" gorm:"column:user_id"`
+	Current         money.Points `json:"current" gorm:"column:current"`
+	Withdrawn       money.Points `json:"withdrawn" gorm:"column:withdrawn"`
+	LedgerCurrent   money.Points `json:"ledger_current" gorm:"column:ledger_current"`
+	LedgerWithdrawn money.Points `json:"ledger_withdrawn" gorm:"column:ledger_withdrawn"`
+}
+
+// Reconcile verifies the balances, which are a cached projection of the
+// ledger, against the ledger itself.
+// Returns the users whose balances differ from the ledger, or an error.
+func (balanceDB *BalanceModel) Reconcile() ([]Discrepancy, error) {
+	var discrepancies []Discrepancy
+	result := balanceDB.DB.Raw(
+		`
+SELECT COALESCE(b.user_id, l.user_id) AS user_id,
+       COALESCE(b.current, 0) AS current,
+       COALESCE(b.withdrawn, 0) AS withdrawn,
+       COALESCE(l.current, 0) AS ledger_current,
+       COALESCE(l.withdrawn, 0) AS ledger_withdrawn
+FROM (
+    SELECT user_id, SUM(current) AS current, SUM(withdrawn) AS withdrawn
+    FROM ` + config.TableBalance + `
+    WHERE deleted_at IS NULL
+    GROUP BY user_id
+) b
+FULL OUTER JOIN (` + ledgerTotals + `) l ON l.user_id = b.user_id
+WHERE COALESCE(b.current, 0) <> COALESCE(l.current, 0)
+   OR COALESCE(b.withdrawn, 0) <> COALESCE(l.withdrawn, 0)
+ORDER BY 1`,
+	).Scan(&discrepancies)
+	if result.Error != nil {
+		return []Discrepancy{}, result.Error
+	}
+	return discrepancies, nil
+}
+
+// BackfillLedger carries the balances accumulated before the ledger was
+// introduced over to the ledger: for every user with a balance but without
+// any ledger entries it writes opening entries covering the balance.
+// The balances of users who already have ledger entries are left alone, so
+// that their discrepancies are reported by Reconcile rather than written
+// into the ledger. It is meant to run once, as a migration.
+func (balanceDB *BalanceModel) BackfillLedger() error {
+	var balances []Balance
+	result := balanceDB.DB.Raw(
+		`
+SELECT b.user_id, SUM(b.current) AS current, SUM(b.withdrawn) AS withdrawn
+FROM ` + config.TableBalance + ` b
+WHERE b.deleted_at IS NULL
+  AND NOT EXISTS (SELECT 1 FROM ledger_entries l WHERE l.user_id = b.user_id)
+GROUP BY b.user_id
+HAVING SUM(b.current) <> 0 OR SUM(b.withdrawn) <> 0`,
+	).Scan(&balances)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, b := range balances {
+		entries := make([]LedgerEntry, 0, 2)
+		if b.Withdrawn != 0 {
+			entries = append(
+				entries, LedgerEntry{
+					UserID:        b.UserID,
+					Kind:          LedgerWithdrawal,
+					Reference:     openingReference + b.UserID.String(),
+					Amount:        -b.Withdrawn,
+					ContraAccount: AccountWithdrawals,
+				},
+			)
+		}
+		if b.Current+b.Withdrawn != 0 {
+			entries = append(
+				entries, LedgerEntry{
+					UserID:        b.UserID,
+					Kind:          LedgerAdjustment,
+					Reference:     openingReference + b.UserID.String(),
+					Amount:        b.Current + b.Withdrawn,
+					ContraAccount: AccountAdjustments,
+				},
+			)
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		result = balanceDB.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&entries)
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package balancedb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// lotExpiresAt returns the expiry time of the points earned at earnedAt.
+func lotExpiresAt(earnedAt time.Time) time.Time {
+	return earnedAt.AddDate(0, config.PointsLifetimeMonths, 0)
+}
+
+// addLot adds a lot of points earned now to the user within the transaction tx.
+func addLot(tx *gorm.DB, userID uuid.UUID, kind string, reference string, amount money.Points) error {
+	if amount <= 0 {
+		return nil
+	}
+	now := time.Now()
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(
+		&PointLot{
+			UserID:    userID,
+			Kind:      kind,
+			Reference: reference,
+			Amount:    amount,
+			Remaining: amount,
+			EarnedAt:  now,
+			ExpiresAt: lotExpiresAt(now),
+		},
+	).Error
+}
+
+// consumeLots takes amount points from the user's lots within the transaction
+// tx, the lots which expire first being consumed first, and records the usages
+// under kind and reference. Returns the lots the points were taken from, each
+// with the points taken from it as Amount.
+func consumeLots(
+	tx *gorm.DB,
+	userID uuid.UUID,
+	kind string,
+	reference string,
+	amount money.Points,
+) ([]PointLot, error) {
+	var lots []PointLot
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND remaining > 0", userID).
+		Order("expires_at, id").
+		Find(&lots)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var consumed []PointLot
+	for _, lot := range lots {
+		if amount <= 0 {
+			break
+		}
+		taken := lot.Remaining
+		if taken > amount {
+			taken = amount
+		}
+		if err := takeFromLot(tx, lot.ID, kind, reference, taken); err != nil {
+			return nil, err
+		}
+		lot.Amount = taken
+		consumed = append(consumed, lot)
+		amount -= taken
+	}
+	return consumed, nil
+}
+
+// carryLots adds to the user within the transaction tx amount points taken from
+// the lots of another user, so that the points keep the dates they were earned
+// and expire at. Every lot gets a lot of the user with the same dates,
+// identified by kind and the reference followed by its sequence number, e.g.
+// "transfer:<uuid>/1". Points which were not taken from any lot are added as
+// a lot earned now, identified by kind and reference.
+func carryLots(
+	tx *gorm.DB,
+	userID uuid.UUID,
+	kind string,
+	reference string,
+	lots []PointLot,
+	amount money.Points,
+) error {
+	for i, lot := range lots {
+		result := tx.Create(
+			&PointLot{
+				UserID:    userID,
+				Kind:      kind,
+				Reference: fmt.Sprintf("%s/%d", reference, i+1),
+				Amount:    lot.Amount,
+				Remaining: lot.Amount,
+				EarnedAt:  lot.EarnedAt,
+				ExpiresAt: lot.ExpiresAt,
+			},
+		)
+		if result.Error != nil {
+			return result.Error
+		}
+		amount -= lot.Amount
+	}
+	return addLot(tx, userID, kind, reference, amount)
+}
+
+// takeFromLot decrements the remaining points of the lot and records the usage.
+func takeFromLot(tx *gorm.DB, lotID uint, kind string, reference string, amount money.Points) error {
+	result := tx.Model(&PointLot{}).
+		Where("id = ?", lotID).
+		Update("remaining", gorm.Expr("remaining - ?", amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	return tx.Create(
+		&PointLotUsage{
+			LotID:     lotID,
+			Kind:      kind,
+			Reference: reference,
+			Amount:    amount,
+		},
+	).Error
+}
+
+// restoreLots returns the points taken from the lots by the operation
+// identified by kind and reference within the transaction tx, so that they
+// keep their expiry dates. Points are returned to the lots which have not
+// expired yet and recorded as negative usages under restoreKind. Points taken
+// from the lots which have expired since are put into a new lot, identified by
+// restoreKind and reference, which is already overdue and is expired with
+// the next run of the expiry job.
+func restoreLots(tx *gorm.DB, kind string, reference string, restoreKind string) error {
+	var usages []PointLotUsage
+	result := tx.Where(&PointLotUsage{Kind: kind, Reference: reference}).Find(&usages)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	overdue := PointLot{Kind: restoreKind, Reference: reference}
+	now := time.Now()
+	for _, usage := range usages {
+		var lot PointLot
+		result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&lot, usage.LotID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if lot.ExpiresAt.After(now) {
+			if err := takeFromLot(tx, lot.ID, restoreKind, reference, -usage.Amount); err != nil {
+				return err
+			}
+			continue
+		}
+
+		overdue.UserID = lot.UserID
+		overdue.Amount += usage.Amount
+		if lot.EarnedAt.After(overdue.EarnedAt) {
+			overdue.EarnedAt = lot.EarnedAt
+		}
+		if lot.ExpiresAt.After(overdue.ExpiresAt) {
+			overdue.ExpiresAt = lot.ExpiresAt
+		}
+	}
+	if overdue.Amount == 0 {
+		return nil
+	}
+	overdue.Remaining = overdue.Amount
+	return tx.Create(&overdue).Error
+}
+
+// GetExpiredLotIDs retrieves the lots which expired before the given time
+// and still have remaining points.
+func (balanceDB *BalanceModel) GetExpiredLotIDs(before time.Time) ([]uint, error) {
+	var ids []uint
+	result := balanceDB.DB.Model(&PointLot{}).
+		Where("expires_at <= ? AND remaining > 0", before).
+		Order("expires_at, id").
+		Pluck("id", &ids)
+	if result.Error != nil {
+		return []uint{}, result.Error
+	}
+	return ids, nil
+}
+
+// ExpireLot expires the remaining points of an overdue lot. In a single
+// transaction it writes an expiry ledger entry referencing the lot, decrements
+// the balance and empties the lot. Points reserved by active holds do not
+// expire: at most the points which are not held are taken from the lot, and
+// the rest stays in the lot until the holds are captured, which consumes it,
+// or released, after which it expires with the next run. Expiring an empty
+// lot is a no-op.
+// Returns the number of expired points.
+func (balanceDB *BalanceModel) ExpireLot(lotID uint) (money.Points, error) {
+	var expired money.Points
+	err := balanceDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			// The balance is locked before the lot, in the same order
+			// as withdrawals lock them.
+			var owner PointLot
+			result := tx.Select("user_id").Where("id = ?", lotID).Limit(1).Find(&owner)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			var balance Balance
+			result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("user_id = ?", owner.UserID).
+				Take(&balance)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			var lot PointLot
+			result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND remaining > 0 AND expires_at <= ?", lotID, time.Now()).
+				Limit(1).
+				Find(&lot)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+
+			amount := balance.Current - balance.Held
+			if amount > lot.Remaining {
+				amount = lot.Remaining
+			}
+			if amount <= 0 {
+				return nil
+			}
+
+			reference, err := expiryReference(tx, lot.ID)
+			if err != nil {
+				return err
+			}
+			result = tx.Create(
+				&LedgerEntry{
+					UserID:        lot.UserID,
+					Kind:          LedgerExpiry,
+					Reference:     reference,
+					Amount:        -amount,
+					ContraAccount: AccountExpired,
+				},
+			)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			result = tx.Table(config.TableBalance).Where("user_id = ?", lot.UserID).Updates(
+				map[string]interface{}{
+					"current":    gorm.Expr("current - ?", amount),
+					"updated_at": time.Now(),
+				},
+			)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			expired = amount
+			return takeFromLot(tx, lot.ID, LedgerExpiry, reference, amount)
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return expired, nil
+}
+
+// expiryReference returns within the transaction tx the reference of the next
+// expiry of the lot. A lot is usually expired at once and referenced as
+// "lot:<id>"; the following expiries of the points which were held at
+// the first one get a sequence number, e.g. "lot:<id>/2".
+func expiryReference(tx *gorm.DB, lotID uint) (string, error) {
+	var expiries int64
+	err := tx.Model(&PointLotUsage{}).
+		Where("lot_id = ? AND kind = ?", lotID, LedgerExpiry).
+		Count(&expiries).Error
+	if err != nil {
+		return "", err
+	}
+	if expiries == 0 {
+		return fmt.Sprintf("lot:%d", lotID), nil
+	}
+	return fmt.Sprintf("lot:%d/%d", lotID, expiries+1), nil
+}
+
+// GetExpiringPoints returns the number of the user's points which expire
+// before the given time.
+func (balanceDB *BalanceModel) GetExpiringPoints(userID uuid.UUID, before time.Time) (money.Points, error) {
+	var expiring money.Points
+	result := balanceDB.DB.Model(&PointLot{}).
+		Select("COALESCE(SUM(remaining), 0)").
+		Where("user_id = ? AND remaining > 0 AND expires_at <= ?", userID, before).
+		Scan(&expiring)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return expiring, nil
+}
+
+// BackfillLots puts the points earned before the lots were introduced into
+// an opening lot per user, which expires a full lifetime after the backfill.
+// The opening lot is created at most once per user.
+func (balanceDB *BalanceModel) BackfillLots() error {
+	now := time.Now()
+	result := balanceDB.DB.Exec(
+		`
+INSERT INTO point_lots (user_id, kind, reference, amount, remaining, earned_at, expires_at, created_at)
+SELECT b.user_id, ?, ? || b.user_id, b.current - COALESCE(l.remaining, 0),
+       b.current - COALESCE(l.remaining, 0), ?, ?, ?
+FROM `+config.TableBalance+` b
+LEFT JOIN (
+    SELECT user_id, SUM(remaining) AS remaining FROM point_lots GROUP BY user_id
+) l ON l.user_id = b.user_id
+WHERE b.deleted_at IS NULL AND b.current > COALESCE(l.remaining, 0)
+ON CONFLICT DO NOTHING`,
+		LedgerAdjustment,
+		openingReference,
+		now,
+		lotExpiresAt(now),
+		now,
+	)
+	return result.Error
+}
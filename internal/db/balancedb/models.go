@@ -3,22 +3,130 @@ package balancedb
 import (
 	"time"
 
+	"github.com/elina-chertova/loyalty-system/pkg/money"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type Balance struct {
 	gorm.Model
-	UserID    uuid.UUID `json:"user_id"`
-	Current   float64   `json:"current"`
-	Withdrawn float64   `json:"withdrawn"`
-	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID    `json:"user_id"`
+	Current   money.Points `json:"current" gorm:"check:chk_balances_current_non_negative,current >= 0"`
+	Withdrawn money.Points `json:"withdrawn"`
+	Held      money.Points `json:"held" gorm:"not null;default:0;check:chk_balances_held_non_negative,held >= 0"`
+	UpdatedAt time.Time    `json:"updated_at"`
 }
 
 type Withdrawal struct {
 	gorm.Model
-	UserID    uuid.UUID `json:"user_id"`
-	Order     string    `json:"order" gorm:"unique_index"`
-	Sum       float64   `json:"sum"`
+	UserID         uuid.UUID    `json:"user_id"`
+	Order          string       `json:"order" gorm:"unique_index"`
+	Sum            money.Points `json:"sum"`
+	Status         string       `json:"status" gorm:"not null;default:COMPLETED"`
+	ReversalReason string       `json:"reversal_reason"`
+	ReversedAt     *time.Time   `json:"reversed_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// Withdrawal statuses.
+const (
+	WithdrawalCompleted = "COMPLETED"
+	WithdrawalReversed  = "REVERSED"
+)
+
+// LedgerEntry is an entry of the append-only points ledger. Every entry moves
+// Amount points between the user's account and the system account named by
+// ContraAccount, so each entry is balanced on its own and the balances are
+// derived from the ledger. Kind and Reference identify the operation that
+// created the entry, so that every operation is applied at most once.
+// Entries are never updated or deleted; mistakes are corrected by new entries.
+// CampaignID attributes the bonuses granted by a campaign to the campaign.
+type LedgerEntry struct {
+	ID            uint         `json:"id" gorm:"primarykey"`
+	UserID        uuid.UUID    `json:"user_id" gorm:"index;not null"`
+	Kind          string       `json:"kind" gorm:"uniqueIndex:idx_ledger_operation;not null"`
+	Reference     string       `json:"reference" gorm:"uniqueIndex:idx_ledger_operation;not null"`
+	Amount        money.Points `json:"amount"`
+	ContraAccount string       `json:"contra_account"`
+	CampaignID    *uint        `json:"campaign_id,omitempty" gorm:"index"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// PointLot is a portion of points earned at once, e.g. the accrual of an
+// order. Points expire together with their lot; withdrawals consume the lots
+// which expire first. Kind and Reference identify the operation that created
+// the lot, like the ledger entry of the same operation.
+type PointLot struct {
+	ID        uint         `json:"id" gorm:"primarykey"`
+	UserID    uuid.UUID    `json:"user_id" gorm:"index:idx_point_lots_user_expiry;not null"`
+	Kind      string       `json:"kind" gorm:"uniqueIndex:idx_point_lots_operation;not null"`
+	Reference string       `json:"reference" gorm:"uniqueIndex:idx_point_lots_operation;not null"`
+	Amount    money.Points `json:"amount"`
+	Remaining money.Points `json:"remaining" gorm:"check:chk_point_lots_remaining_non_negative,remaining >= 0"`
+	EarnedAt  time.Time    `json:"earned_at"`
+	ExpiresAt time.Time    `json:"expires_at" gorm:"index:idx_point_lots_user_expiry;not null"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// PointLotUsage records how many points of a lot were taken by a withdrawal
+// or by the expiry of the lot.
+type PointLotUsage struct {
+	ID        uint         `json:"id" gorm:"primarykey"`
+	LotID     uint         `json:"lot_id" gorm:"index;not null"`
+	Kind      string       `json:"kind" gorm:"index:idx_point_lot_usages_operation;not null"`
+	Reference string       `json:"reference" gorm:"index:idx_point_lot_usages_operation;not null"`
+	Amount    money.Points `json:"amount"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// Transfer records points sent by one user to another. Reference identifies
+// the transfer in the ledger, the lots and the sender's withdrawals.
+type Transfer struct {
+	ID          uint         `json:"id" gorm:"primarykey"`
+	Reference   string       `json:"reference" gorm:"uniqueIndex;not null"`
+	SenderID    uuid.UUID    `json:"sender_id" gorm:"index:idx_transfers_sender_created;not null"`
+	RecipientID uuid.UUID    `json:"recipient_id" gorm:"index;not null"`
+	Amount      money.Points `json:"amount"`
+	CreatedAt   time.Time    `json:"created_at" gorm:"index:idx_transfers_sender_created"`
+}
+
+// Hold reserves points of the user for an order until the payment of the order
+// settles. Held points stay in the balance but cannot be withdrawn; capturing
+// the hold withdraws them, voiding or expiring it releases them.
+type Hold struct {
+	ID        uuid.UUID    `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID    `json:"user_id" gorm:"index;not null"`
+	Order     string       `json:"order" gorm:"not null"`
+	Amount    money.Points `json:"amount"`
+	Status    string       `json:"status" gorm:"index:idx_holds_status_expiry;not null"`
+	ExpiresAt time.Time    `json:"expires_at" gorm:"index:idx_holds_status_expiry;not null"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// Hold statuses.
+const (
+	HoldActive   = "ACTIVE"
+	HoldCaptured = "CAPTURED"
+	HoldVoided   = "VOIDED"
+	HoldExpired  = "EXPIRED"
+)
+
+// UserTier is the loyalty tier currently assigned to the user.
+type UserTier struct {
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey"`
+	Tier      string    `json:"tier" gorm:"not null"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// TierChange records a change of the user's loyalty tier together with
+// the credited accrual over the rolling window which caused it.
+// OldTier is empty for the first tier assigned to the user.
+type TierChange struct {
+	ID        uint         `json:"id" gorm:"primarykey"`
+	UserID    uuid.UUID    `json:"user_id" gorm:"index;not null"`
+	OldTier   string       `json:"old_tier"`
+	NewTier   string       `json:"new_tier" gorm:"not null"`
+	Accrual   money.Points `json:"accrual"`
+	CreatedAt time.Time    `json:"created_at"`
+}
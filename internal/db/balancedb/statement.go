@@ -0,0 +1,53 @@
+package balancedb
+
+import (
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+)
+
+// StatementLine is a ledger entry of the user together with the balance of
+// the user right after the entry.
+type StatementLine struct {
+	ID        uint         `gorm:"column:id"`
+	Kind      string       `gorm:"column:kind"`
+	Reference string       `gorm:"column:reference"`
+	Amount    money.Points `gorm:"column:amount"`
+	Balance   money.Points `gorm:"column:balance"`
+	CreatedAt time.Time    `gorm:"column:created_at"`
+}
+
+// StatementFilter selects the lines of a statement: at most Limit lines
+// following the line with the ID After and created within [From, To).
+// Zero From and To leave the period open.
+type StatementFilter struct {
+	After uint
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+// GetStatement retrieves the ledger entries of the user in the order they
+// were written, each with the running balance. The running balance accounts
+// for all the entries of the user, including the ones filtered out.
+func (balanceDB *BalanceModel) GetStatement(userID uuid.UUID, filter StatementFilter) ([]StatementLine, error) {
+	entries := balanceDB.DB.Model(&LedgerEntry{}).
+		Select("id, kind, reference, amount, created_at, SUM(amount) OVER (ORDER BY id) AS balance").
+		Where("user_id = ?", userID)
+
+	query := balanceDB.DB.Table("(?) AS lines", entries).Where("id > ?", filter.After)
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	var lines []StatementLine
+	result := query.Order("id").Limit(filter.Limit).Scan(&lines)
+	if result.Error != nil {
+		return []StatementLine{}, result.Error
+	}
+	return lines, nil
+}
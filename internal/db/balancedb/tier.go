@@ -0,0 +1,101 @@
+package balancedb
+
+import (
+	"errors"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WindowAccrual is the accrual credited to the user within a rolling window.
+type WindowAccrual struct {
+	UserID  uuid.UUID    `gorm:"column:user_id"`
+	Accrual money.Points `gorm:"column:accrual"`
+}
+
+// GetTier retrieves the loyalty tier assigned to the user.
+// Returns gorm.ErrRecordNotFound if the user has not been assigned a tier yet.
+func (balanceDB *BalanceModel) GetTier(userID uuid.UUID) (UserTier, error) {
+	var tier UserTier
+	result := balanceDB.DB.Where("user_id = ?", userID).Take(&tier)
+	if result.Error != nil {
+		return UserTier{}, result.Error
+	}
+	return tier, nil
+}
+
+// GetTierChanges retrieves the tier changes of the user, the latest first.
+func (balanceDB *BalanceModel) GetTierChanges(userID uuid.UUID) ([]TierChange, error) {
+	var changes []TierChange
+	result := balanceDB.DB.Where("user_id = ?", userID).Order("id desc").Find(&changes)
+	if result.Error != nil {
+		return []TierChange{}, result.Error
+	}
+	return changes, nil
+}
+
+// GetWindowAccruals sums up the accruals of processed orders credited to every
+// user since the given time. Bonuses are not included. Users who have been
+// assigned a tier are included even if nothing has been credited to them.
+func (balanceDB *BalanceModel) GetWindowAccruals(since time.Time) ([]WindowAccrual, error) {
+	var accruals []WindowAccrual
+	result := balanceDB.DB.Raw(
+		`
+SELECT user_id, SUM(accrual) AS accrual FROM (
+    SELECT user_id, amount AS accrual FROM ledger_entries
+    WHERE kind = ? AND created_at >= ?
+    UNION ALL
+    SELECT user_id, 0 FROM user_tiers
+) accruals
+GROUP BY user_id
+ORDER BY user_id`,
+		LedgerAccrual,
+		since,
+	).Scan(&accruals)
+	if result.Error != nil {
+		return []WindowAccrual{}, result.Error
+	}
+	return accruals, nil
+}
+
+// SetTier assigns the tier to the user and records the change together with
+// the accrual which caused it. Assigning the current tier again is a no-op.
+// Returns true if the tier has changed.
+func (balanceDB *BalanceModel) SetTier(userID uuid.UUID, tier string, accrual money.Points) (bool, error) {
+	changed := false
+	err := balanceDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			var current UserTier
+			result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("user_id = ?", userID).
+				Take(&current)
+			if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return result.Error
+			}
+			if current.Tier == tier {
+				return nil
+			}
+
+			result = tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&UserTier{UserID: userID, Tier: tier})
+			if result.Error != nil {
+				return result.Error
+			}
+			changed = true
+			return tx.Create(
+				&TierChange{
+					UserID:  userID,
+					OldTier: current.Tier,
+					NewTier: tier,
+					Accrual: accrual,
+				},
+			).Error
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return changed, nil
+}
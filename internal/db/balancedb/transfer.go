@@ -0,0 +1,125 @@
+package balancedb
+
+import (
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Transfer moves amount points from the sender to the recipient. In a single
+// transaction it debits the sender only if the points which are not held
+// cover the amount and the sender's transfers within
+// config.TransferLimitWindow stay within dailyLimit, records the transfer as
+// a withdrawal of the sender, credits the recipient with the points of
+// the sender's lots, which keep their expiry dates, and writes the ledger
+// entries of both sides under the same reference.
+// Returns the transfer, ErrorInsufficientFunds if the sender's balance does
+// not cover the amount, ErrorTransferLimitExceeded if the transfer exceeds
+// dailyLimit, or gorm.ErrRecordNotFound if the sender has no balance.
+func (balanceDB *BalanceModel) Transfer(
+	senderID uuid.UUID,
+	recipientID uuid.UUID,
+	amount money.Points,
+	dailyLimit money.Points,
+) (Transfer, error) {
+	transfer := Transfer{
+		Reference:   config.TransferReferencePrefix + uuid.New().String(),
+		SenderID:    senderID,
+		RecipientID: recipientID,
+		Amount:      amount,
+	}
+	err := balanceDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			// Lock both balances in the same order, so that opposite
+			// transfers between two users do not deadlock.
+			var balances []Balance
+			result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("user_id IN ?", []uuid.UUID{senderID, recipientID}).
+				Order("user_id").
+				Find(&balances)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			var transferred money.Points
+			result = tx.Model(&Transfer{}).
+				Select("COALESCE(SUM(amount), 0)").
+				Where("sender_id = ? AND created_at > ?", senderID, time.Now().Add(-config.TransferLimitWindow)).
+				Scan(&transferred)
+			if result.Error != nil {
+				return result.Error
+			}
+			if transferred+amount > dailyLimit {
+				return ErrorTransferLimitExceeded
+			}
+
+			result = tx.Table(config.TableBalance).
+				Where("user_id = ? AND current - held >= ?", senderID, amount).
+				Updates(
+					map[string]interface{}{
+						"current":    gorm.Expr("current - ?", amount),
+						"withdrawn":  gorm.Expr("withdrawn + ?", amount),
+						"updated_at": time.Now(),
+					},
+				)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return insufficientFunds(tx, senderID)
+			}
+			lots, err := consumeLots(tx, senderID, LedgerTransferOut, transfer.Reference, amount)
+			if err != nil {
+				return err
+			}
+
+			entries := []LedgerEntry{
+				{
+					UserID:        senderID,
+					Kind:          LedgerTransferOut,
+					Reference:     transfer.Reference,
+					Amount:        -amount,
+					ContraAccount: AccountTransfers,
+				},
+				{
+					UserID:        recipientID,
+					Kind:          LedgerTransferIn,
+					Reference:     transfer.Reference,
+					Amount:        amount,
+					ContraAccount: AccountTransfers,
+				},
+			}
+			if err := tx.Create(&entries).Error; err != nil {
+				return err
+			}
+
+			result = tx.Table(config.TableWithdrawal).Create(
+				&Withdrawal{
+					UserID: senderID,
+					Order:  transfer.Reference,
+					Sum:    amount,
+					Status: WithdrawalCompleted,
+				},
+			)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			if err := incrementBalance(tx, recipientID, amount); err != nil {
+				return err
+			}
+			if err := carryLots(tx, recipientID, LedgerTransferIn, transfer.Reference, lots, amount); err != nil {
+				return err
+			}
+			return tx.Create(&transfer).Error
+		},
+	)
+	if err != nil {
+		return Transfer{}, err
+	}
+	return transfer, nil
+}
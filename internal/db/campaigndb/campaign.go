@@ -0,0 +1,133 @@
+// Package campaigndb provides data access functionalities for the promotional
+// campaigns of the loyalty system. It uses GORM for database operations.
+package campaigndb
+
+import (
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/internal/db/balancedb"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CampaignModel represents the model for campaign data and provides methods
+// for interacting with the campaigns table in the database.
+type CampaignModel struct {
+	DB *gorm.DB
+}
+
+// NewCampaignModel creates a new instance of CampaignModel with the given GORM DB instance.
+func NewCampaignModel(db *gorm.DB) *CampaignModel {
+	return &CampaignModel{DB: db}
+}
+
+// CampaignRepository defines the interface for campaign data operations.
+type CampaignRepository interface {
+	CreateCampaign(campaign *Campaign) error
+	GetCampaign(id uint) (Campaign, error)
+	GetCampaigns() ([]Campaign, error)
+	UpdateCampaign(campaign *Campaign) error
+	DeleteCampaign(id uint) error
+
+	GetActiveCampaigns(at time.Time) ([]Campaign, error)
+	GetCampaignCosts(ids []uint) ([]CampaignCost, error)
+	HasCreditedOrders(userID uuid.UUID) (bool, error)
+}
+
+// CreateCampaign stores a new campaign and sets its ID.
+func (campaignDB *CampaignModel) CreateCampaign(campaign *Campaign) error {
+	return campaignDB.DB.Create(campaign).Error
+}
+
+// GetCampaign retrieves a campaign by its ID.
+// Returns gorm.ErrRecordNotFound if there is no such campaign.
+func (campaignDB *CampaignModel) GetCampaign(id uint) (Campaign, error) {
+	var campaign Campaign
+	result := campaignDB.DB.Take(&campaign, id)
+	if result.Error != nil {
+		return Campaign{}, result.Error
+	}
+	return campaign, nil
+}
+
+// GetCampaigns retrieves all campaigns, the latest starting first.
+func (campaignDB *CampaignModel) GetCampaigns() ([]Campaign, error) {
+	var campaigns []Campaign
+	result := campaignDB.DB.Order("starts_at desc, id desc").Find(&campaigns)
+	if result.Error != nil {
+		return []Campaign{}, result.Error
+	}
+	return campaigns, nil
+}
+
+// UpdateCampaign overwrites the definition of the campaign.
+// Returns gorm.ErrRecordNotFound if there is no such campaign.
+func (campaignDB *CampaignModel) UpdateCampaign(campaign *Campaign) error {
+	campaign.UpdatedAt = time.Now()
+	result := campaignDB.DB.Model(campaign).
+		Select(
+			"name", "starts_at", "ends_at", "bonus_type", "multiplier", "amount",
+			"first_order_only", "min_accrual", "tiers", "updated_at",
+		).
+		Updates(campaign)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteCampaign deletes the campaign. The bonuses it has granted stay
+// attributed to it.
+// Returns gorm.ErrRecordNotFound if there is no such campaign.
+func (campaignDB *CampaignModel) DeleteCampaign(id uint) error {
+	result := campaignDB.DB.Delete(&Campaign{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetActiveCampaigns retrieves the campaigns running at the given time.
+func (campaignDB *CampaignModel) GetActiveCampaigns(at time.Time) ([]Campaign, error) {
+	var campaigns []Campaign
+	result := campaignDB.DB.Where("starts_at <= ? AND ends_at > ?", at, at).Order("id").Find(&campaigns)
+	if result.Error != nil {
+		return []Campaign{}, result.Error
+	}
+	return campaigns, nil
+}
+
+// GetCampaignCosts sums up the bonuses credited by the campaigns from
+// the points ledger. Campaigns which have not granted any bonus are omitted.
+func (campaignDB *CampaignModel) GetCampaignCosts(ids []uint) ([]CampaignCost, error) {
+	var costs []CampaignCost
+	result := campaignDB.DB.Model(&balancedb.LedgerEntry{}).
+		Select("campaign_id, COUNT(*) AS orders, SUM(amount) AS bonus").
+		Where("campaign_id IN ?", ids).
+		Group("campaign_id").
+		Scan(&costs)
+	if result.Error != nil {
+		return []CampaignCost{}, result.Error
+	}
+	return costs, nil
+}
+
+// HasCreditedOrders reports whether the accrual of any order of the user has
+// been credited.
+func (campaignDB *CampaignModel) HasCreditedOrders(userID uuid.UUID) (bool, error) {
+	var credited int64
+	result := campaignDB.DB.Table(config.TableOrder).
+		Where("user_id = ? AND credited = ?", userID, true).
+		Count(&credited)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return credited > 0, nil
+}
@@ -0,0 +1,81 @@
+package campaigndb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/db/balancedb"
+	"github.com/elina-chertova/loyalty-system/internal/db/dbtest"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestCampaignModel(t *testing.T) {
+	db := dbtest.Open(t, &Campaign{}, &balancedb.LedgerEntry{})
+	model := NewCampaignModel(db)
+
+	start := time.Now().Add(-time.Hour)
+	campaign := Campaign{
+		Name:       "Double points",
+		StartsAt:   start,
+		EndsAt:     start.Add(48 * time.Hour),
+		BonusType:  BonusMultiplier,
+		Multiplier: 200,
+	}
+	require.NoError(t, model.CreateCampaign(&campaign))
+	userID := uuid.New()
+	t.Cleanup(
+		func() {
+			db.Unscoped().Delete(&Campaign{}, campaign.ID)
+			db.Where("user_id = ?", userID).Delete(&balancedb.LedgerEntry{})
+		},
+	)
+
+	isActive := func(at time.Time) bool {
+		campaigns, err := model.GetActiveCampaigns(at)
+		require.NoError(t, err)
+		for _, c := range campaigns {
+			if c.ID == campaign.ID {
+				return true
+			}
+		}
+		return false
+	}
+	assert.True(t, isActive(start))
+	assert.False(t, isActive(start.Add(48*time.Hour)))
+
+	campaign.EndsAt = start.Add(24 * time.Hour)
+	require.NoError(t, model.UpdateCampaign(&campaign))
+	assert.False(t, isActive(start.Add(36*time.Hour)))
+	assert.Error(t, model.UpdateCampaign(&Campaign{Model: campaign.Model, StartsAt: start, EndsAt: start}))
+
+	for i, amount := range []float64{120, 30.5} {
+		require.NoError(
+			t, db.Create(
+				&balancedb.LedgerEntry{
+					UserID:        userID,
+					Kind:          balancedb.LedgerCampaignBonus,
+					Reference:     fmt.Sprintf("%s-%d", userID, i),
+					Amount:        money.FromFloat(amount),
+					ContraAccount: balancedb.AccountIssuance,
+					CampaignID:    &campaign.ID,
+				},
+			).Error,
+		)
+	}
+	costs, err := model.GetCampaignCosts([]uint{campaign.ID})
+	require.NoError(t, err)
+	assert.Equal(
+		t, []CampaignCost{{CampaignID: campaign.ID, Orders: 2, Bonus: money.FromFloat(150.5)}}, costs,
+	)
+
+	require.NoError(t, model.DeleteCampaign(campaign.ID))
+	assert.ErrorIs(t, model.DeleteCampaign(campaign.ID), gorm.ErrRecordNotFound)
+	_, err = model.GetCampaign(campaign.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.False(t, isActive(start))
+}
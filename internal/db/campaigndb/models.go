@@ -0,0 +1,41 @@
+package campaigndb
+
+import (
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/tier"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"gorm.io/gorm"
+)
+
+// Campaign is a promotional campaign granting bonus points for the orders
+// uploaded between StartsAt and EndsAt. The bonus is either the accrual
+// multiplied by Multiplier or the fixed Amount, depending on BonusType.
+// An order is eligible if its accrual is at least MinAccrual, it is the first
+// credited order of the user when FirstOrderOnly is set, and the user's tier
+// is one of the comma-separated Tiers unless Tiers is empty.
+type Campaign struct {
+	gorm.Model
+	Name           string          `json:"name" gorm:"not null"`
+	StartsAt       time.Time       `json:"starts_at" gorm:"index:idx_campaigns_period;not null"`
+	EndsAt         time.Time       `json:"ends_at" gorm:"index:idx_campaigns_period;not null;check:chk_campaigns_period,ends_at > starts_at"`
+	BonusType      string          `json:"bonus_type" gorm:"not null"`
+	Multiplier     tier.Multiplier `json:"multiplier"`
+	Amount         money.Points    `json:"amount"`
+	FirstOrderOnly bool            `json:"first_order_only" gorm:"not null;default:false"`
+	MinAccrual     money.Points    `json:"min_accrual"`
+	Tiers          string          `json:"tiers"`
+}
+
+// Bonus types of the campaigns.
+const (
+	BonusMultiplier = "multiplier"
+	BonusFixed      = "fixed"
+)
+
+// CampaignCost sums up the bonuses granted by a campaign.
+type CampaignCost struct {
+	CampaignID uint         `gorm:"column:campaign_id"`
+	Orders     int64        `gorm:"column:orders"`
+	Bonus      money.Points `gorm:"column:bonus"`
+}
@@ -2,6 +2,8 @@ package db
 
 import (
 	"github.com/elina-chertova/loyalty-system/internal/db/balancedb"
+	"github.com/elina-chertova/loyalty-system/internal/db/campaigndb"
+	"github.com/elina-chertova/loyalty-system/internal/db/idempotencydb"
 	"github.com/elina-chertova/loyalty-system/internal/db/orderdb"
 	"github.com/elina-chertova/loyalty-system/internal/db/userdb"
 	"gorm.io/gorm"
@@ -11,6 +13,9 @@ type Models struct {
 	User    *userdb.UserModel
 	Order   *orderdb.OrderModel
 	Balance *balancedb.BalanceModel
+
+	Idempotency *idempotencydb.IdempotencyModel
+	Campaign    *campaigndb.CampaignModel
 }
 
 func NewModels(conn *gorm.DB) *Models {
@@ -18,5 +23,8 @@ func NewModels(conn *gorm.DB) *Models {
 		User:    userdb.NewUserModel(conn),
 		Order:   orderdb.NewOrderModel(conn),
 		Balance: balancedb.NewBalanceModel(conn),
+
+		Idempotency: idempotencydb.NewIdempotencyModel(conn),
+		Campaign:    campaigndb.NewCampaignModel(conn),
 	}
 }
@@ -0,0 +1,31 @@
+// Package dbtest provides helpers for the tests running against a real
+// database.
+package dbtest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// DatabaseURIEnv names the environment variable holding the DSN of the test
+// database.
+const DatabaseURIEnv = "TEST_DATABASE_URI"
+
+// Open connects to the database from TEST_DATABASE_URI and migrates
+// the given models. The test is skipped if TEST_DATABASE_URI is not set.
+func Open(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	databaseDSN := os.Getenv(DatabaseURIEnv)
+	if databaseDSN == "" {
+		t.Skip(DatabaseURIEnv + " is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(databaseDSN), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(models...))
+	return db
+}
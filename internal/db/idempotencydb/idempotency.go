@@ -0,0 +1,113 @@
+// Package idempotencydb provides data access functionalities for the
+// idempotency keys of client requests in the loyalty system.
+package idempotencydb
+
+import (
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyModel represents the model for idempotency keys and provides
+// methods for interacting with the idempotency keys table in the database.
+type IdempotencyModel struct {
+	DB *gorm.DB
+}
+
+// NewIdempotencyModel creates a new instance of IdempotencyModel with the given GORM DB instance.
+func NewIdempotencyModel(db *gorm.DB) *IdempotencyModel {
+	return &IdempotencyModel{DB: db}
+}
+
+// IdempotencyRepository defines the interface for idempotency key operations.
+type IdempotencyRepository interface {
+	ReserveKey(userID uuid.UUID, key string, requestHash string) (IdempotencyKey, bool, error)
+	CompleteKey(userID uuid.UUID, key string, statusCode int, contentType string, body []byte) error
+	ReleaseKey(userID uuid.UUID, key string) error
+	DeleteExpiredKeys(before time.Time) (int64, error)
+}
+
+// ReserveKey stores a new idempotency key of the user for the request with
+// the given hash. If the user has already used the key, the stored key is
+// returned instead and the boolean result is false. A reservation still in
+// progress after config.IdempotencyReservationTTL is considered abandoned,
+// e.g. by a crashed replica, and is reclaimed for the request.
+func (idempotencyDB *IdempotencyModel) ReserveKey(
+	userID uuid.UUID,
+	key string,
+	requestHash string,
+) (IdempotencyKey, bool, error) {
+	record := IdempotencyKey{UserID: userID, Key: key, RequestHash: requestHash}
+	result := idempotencyDB.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return IdempotencyKey{}, false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return record, true, nil
+	}
+
+	now := time.Now()
+	result = idempotencyDB.DB.Model(&record).
+		Clauses(clause.Returning{}).
+		Where(
+			"user_id = ? AND key = ? AND status_code = 0 AND updated_at < ?",
+			userID,
+			key,
+			now.Add(-config.IdempotencyReservationTTL),
+		).
+		Updates(map[string]interface{}{"request_hash": requestHash, "created_at": now, "updated_at": now})
+	if result.Error != nil {
+		return IdempotencyKey{}, false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return record, true, nil
+	}
+
+	var stored IdempotencyKey
+	result = idempotencyDB.DB.Where(&IdempotencyKey{UserID: userID, Key: key}).Take(&stored)
+	if result.Error != nil {
+		return IdempotencyKey{}, false, result.Error
+	}
+	return stored, false, nil
+}
+
+// CompleteKey stores the response to the request made with the idempotency key.
+func (idempotencyDB *IdempotencyModel) CompleteKey(
+	userID uuid.UUID,
+	key string,
+	statusCode int,
+	contentType string,
+	body []byte,
+) error {
+	result := idempotencyDB.DB.Model(&IdempotencyKey{}).
+		Where("user_id = ? AND key = ?", userID, key).
+		Updates(
+			map[string]interface{}{
+				"status_code":  statusCode,
+				"content_type": contentType,
+				"body":         body,
+			},
+		)
+	return result.Error
+}
+
+// ReleaseKey deletes the idempotency key, so that the request can be retried
+// with the same key.
+func (idempotencyDB *IdempotencyModel) ReleaseKey(userID uuid.UUID, key string) error {
+	result := idempotencyDB.DB.Where("user_id = ? AND key = ?", userID, key).Delete(&IdempotencyKey{})
+	return result.Error
+}
+
+// DeleteExpiredKeys deletes the idempotency keys created before the given
+// time, so that they can be used again.
+// Returns the number of deleted keys.
+func (idempotencyDB *IdempotencyModel) DeleteExpiredKeys(before time.Time) (int64, error) {
+	result := idempotencyDB.DB.Where("created_at < ?", before).Delete(&IdempotencyKey{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,21 @@
+package idempotencydb
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyKey stores the request made with an Idempotency-Key and the
+// response to it. StatusCode is zero while the request is in progress.
+type IdempotencyKey struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	UserID      uuid.UUID `json:"user_id" gorm:"uniqueIndex:idx_idempotency_user_key;not null"`
+	Key         string    `json:"key" gorm:"uniqueIndex:idx_idempotency_user_key;not null"`
+	RequestHash string    `json:"request_hash" gorm:"not null"`
+	StatusCode  int       `json:"status_code" gorm:"not null;default:0"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -4,6 +4,8 @@ import (
 	"log"
 
 	"github.com/elina-chertova/loyalty-system/internal/db/balancedb"
+	"github.com/elina-chertova/loyalty-system/internal/db/campaigndb"
+	"github.com/elina-chertova/loyalty-system/internal/db/idempotencydb"
 	"github.com/elina-chertova/loyalty-system/internal/db/orderdb"
 	"github.com/elina-chertova/loyalty-system/internal/db/userdb"
 	"gorm.io/driver/postgres"
@@ -19,12 +21,36 @@ func Init(databaseDSN string) *gorm.DB {
 	err = db.AutoMigrate(
 		&userdb.User{},
 		&orderdb.Order{},
+		&orderdb.OrderStatusEvent{},
 		&balancedb.Balance{},
 		&balancedb.Withdrawal{},
+		&balancedb.LedgerEntry{},
+		&balancedb.PointLot{},
+		&balancedb.PointLotUsage{},
+		&balancedb.Hold{},
+		&balancedb.Transfer{},
+		&balancedb.UserTier{},
+		&balancedb.TierChange{},
+		&campaigndb.Campaign{},
+		&idempotencydb.IdempotencyKey{},
+		&Migration{},
 	)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
+	err = runOnce(
+		db, MigrationLedgerOpeningBalances, func(tx *gorm.DB) error {
+			return balancedb.NewBalanceModel(tx).BackfillLedger()
+		},
+	)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = balancedb.NewBalanceModel(db).BackfillLots()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	return db
 }
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Migration records a one-shot data migration which has been applied.
+type Migration struct {
+	Name      string    `gorm:"primaryKey"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// Names of the one-shot data migrations.
+const (
+	MigrationLedgerOpeningBalances = "ledger_opening_balances"
+)
+
+// runOnce applies the migration named name in a transaction unless it has been
+// applied before. Concurrently starting replicas wait for the one applying it.
+func runOnce(db *gorm.DB, name string, migrate func(tx *gorm.DB) error) error {
+	return db.Transaction(
+		func(tx *gorm.DB) error {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&Migration{Name: name, AppliedAt: time.Now()})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			return migrate(tx)
+		},
+	)
+}
@@ -0,0 +1,69 @@
+package orderdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// ListenNewOrders subscribes to the notifications AddOrder emits on
+// config.NewOrderChannel and signals wake for each of them. The send is
+// non-blocking, so wake should be buffered; bursts of notifications collapse
+// into a single signal. The listener keeps its own connection, reconnects
+// after failures and returns when ctx is done.
+func ListenNewOrders(ctx context.Context, databaseDSN string, wake chan<- struct{}) {
+	for {
+		err := listen(ctx, databaseDSN, wake)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Logger.Warn(
+			"New orders listener has been disconnected",
+			zap.Error(err),
+			zap.Duration("reconnect_in", config.ListenReconnectInterval),
+		)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(config.ListenReconnectInterval):
+		}
+	}
+}
+
+// listen opens a connection, subscribes to the channel and forwards
+// notifications until the connection fails or ctx is done.
+func listen(ctx context.Context, databaseDSN string, wake chan<- struct{}) error {
+	conn, err := pgx.Connect(ctx, databaseDSN)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{config.NewOrderChannel}.Sanitize()); err != nil {
+		return err
+	}
+	logger.Logger.Info("Listening for new orders", zap.String("channel", config.NewOrderChannel))
+
+	// Orders added while the listener was disconnected are not lost:
+	// wake the worker once so that it picks them up.
+	signal(wake)
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		signal(wake)
+	}
+}
+
+// signal sends to wake unless a signal is already pending.
+func signal(wake chan<- struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
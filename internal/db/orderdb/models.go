@@ -3,16 +3,40 @@ package orderdb
 import (
 	"time"
 
+	"github.com/elina-chertova/loyalty-system/pkg/money"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type Order struct {
 	gorm.Model
-	OrderID   string    `json:"id" gorm:"unique_index"`
-	UserID    uuid.UUID `json:"user_id"`
-	Status    string    `json:"status"`
-	Accrual   float64   `json:"accrual"`
-	Credited  bool      `json:"credited"`
-	CreatedAt time.Time `json:"created_at"`
+	OrderID       string       `json:"id" gorm:"unique_index"`
+	UserID        uuid.UUID    `json:"user_id"`
+	Status        string       `json:"status"`
+	Accrual       money.Points `json:"accrual"`
+	Credited      bool         `json:"credited"`
+	Attempts      int          `json:"attempts" gorm:"not null;default:0"`
+	LastCheckedAt *time.Time   `json:"last_checked_at"`
+	NextCheckAt   time.Time    `json:"next_check_at" gorm:"index;not null;default:CURRENT_TIMESTAMP"`
+	CreatedAt     time.Time    `json:"created_at"`
 }
+
+// OrderStatusEvent records a single transition of an order's status.
+// OldStatus is empty for the event created when the order is uploaded.
+type OrderStatusEvent struct {
+	ID        uint         `json:"id" gorm:"primarykey"`
+	OrderID   string       `json:"order_id" gorm:"index;not null"`
+	OldStatus string       `json:"old_status"`
+	NewStatus string       `json:"new_status" gorm:"not null"`
+	Accrual   money.Points `json:"accrual"`
+	Source    string       `json:"source" gorm:"not null"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// Sources of the order status transitions.
+const (
+	SourceUser     = "user"
+	SourcePoller   = "poller"
+	SourceCallback = "callback"
+	SourceAdmin    = "admin"
+)
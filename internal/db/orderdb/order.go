@@ -5,12 +5,13 @@ package orderdb
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/elina-chertova/loyalty-system/internal/config"
-	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
 	"github.com/google/uuid"
-	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // OrderModel represents the model for order data and provides methods
@@ -27,41 +28,65 @@ func NewOrderModel(db *gorm.DB) *OrderModel {
 // OrderRepository defines the interface for order data operations. It abstracts
 // the methods to interact with the orders in the database.
 type OrderRepository interface {
-	AddOrder(string, uuid.UUID, string, float64) error
+	AddOrder(string, uuid.UUID, string, money.Points) error
 	GetOrderByID(string) (Order, error)
 	GetOrderByUserID(uuid.UUID) ([]Order, error)
-	GetOrderAccrual() ([]UserAccrual, error)
-
 	GetPreparedOrders() ([]OrderAccrual, error)
-	SetProcessedOrders(order []OrderAccrual) error
-	GetTotalAccrualByUsers() ([]UserAccrual, error)
 
-	GetUnprocessedOrders() ([]Order, error)
-	UpdateOrderStatus(orderID string, newStatus string, accrual float64) error
+	GetUnprocessedOrders(afterID uint, limit int) ([]Order, error)
+	GetNextCheckAt() (time.Time, error)
+	UpdateOrderStatus(
+		orderID string,
+		oldStatus string,
+		newStatus string,
+		accrual money.Points,
+		source string,
+	) error
+	ScheduleOrderCheck(orderID string, nextCheckAt time.Time) error
+	GetOrdersByStatus(status string) ([]Order, error)
+	RequeueOrder(orderID string, fromStatus string, toStatus string) error
+	GetOrderStatusEvents(orderID string) ([]OrderStatusEvent, error)
 }
 
-// ErrorDownloadingOrder represents an error encountered while creating an order.
-var ErrorDownloadingOrder = errors.New("order cannot be created")
+// Predefined errors for order data operations.
+var (
+	ErrorDownloadingOrder = errors.New("order cannot be created")
+	ErrorStatusChanged    = errors.New("order status has changed")
+)
 
-// AddOrder adds a new order to the database with the provided details.
+// AddOrder adds a new order to the database with the provided details, records
+// its initial status and notifies the listeners of config.NewOrderChannel once
+// the order is committed.
 // Returns an error if the order cannot be created.
 func (orderDB *OrderModel) AddOrder(
 	orderID string,
 	userID uuid.UUID,
 	status string,
-	accrual float64,
+	accrual money.Points,
 ) error {
-	result := orderDB.DB.Create(
-		&Order{
-			OrderID:  orderID,
-			UserID:   userID,
-			Status:   status,
-			Accrual:  accrual,
-			Credited: false,
+	err := orderDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			result := tx.Create(
+				&Order{
+					OrderID:  orderID,
+					UserID:   userID,
+					Status:   status,
+					Accrual:  accrual,
+					Credited: false,
+				},
+			)
+			if result.Error != nil {
+				return result.Error
+			}
+			err := recordStatusEvent(tx, orderID, "", status, accrual, SourceUser)
+			if err != nil {
+				return err
+			}
+			return tx.Exec("SELECT pg_notify(?, ?)", config.NewOrderChannel, orderID).Error
 		},
 	)
-	if result.Error != nil {
-		return fmt.Errorf("%w: %v", ErrorDownloadingOrder, result.Error)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrorDownloadingOrder, err)
 	}
 	return nil
 }
@@ -89,24 +114,21 @@ func (orderDB *OrderModel) GetOrderByUserID(userID uuid.UUID) ([]Order, error) {
 }
 
 // OrderAccrual represents the accrual data associated with an order.
+// UploadedAt is the time the order was uploaded by the user.
 type OrderAccrual struct {
-	UserID     uuid.UUID `gorm:"column:user_id"`
-	Order      string    `gorm:"column:order_id"`
-	SumAccrual float64   `gorm:"column:accrual"`
+	UserID     uuid.UUID    `gorm:"column:user_id"`
+	Order      string       `gorm:"column:order_id"`
+	SumAccrual money.Points `gorm:"column:accrual"`
+	UploadedAt time.Time    `gorm:"column:created_at"`
 }
 
-// UserAccrual represents the total accrual for a user.
-type UserAccrual struct {
-	UserID     uuid.UUID `gorm:"column:user_id"`
-	SumAccrual float64   `gorm:"column:total_accrual"`
-}
-
-// GetPreparedOrders retrieves prepared orders.
+// GetPreparedOrders retrieves processed orders whose accrual has not been
+// credited to the user's balance yet.
 // Returns the OrderAccrual object and an error if the order is not found.
 func (orderDB *OrderModel) GetPreparedOrders() ([]OrderAccrual, error) {
 	var order []OrderAccrual
 
-	result := orderDB.DB.Table(config.TableOrder).Select("user_id, order_id, accrual").Where(
+	result := orderDB.DB.Table(config.TableOrder).Select("user_id, order_id, accrual, created_at").Where(
 		"credited = ? AND status = ?",
 		false,
 		config.Processed,
@@ -117,97 +139,187 @@ func (orderDB *OrderModel) GetPreparedOrders() ([]OrderAccrual, error) {
 	return order, nil
 }
 
-// GetTotalAccrualByUsers retrieves total accrual.
-// Returns the UserAccrual object and an error if the rows are not found.
-func (orderDB *OrderModel) GetTotalAccrualByUsers() ([]UserAccrual, error) {
-	var userSum []UserAccrual
-	resultUserAccrual := orderDB.DB.Table(config.TableOrder).Select("user_id, SUM(accrual) as total_accrual").Where(
-		"credited = ? AND status = ?",
-		false,
-		config.Processed,
-	).Group("user_id").Find(&userSum)
-	if resultUserAccrual.Error != nil {
-		return []UserAccrual{}, resultUserAccrual.Error
+// GetUnprocessedOrders fetches a batch of orders that are either in 'PROCESSING' or 'NEW' status
+// and are due for the next check.
+// afterID: Only orders with a primary key greater than afterID are returned, which allows
+// the caller to page through the pending orders in ascending ID order.
+// limit: Maximum number of orders in the batch.
+// Returns a slice of Order objects representing unprocessed orders, or an error if the fetch fails.
+func (orderDB *OrderModel) GetUnprocessedOrders(afterID uint, limit int) ([]Order, error) {
+	var orders []Order
+	result := orderDB.DB.Where(
+		"status IN ? AND id > ? AND next_check_at <= ?",
+		[]string{config.Processing, config.New},
+		afterID,
+		time.Now(),
+	).Order("id").Limit(limit).Find(&orders)
+	if result.Error != nil {
+		return []Order{}, result.Error
 	}
-	return userSum, nil
+	return orders, nil
 }
 
-// SetProcessedOrders marks a batch of orders as processed in the database.
-// order: A slice of OrderAccrual representing the orders to be marked as processed.
-// The method updates the 'credited' field of each specified order to 'true'.
-// Returns an error if the update operation fails.
-func (orderDB *OrderModel) SetProcessedOrders(order []OrderAccrual) error {
-	updateResult := orderDB.DB.Table(config.TableOrder).
-		Where("order_id IN ? AND status = ?", getOrderIDs(order), config.Processed).
-		Update("credited", true)
-
-	if updateResult.Error != nil {
-		return updateResult.Error
+// GetNextCheckAt returns the time when the earliest unprocessed order is due
+// for the next check. Returns gorm.ErrRecordNotFound if there are no
+// unprocessed orders.
+func (orderDB *OrderModel) GetNextCheckAt() (time.Time, error) {
+	var order Order
+	result := orderDB.DB.Select("next_check_at").Where(
+		"status IN ?",
+		[]string{config.Processing, config.New},
+	).Order("next_check_at").Take(&order)
+	if result.Error != nil {
+		return time.Time{}, result.Error
 	}
-	return nil
+	return order.NextCheckAt, nil
 }
 
-// GetOrderAccrual retrieves accrual information for each user based on their orders.
-// It first fetches prepared orders, then calculates total accruals by users,
-// and finally marks the processed orders as credited.
-// Returns a slice of UserAccrual containing accrual information for each user, or an error.
-func (orderDB *OrderModel) GetOrderAccrual() ([]UserAccrual, error) {
-	order, err := orderDB.GetPreparedOrders()
-	if err != nil {
-		return []UserAccrual{}, err
-	}
+// UpdateOrderStatus updates the status and accrual of an order identified by orderID
+// and records the transition in the order's status history. The order is
+// updated only if it is still in oldStatus, so concurrent updates cannot
+// overwrite each other.
+// orderID: Identifier of the order to be updated.
+// oldStatus: Status of the order the transition starts from.
+// newStatus: New status to be set for the order.
+// accrual: Accrual amount to be updated for the order.
+// source: Source of the transition, one of the Source constants.
+// Returns gorm.ErrRecordNotFound if there is no such order, ErrorStatusChanged
+// if the order is not in oldStatus anymore, or an error if the update operation fails.
+func (orderDB *OrderModel) UpdateOrderStatus(
+	orderID string,
+	oldStatus string,
+	newStatus string,
+	accrual money.Points,
+	source string,
+) error {
+	return orderDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			order, err := lockOrder(tx, orderID)
+			if err != nil {
+				return err
+			}
+			if order.Status != oldStatus {
+				return ErrorStatusChanged
+			}
 
-	userSum, err := orderDB.GetTotalAccrualByUsers()
-	if err != nil {
-		logger.Logger.Warn("Error in GetTotalAccrualByUsers", zap.Error(err))
-		return []UserAccrual{}, err
-	}
-	err = orderDB.SetProcessedOrders(order)
-	if err != nil {
-		logger.Logger.Warn("Error in SetProcessedOrders", zap.Error(err))
-		return []UserAccrual{}, err
-	}
+			result := tx.Model(&Order{}).Where("order_id = ?", orderID).Updates(
+				map[string]interface{}{
+					"status":          newStatus,
+					"accrual":         accrual,
+					"last_checked_at": time.Now(),
+				},
+			)
+			if result.Error != nil {
+				return result.Error
+			}
 
-	return userSum, nil
+			if order.Status == newStatus && order.Accrual == accrual {
+				return nil
+			}
+			return recordStatusEvent(tx, orderID, order.Status, newStatus, accrual, source)
+		},
+	)
 }
 
-// getOrderIDs extracts and returns a slice of order IDs from a slice of OrderAccrual.
-// orders: A slice of OrderAccrual from which the order IDs are to be extracted.
-func getOrderIDs(orders []OrderAccrual) []string {
-	var orderIDs []string
-	for _, o := range orders {
-		orderIDs = append(orderIDs, o.Order)
+// ScheduleOrderCheck records an unsuccessful check of an order: it increments
+// the number of attempts and postpones the next check until nextCheckAt.
+// Returns an error if the update operation fails.
+func (orderDB *OrderModel) ScheduleOrderCheck(orderID string, nextCheckAt time.Time) error {
+	result := orderDB.DB.Model(&Order{}).Where("order_id = ?", orderID).Updates(
+		map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_checked_at": time.Now(),
+			"next_check_at":   nextCheckAt,
+		},
+	)
+	if result.Error != nil {
+		return result.Error
 	}
-	return orderIDs
+	return nil
 }
 
-// GetUnprocessedOrders fetches orders that are either in 'PROCESSING' or 'NEW' status.
-// Returns a slice of Order objects representing unprocessed orders, or an error if the fetch fails.
-func (orderDB *OrderModel) GetUnprocessedOrders() ([]Order, error) {
+// GetOrdersByStatus retrieves all orders with the given status, oldest first.
+// Returns a slice of Order objects, or an error if the fetch fails.
+func (orderDB *OrderModel) GetOrdersByStatus(status string) ([]Order, error) {
 	var orders []Order
-	result := orderDB.DB.Where("status IN ?", []string{"PROCESSING", "NEW"}).First(&orders)
+	result := orderDB.DB.Where(&Order{Status: status}).Order("id").Find(&orders)
 	if result.Error != nil {
 		return []Order{}, result.Error
 	}
 	return orders, nil
 }
 
-// UpdateOrderStatus updates the status and accrual of an order identified by orderID.
-// orderID: Identifier of the order to be updated.
-// newStatus: New status to be set for the order.
-// accrual: Accrual amount to be updated for the order.
-// Returns an error if the update operation fails.
-func (orderDB *OrderModel) UpdateOrderStatus(
+// RequeueOrder moves an order from fromStatus to toStatus, resets its attempts
+// and makes it due for an immediate check. Requeueing is an administrative
+// action, so the transition is recorded with SourceAdmin.
+// Returns gorm.ErrRecordNotFound if there is no such order in fromStatus.
+func (orderDB *OrderModel) RequeueOrder(orderID string, fromStatus string, toStatus string) error {
+	return orderDB.DB.Transaction(
+		func(tx *gorm.DB) error {
+			order, err := lockOrder(tx, orderID)
+			if err != nil {
+				return err
+			}
+			if order.Status != fromStatus {
+				return gorm.ErrRecordNotFound
+			}
+
+			result := tx.Model(&Order{}).Where("order_id = ?", orderID).Updates(
+				map[string]interface{}{
+					"status":        toStatus,
+					"attempts":      0,
+					"next_check_at": time.Now(),
+				},
+			)
+			if result.Error != nil {
+				return result.Error
+			}
+			return recordStatusEvent(tx, orderID, fromStatus, toStatus, order.Accrual, SourceAdmin)
+		},
+	)
+}
+
+// GetOrderStatusEvents retrieves the status history of an order, oldest first.
+// Returns a slice of OrderStatusEvent objects, or an error if the fetch fails.
+func (orderDB *OrderModel) GetOrderStatusEvents(orderID string) ([]OrderStatusEvent, error) {
+	var events []OrderStatusEvent
+	result := orderDB.DB.Where(&OrderStatusEvent{OrderID: orderID}).Order("id").Find(&events)
+	if result.Error != nil {
+		return []OrderStatusEvent{}, result.Error
+	}
+	return events, nil
+}
+
+// lockOrder reads the order identified by orderID and locks its row until
+// the end of the transaction tx.
+func lockOrder(tx *gorm.DB, orderID string) (Order, error) {
+	var order Order
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ?", orderID).
+		Take(&order)
+	if result.Error != nil {
+		return Order{}, result.Error
+	}
+	return order, nil
+}
+
+// recordStatusEvent adds a status transition of an order to its history
+// within the transaction tx.
+func recordStatusEvent(
+	tx *gorm.DB,
 	orderID string,
+	oldStatus string,
 	newStatus string,
-	accrual float64,
+	accrual money.Points,
+	source string,
 ) error {
-	result := orderDB.DB.Model(&Order{}).Where("order_id = ?", orderID).Update(
-		"status",
-		newStatus,
-	).Update("accrual", accrual)
-	if result.Error != nil {
-		return result.Error
-	}
-	return nil
+	return tx.Create(
+		&OrderStatusEvent{
+			OrderID:   orderID,
+			OldStatus: oldStatus,
+			NewStatus: newStatus,
+			Accrual:   accrual,
+			Source:    source,
+		},
+	).Error
 }
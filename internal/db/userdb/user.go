@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -25,6 +26,7 @@ func NewUserModel(db *gorm.DB) *UserModel {
 type UserRepository interface {
 	AddUser(string, string, bool) error
 	GetUserByName(string) (User, error)
+	GetUserByID(uuid.UUID) (User, error)
 }
 
 // AddUser adds a new user to the database with the provided name, password, and admin status.
@@ -47,3 +49,14 @@ func (userDB *UserModel) GetUserByName(name string) (User, error) {
 	}
 	return u, nil
 }
+
+// GetUserByID retrieves a user by their ID from the database.
+// Returns the User object and an error if the user is not found.
+func (userDB *UserModel) GetUserByID(userID uuid.UUID) (User, error) {
+	var u User
+	result := userDB.DB.Where("id = ?", userID).First(&u)
+	if result.Error != nil {
+		return User{}, result.Error
+	}
+	return u, nil
+}
@@ -3,19 +3,32 @@ package internal
 import (
 	handlersUser "github.com/elina-chertova/loyalty-system/internal/auth/handlers"
 	handlersBal "github.com/elina-chertova/loyalty-system/internal/balance/handlers"
+	handlersCamp "github.com/elina-chertova/loyalty-system/internal/campaign/handlers"
 	handlersOrd "github.com/elina-chertova/loyalty-system/internal/order/handlers"
 )
 
 type handlers struct {
-	User    *handlersUser.AuthHandler
-	Order   *handlersOrd.OrderHandler
-	Balance *handlersBal.BalanceHandler
+	User     *handlersUser.AuthHandler
+	Order    *handlersOrd.OrderHandler
+	Balance  *handlersBal.BalanceHandler
+	Accrual  *handlersOrd.AccrualHandler
+	Admin    *handlersOrd.AdminOrderHandler
+	Callback *handlersOrd.CallbackHandler
+
+	AdminBalance *handlersBal.AdminBalanceHandler
+	Campaign     *handlersCamp.CampaignHandler
 }
 
 func NewHandlers(s *services) *handlers {
 	return &handlers{
-		User:    handlersUser.NewAuthHandler(s.Balance, s.User),
-		Order:   handlersOrd.NewOrderHandler(s.Order),
-		Balance: handlersBal.NewBalanceHandler(s.Balance),
+		User:     handlersUser.NewAuthHandler(s.Balance, s.User),
+		Order:    handlersOrd.NewOrderHandler(s.Order),
+		Balance:  handlersBal.NewBalanceHandler(s.Balance),
+		Accrual:  handlersOrd.NewAccrualHandler(s.Poller),
+		Admin:    handlersOrd.NewAdminOrderHandler(s.Order),
+		Callback: handlersOrd.NewCallbackHandler(s.Order),
+
+		AdminBalance: handlersBal.NewAdminBalanceHandler(s.Balance),
+		Campaign:     handlersCamp.NewCampaignHandler(s.Campaign),
 	}
 }
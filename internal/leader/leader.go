@@ -0,0 +1,126 @@
+// Package leader provides leader election between replicas of the loyalty
+// system, so that background jobs run on exactly one of them.
+//
+// The leader holds a session-level Postgres advisory lock on a dedicated
+// connection. Postgres releases the lock as soon as that session ends, so
+// when the leader dies or loses its connection another replica acquires
+// the lock on its next attempt and takes over.
+package leader
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Elector campaigns for leadership with a Postgres advisory lock.
+type Elector struct {
+	databaseDSN string
+	lockKey     int64
+	interval    time.Duration
+	leader      atomic.Bool
+}
+
+// NewElector creates a new Elector. All replicas must use the same lockKey.
+// interval defines how often a follower tries to acquire the lock and how
+// often the leader checks that its session is still alive.
+func NewElector(databaseDSN string, lockKey int64, interval time.Duration) *Elector {
+	return &Elector{databaseDSN: databaseDSN, lockKey: lockKey, interval: interval}
+}
+
+// IsLeader reports whether this replica currently holds the leadership.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run campaigns for leadership until ctx is done. Every time this replica
+// becomes the leader, lead is started with a context which is cancelled when
+// the leadership is lost. Run waits for lead to return before campaigning
+// again, so lead never runs twice at the same time.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	for {
+		err := e.campaign(ctx, lead)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Logger.Warn("Leader election connection failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.interval):
+		}
+	}
+}
+
+// campaign opens a session, waits until it acquires the lock and leads
+// until the session fails or ctx is done.
+func (e *Elector) campaign(ctx context.Context, lead func(ctx context.Context)) error {
+	conn, err := pgx.Connect(ctx, e.databaseDSN)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	for {
+		var acquired bool
+		err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", e.lockKey).Scan(&acquired)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(e.interval):
+		}
+	}
+
+	return e.hold(ctx, conn, lead)
+}
+
+// hold runs lead while the session holding the lock is alive.
+func (e *Elector) hold(ctx context.Context, conn *pgx.Conn, lead func(ctx context.Context)) error {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		lead(leaderCtx)
+	}()
+
+	e.leader.Store(true)
+	logger.Logger.Info("Leadership acquired", zap.Int64("lock_key", e.lockKey))
+	defer func() {
+		cancel()
+		wg.Wait()
+		e.leader.Store(false)
+		logger.Logger.Info("Leadership released", zap.Int64("lock_key", e.lockKey))
+	}()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			unlockCtx, unlockCancel := context.WithTimeout(context.Background(), e.interval)
+			defer unlockCancel()
+			_, err := conn.Exec(unlockCtx, "SELECT pg_advisory_unlock($1)", e.lockKey)
+			return err
+		case <-ticker.C:
+			if err := conn.Ping(ctx); err != nil && ctx.Err() == nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package leader
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElector_Failover(t *testing.T) {
+	databaseDSN := os.Getenv("TEST_DATABASE_URI")
+	if databaseDSN == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+
+	const lockKey = 424242
+	var leaders int32
+	lead := func(ctx context.Context) {
+		assert.Equal(t, int32(1), atomic.AddInt32(&leaders, 1), "only one replica leads")
+		<-ctx.Done()
+		atomic.AddInt32(&leaders, -1)
+	}
+
+	first := NewElector(databaseDSN, lockKey, 50*time.Millisecond)
+	second := NewElector(databaseDSN, lockKey, 50*time.Millisecond)
+
+	firstCtx, stopFirst := context.WithCancel(context.Background())
+	defer stopFirst()
+	go first.Run(firstCtx, lead)
+	assert.Eventually(t, first.IsLeader, time.Second, 10*time.Millisecond)
+
+	secondCtx, stopSecond := context.WithCancel(context.Background())
+	defer stopSecond()
+	go second.Run(secondCtx, lead)
+	time.Sleep(200 * time.Millisecond)
+	assert.False(t, second.IsLeader())
+
+	stopFirst()
+	assert.Eventually(t, second.IsLeader, time.Second, 10*time.Millisecond)
+	assert.False(t, first.IsLeader())
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/elina-chertova/loyalty-system/internal/order/service"
+	"github.com/gin-gonic/gin"
+)
+
+type AccrualStatusService interface {
+	Status() service.AccrualStatus
+}
+
+type AccrualHandler struct {
+	Accrual AccrualStatusService
+}
+
+func NewAccrualHandler(accrual AccrualStatusService) *AccrualHandler {
+	return &AccrualHandler{Accrual: accrual}
+}
+
+// StatusHandler reports the state of the communication with the accrual
+// system: whether outgoing requests are paused because of throttling and
+// the state of the circuit breaker. Together with /api/user/ping it tells
+// an unavailable accrual system apart from an unavailable database.
+// Only administrators can see it.
+func (accrual *AccrualHandler) StatusHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.IndentedJSON(http.StatusOK, accrual.Accrual.Status())
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/elina-chertova/loyalty-system/internal/auth/handlers"
+	"github.com/elina-chertova/loyalty-system/internal/order/service"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type AdminOrderService interface {
+	GetStuckOrders() ([]service.AdminOrderFormat, error)
+	RequeueOrder(orderID string) error
+}
+
+type AdminOrderHandler struct {
+	Order AdminOrderService
+}
+
+func NewAdminOrderHandler(order AdminOrderService) *AdminOrderHandler {
+	return &AdminOrderHandler{Order: order}
+}
+
+// GetStuckOrdersHandler lists the orders which exceeded the maximum number
+// of checks against the accrual system.
+func (order *AdminOrderHandler) GetStuckOrdersHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orders, err := order.Order.GetStuckOrders()
+		if err != nil {
+			logger.Logger.Error(
+				"Server error",
+				zap.String("endpoint", c.Request.URL.Path),
+				zap.Error(err),
+			)
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError, handlers.Response{
+					Message: err.Error(),
+					Status:  "Server error",
+				},
+			)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, orders)
+	}
+}
+
+// RequeueOrderHandler returns a stuck order to the accrual poller queue.
+func (order *AdminOrderHandler) RequeueOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := order.Order.RequeueOrder(c.Param("number"))
+		switch {
+		case errors.Is(err, service.ErrorOrderNotStuck):
+			c.AbortWithStatusJSON(
+				http.StatusNotFound, handlers.Response{
+					Message: err.Error(),
+					Status:  "Order is not stuck",
+				},
+			)
+			return
+		case err != nil:
+			logger.Logger.Error(
+				"Server error",
+				zap.String("endpoint", c.Request.URL.Path),
+				zap.Error(err),
+			)
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError, handlers.Response{
+					Message: err.Error(),
+					Status:  "Server error",
+				},
+			)
+			return
+		}
+
+		c.IndentedJSON(
+			http.StatusOK, handlers.Response{
+				Message: "Order is requeued",
+				Status:  "OK",
+			},
+		)
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/elina-chertova/loyalty-system/internal/auth/handlers"
+	"github.com/elina-chertova/loyalty-system/internal/order/service"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type AccrualCallbackService interface {
+	ApplyAccrualCallback(results []service.OrderLoyaltyFormat) (service.CallbackResult, error)
+}
+
+type CallbackHandler struct {
+	Order AccrualCallbackService
+}
+
+func NewCallbackHandler(order AccrualCallbackService) *CallbackHandler {
+	return &CallbackHandler{Order: order}
+}
+
+var ErrorEmptyCallback = errors.New("callback has no accrual results")
+
+// AccrualCallbackHandler accepts accrual results pushed by the accrual system.
+// The body is either a single OrderLoyaltyFormat object or an array of them.
+// The request must be authenticated with middleware.SignatureAuth.
+func (callback *CallbackHandler) AccrualCallbackHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := c.GetRawData()
+		if err != nil {
+			handleCallbackError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		results, err := decodeAccrualResults(body)
+		if err != nil {
+			handleCallbackError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		result, err := callback.Order.ApplyAccrualCallback(results)
+		if errors.Is(err, service.ErrorEmptyAccrualResult) {
+			handleCallbackError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			handleCallbackError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		logger.Logger.Info(
+			"Accrual callback applied",
+			zap.Int("applied", result.Applied),
+			zap.Int("skipped", result.Skipped),
+			zap.Strings("unknown", result.Unknown),
+		)
+		c.IndentedJSON(http.StatusOK, result)
+	}
+}
+
+func handleCallbackError(c *gin.Context, statusCode int, err error) {
+	status := "Server error"
+	if statusCode == http.StatusBadRequest {
+		status = "Wrong entered data"
+	}
+	logger.Logger.Error(
+		status,
+		zap.String("endpoint", c.Request.URL.Path),
+		zap.Error(err),
+	)
+	c.AbortWithStatusJSON(
+		statusCode, handlers.Response{
+			Message: err.Error(),
+			Status:  status,
+		},
+	)
+}
+
+// decodeAccrualResults decodes a single accrual result or a batch of them.
+func decodeAccrualResults(body []byte) ([]service.OrderLoyaltyFormat, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, ErrorEmptyCallback
+	}
+
+	if body[0] != '[' {
+		var result service.OrderLoyaltyFormat
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
+		return []service.OrderLoyaltyFormat{result}, nil
+	}
+
+	var results []service.OrderLoyaltyFormat
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, ErrorEmptyCallback
+	}
+	return results, nil
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elina-chertova/loyalty-system/internal/auth/middleware"
+	"github.com/elina-chertova/loyalty-system/internal/order/service"
+	"github.com/elina-chertova/loyalty-system/internal/security"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockCallbackService struct {
+	Results []service.OrderLoyaltyFormat
+}
+
+func (m *MockCallbackService) ApplyAccrualCallback(
+	results []service.OrderLoyaltyFormat,
+) (service.CallbackResult, error) {
+	m.Results = append(m.Results, results...)
+	return service.CallbackResult{Applied: len(results)}, nil
+}
+
+func TestCallbackHandler_AccrualCallbackHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const secret = "callback-secret"
+
+	tests := []struct {
+		name        string
+		body        string
+		signature   string
+		wantCode    int
+		wantResults int
+	}{
+		{
+			name:        "Single result",
+			body:        `{"order": "79927398713", "status": "PROCESSED", "accrual": 500}`,
+			wantCode:    http.StatusOK,
+			wantResults: 1,
+		},
+		{
+			name:        "Batch",
+			body:        `[{"order": "79927398713", "status": "PROCESSED"}, {"order": "12345678903", "status": "INVALID"}]`,
+			wantCode:    http.StatusOK,
+			wantResults: 2,
+		},
+		{
+			name:      "Wrong signature",
+			body:      `{"order": "79927398713", "status": "PROCESSED"}`,
+			signature: security.SignPayload("other", []byte(`{"order": "79927398713", "status": "PROCESSED"}`)),
+			wantCode:  http.StatusUnauthorized,
+		},
+		{name: "Empty batch", body: `[]`, wantCode: http.StatusBadRequest},
+		{name: "Malformed", body: `{"order":`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				mock := &MockCallbackService{}
+				router := gin.New()
+				router.POST(
+					"/api/internal/accrual/callback",
+					middleware.SignatureAuth(secret),
+					NewCallbackHandler(mock).AccrualCallbackHandler(),
+				)
+
+				signature := tt.signature
+				if signature == "" {
+					signature = security.SignPayload(secret, []byte(tt.body))
+				}
+				req := httptest.NewRequest(
+					http.MethodPost,
+					"/api/internal/accrual/callback",
+					bytes.NewBufferString(tt.body),
+				)
+				req.Header.Set(middleware.SignatureHeader, signature)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.wantCode, w.Code)
+				assert.Len(t, mock.Results, tt.wantResults)
+			},
+		)
+	}
+}
@@ -16,6 +16,7 @@ import (
 type OrderService interface {
 	LoadOrder(token string, orderID string) (*service.LoadOrderResult, error)
 	GetOrders(token string) ([]service.UserOrderFormat, error)
+	GetOrderHistory(token string, orderID string) ([]service.OrderStatusEventFormat, error)
 }
 
 type OrderHandler struct {
@@ -33,6 +34,7 @@ func NewOrderHandler(orderAuth OrderService) *OrderHandler {
 // @Accept json
 // @Produce json
 // @Param order_id path string true "Order ID"
+// @Param Idempotency-Key header string false "Idempotency key of the request"
 // @Success 200 {object} Response
 // @Success 202 {object} Response
 // @Failure 400 {object} Response
@@ -136,6 +138,62 @@ func (order *OrderHandler) GetOrdersHandler() gin.HandlerFunc {
 	}
 }
 
+// GetOrderHistoryHandler @Get Order Status History
+// @Description Get Order Status History
+// @ID get-order-history
+// @Tags Order
+// @Accept json
+// @Produce json
+// @Param number path string true "Order Number"
+// @Success 200 {object} []service.OrderStatusEventFormat
+// @Failure 401 {object} Response
+// @Failure 404 {object} Response
+// @Failure 500 {object} Response
+// @Router /orders/{number}/history [get]
+func (order *OrderHandler) GetOrderHistoryHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, exists := c.Get("token")
+		if !exists {
+			c.JSON(
+				http.StatusUnauthorized,
+				handlers.Response{
+					Message: "Token not found",
+					Status:  "Unauthorized",
+				},
+			)
+			return
+		}
+
+		tokenStr := fmt.Sprintf("%v", token)
+		history, err := order.Order.GetOrderHistory(tokenStr, c.Param("number"))
+		if errors.Is(err, service.ErrorOrderNotFound) {
+			c.AbortWithStatusJSON(
+				http.StatusNotFound, handlers.Response{
+					Message: err.Error(),
+					Status:  "Not found",
+				},
+			)
+			return
+		}
+		if err != nil {
+			logger.Logger.Error(
+				"Server error",
+				zap.String("endpoint", c.Request.URL.Path),
+				zap.Error(err),
+			)
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError, handlers.Response{
+					Message: err.Error(),
+					Status:  "Server error",
+				},
+			)
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, history)
+	}
+}
+
 func handleLoadOrderError(c *gin.Context, err error) {
 	switch {
 	case errors.Is(err, service.ErrorNotValidOrderNumber):
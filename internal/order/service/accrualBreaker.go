@@ -0,0 +1,40 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elina-chertova/loyalty-system/pkg/breaker"
+)
+
+// ErrorAccrualCircuitOpen is returned instead of calling the accrual system
+// while its circuit breaker is open.
+var ErrorAccrualCircuitOpen = errors.New("accrual system circuit breaker is open")
+
+// BreakerAccrualClient is an AccrualClient which guards another AccrualClient
+// with a circuit breaker. Transport errors and 5xx responses count as failures;
+// any other answer proves the accrual system is up.
+type BreakerAccrualClient struct {
+	client  AccrualClient
+	breaker *breaker.Breaker
+}
+
+// NewBreakerAccrualClient wraps client with the circuit breaker b.
+func NewBreakerAccrualClient(client AccrualClient, b *breaker.Breaker) *BreakerAccrualClient {
+	return &BreakerAccrualClient{client: client, breaker: b}
+}
+
+// GetOrderAccrual calls the wrapped client unless the circuit breaker is open.
+func (client *BreakerAccrualClient) GetOrderAccrual(orderID string) (OrderLoyaltyFormat, error) {
+	if err := client.breaker.Allow(); err != nil {
+		return OrderLoyaltyFormat{}, fmt.Errorf("%w: %v", ErrorAccrualCircuitOpen, err)
+	}
+
+	order, err := client.client.GetOrderAccrual(orderID)
+	if errors.Is(err, ErrorAccrualUnavailable) {
+		client.breaker.Failure()
+	} else {
+		client.breaker.Success()
+	}
+	return order, err
+}
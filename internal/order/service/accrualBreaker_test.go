@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/pkg/breaker"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccrualPoller_PollCircuitBreaker(t *testing.T) {
+	fake := NewFakeAccrualClient()
+	fake.SetDefault(FakeAccrualResponse{StatusCode: http.StatusServiceUnavailable})
+
+	mockRepo := NewMockOrderRepository()
+	userID := uuid.New()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, mockRepo.AddOrder(strconv.Itoa(i), userID, "NEW", 0.0))
+	}
+
+	accrualBreaker := breaker.New("accrual", breaker.Settings{FailureThreshold: 2, OpenTimeout: time.Hour})
+	userOrder := NewOrder(mockRepo, NewBreakerAccrualClient(fake, accrualBreaker))
+	poller := NewAccrualPoller(userOrder, accrualBreaker, 1, 10)
+
+	assert.ErrorIs(t, poller.Poll(), ErrorAccrualCircuitOpen)
+	assert.Equal(t, 2, fake.TotalCalls())
+	assert.Equal(t, breaker.StateOpen, accrualBreaker.State())
+
+	attempts := 0
+	for _, order := range mockRepo.Orders {
+		attempts += order.Attempts
+	}
+	assert.Equal(t, 2, attempts, "short-circuited checks are not counted as attempts")
+
+	assert.ErrorIs(t, poller.Poll(), ErrorAccrualCircuitOpen)
+	assert.Equal(t, 2, fake.TotalCalls())
+
+	status := poller.Status()
+	if assert.NotNil(t, status.Breaker) {
+		assert.Equal(t, "open", status.Breaker.State)
+	}
+}
+
+func TestBreakerAccrualClient_GetOrderAccrual(t *testing.T) {
+	fake := NewFakeAccrualClient()
+	fake.Script("1", FakeAccrualResponse{StatusCode: http.StatusBadGateway})
+	fake.Script("2", FakeAccrualResponse{StatusCode: http.StatusNoContent})
+
+	accrualBreaker := breaker.New("accrual", breaker.Settings{FailureThreshold: 2, OpenTimeout: time.Hour})
+	client := NewBreakerAccrualClient(fake, accrualBreaker)
+
+	_, err := client.GetOrderAccrual("1")
+	assert.ErrorIs(t, err, ErrorAccrualUnavailable)
+	_, err = client.GetOrderAccrual("2")
+	assert.ErrorIs(t, err, ErrorOrderNotRegistered)
+	_, err = client.GetOrderAccrual("1")
+	assert.ErrorIs(t, err, ErrorAccrualUnavailable)
+	assert.Equal(t, breaker.StateClosed, accrualBreaker.State(), "204 proves the accrual system is up")
+
+	_, _ = client.GetOrderAccrual("1")
+	assert.Equal(t, breaker.StateOpen, accrualBreaker.State())
+	_, err = client.GetOrderAccrual("2")
+	assert.ErrorIs(t, err, ErrorAccrualCircuitOpen)
+	assert.Equal(t, 1, fake.Calls("2"))
+}
+
+func TestBreakerAccrualClient_TransportError(t *testing.T) {
+	fake := NewFakeAccrualClient()
+	fake.SetDefault(FakeAccrualResponse{Err: errors.New("connection refused")})
+
+	accrualBreaker := breaker.New("accrual", breaker.Settings{FailureThreshold: 2, OpenTimeout: time.Hour})
+	client := NewBreakerAccrualClient(fake, accrualBreaker)
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetOrderAccrual("1")
+		assert.ErrorIs(t, err, ErrorAccrualUnavailable)
+	}
+	assert.Equal(t, breaker.StateOpen, accrualBreaker.State(), "transport errors trip the breaker")
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/levigross/grequests"
+)
+
+// AccrualClient abstracts the communication with the external accrual system.
+type AccrualClient interface {
+	// GetOrderAccrual returns the accrual information for the given order.
+	// It returns ErrorOrderNotRegistered when the accrual system does not know
+	// the order and *ThrottledError when the accrual system throttles requests.
+	GetOrderAccrual(orderID string) (OrderLoyaltyFormat, error)
+}
+
+// Predefined errors for accrual system responses.
+var (
+	ErrorOrderNotRegistered      = errors.New("order is not registered in the accrual system")
+	ErrorAccrualUnavailable      = errors.New("accrual system is unavailable")
+	ErrorUnexpectedAccrualStatus = errors.New("unexpected accrual system response")
+)
+
+// HTTPAccrualClient is an AccrualClient talking to the accrual system over HTTP.
+type HTTPAccrualClient struct {
+	endpoint string
+}
+
+// NewHTTPAccrualClient creates a new HTTPAccrualClient for the accrual system
+// running on accrualServerAddress.
+func NewHTTPAccrualClient(accrualServerAddress string) *HTTPAccrualClient {
+	return &HTTPAccrualClient{
+		endpoint: fmt.Sprintf(config.AccrualSystemAddress, accrualServerAddress),
+	}
+}
+
+// GetOrderAccrual requests GET /api/orders/{number} from the accrual system.
+func (client *HTTPAccrualClient) GetOrderAccrual(orderID string) (OrderLoyaltyFormat, error) {
+	response, err := grequests.Get(
+		client.endpoint+orderID,
+		&grequests.RequestOptions{RequestTimeout: config.AccrualRequestTimeout},
+	)
+	if err != nil {
+		return OrderLoyaltyFormat{}, fmt.Errorf("%w: %v", ErrorAccrualUnavailable, err)
+	}
+	defer response.Close()
+
+	return decodeAccrualResponse(response.StatusCode, response.Header, response.Bytes())
+}
+
+// decodeAccrualResponse converts a raw accrual system response into
+// an OrderLoyaltyFormat or one of the accrual errors.
+func decodeAccrualResponse(
+	statusCode int,
+	header http.Header,
+	body []byte,
+) (OrderLoyaltyFormat, error) {
+	switch {
+	case statusCode == http.StatusOK:
+		var orderLoyalty OrderLoyaltyFormat
+		if err := json.Unmarshal(body, &orderLoyalty); err != nil {
+			return OrderLoyaltyFormat{}, fmt.Errorf("%w: %v", ErrorUnexpectedAccrualStatus, err)
+		}
+		return orderLoyalty, nil
+	case statusCode == http.StatusNoContent:
+		return OrderLoyaltyFormat{}, ErrorOrderNotRegistered
+	case statusCode == http.StatusTooManyRequests:
+		return OrderLoyaltyFormat{}, &ThrottledError{
+			RetryAfter: parseRetryAfter(header.Get("Retry-After")),
+		}
+	case statusCode >= http.StatusInternalServerError:
+		return OrderLoyaltyFormat{}, fmt.Errorf("%w: %d", ErrorAccrualUnavailable, statusCode)
+	default:
+		return OrderLoyaltyFormat{}, fmt.Errorf("%w: %d", ErrorUnexpectedAccrualStatus, statusCode)
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPAccrualClient_GetOrderAccrual(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimPrefix(r.URL.Path, "/api/orders/") {
+				case "1":
+					w.Header().Set("Content-Type", "application/json")
+					_, _ = w.Write([]byte(`{"order": "1", "status": "PROCESSED", "accrual": 500}`))
+				case "2":
+					w.WriteHeader(http.StatusNoContent)
+				case "3":
+					w.Header().Set("Retry-After", "7")
+					w.WriteHeader(http.StatusTooManyRequests)
+				default:
+					w.WriteHeader(http.StatusBadGateway)
+				}
+			},
+		),
+	)
+	defer server.Close()
+
+	client := NewHTTPAccrualClient(server.URL)
+
+	order, err := client.GetOrderAccrual("1")
+	assert.NoError(t, err)
+	assert.Equal(t, OrderLoyaltyFormat{Order: "1", Status: "PROCESSED", Accrual: money.FromFloat(500)}, order)
+
+	_, err = client.GetOrderAccrual("2")
+	assert.ErrorIs(t, err, ErrorOrderNotRegistered)
+
+	_, err = client.GetOrderAccrual("3")
+	var throttled *ThrottledError
+	if assert.ErrorAs(t, err, &throttled) {
+		assert.Equal(t, 7*time.Second, throttled.RetryAfter)
+	}
+
+	_, err = client.GetOrderAccrual("4")
+	assert.ErrorIs(t, err, ErrorAccrualUnavailable)
+}
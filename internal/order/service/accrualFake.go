@@ -0,0 +1,96 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// FakeAccrualResponse is a scripted answer of FakeAccrualClient.
+type FakeAccrualResponse struct {
+	StatusCode int
+	Body       string
+	Header     http.Header
+	Latency    time.Duration
+	// Err simulates a transport error. When set, StatusCode and Body are ignored
+	// and Err is wrapped into ErrorAccrualUnavailable like HTTPAccrualClient does it.
+	Err error
+}
+
+// FakeAccrualClient is an in-memory AccrualClient for tests. Responses are
+// scripted per order and decoded exactly like HTTPAccrualClient does it.
+type FakeAccrualClient struct {
+	mu         sync.Mutex
+	scripts    map[string][]FakeAccrualResponse
+	fallback   FakeAccrualResponse
+	calls      map[string]int
+	totalCalls int
+}
+
+// NewFakeAccrualClient creates a FakeAccrualClient which answers
+// 204 No Content for every order that has not been scripted.
+func NewFakeAccrualClient() *FakeAccrualClient {
+	return &FakeAccrualClient{
+		scripts:  make(map[string][]FakeAccrualResponse),
+		fallback: FakeAccrualResponse{StatusCode: http.StatusNoContent},
+		calls:    make(map[string]int),
+	}
+}
+
+// Script queues responses for the given order. They are returned one per call
+// in the given order, the last one is repeated once the queue is exhausted.
+func (fake *FakeAccrualClient) Script(orderID string, responses ...FakeAccrualResponse) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.scripts[orderID] = append(fake.scripts[orderID], responses...)
+}
+
+// SetDefault sets the response for orders that have not been scripted.
+func (fake *FakeAccrualClient) SetDefault(response FakeAccrualResponse) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.fallback = response
+}
+
+// Calls returns how many times the given order has been requested.
+func (fake *FakeAccrualClient) Calls(orderID string) int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return fake.calls[orderID]
+}
+
+// TotalCalls returns how many requests have been made in total.
+func (fake *FakeAccrualClient) TotalCalls() int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return fake.totalCalls
+}
+
+// GetOrderAccrual returns the next scripted response for the order.
+func (fake *FakeAccrualClient) GetOrderAccrual(orderID string) (OrderLoyaltyFormat, error) {
+	fake.mu.Lock()
+	response := fake.fallback
+	if queue := fake.scripts[orderID]; len(queue) > 0 {
+		response = queue[0]
+		if len(queue) > 1 {
+			fake.scripts[orderID] = queue[1:]
+		}
+	}
+	fake.calls[orderID]++
+	fake.totalCalls++
+	fake.mu.Unlock()
+
+	if response.Latency > 0 {
+		time.Sleep(response.Latency)
+	}
+	if response.Err != nil {
+		return OrderLoyaltyFormat{}, fmt.Errorf("%w: %v", ErrorAccrualUnavailable, response.Err)
+	}
+
+	header := response.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	return decodeAccrualResponse(response.StatusCode, header, []byte(response.Body))
+}
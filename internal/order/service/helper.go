@@ -3,62 +3,137 @@
 package service
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/http"
+	"errors"
+	"time"
 
 	"github.com/elina-chertova/loyalty-system/internal/config"
-	"github.com/levigross/grequests"
+	"github.com/elina-chertova/loyalty-system/internal/db/orderdb"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 // OrderLoyaltyFormat defines the format for loyalty data associated with an order.
 type OrderLoyaltyFormat struct {
-	Order   string  `json:"order"`
-	Status  string  `json:"status"`
-	Accrual float64 `json:"accrual,omitempty"`
+	Order   string       `json:"order"`
+	Status  string       `json:"status"`
+	Accrual money.Points `json:"accrual,omitempty"`
 }
 
-// UpdateOrderStatus updates the status of orders based on the response
-// from the accrual system. It queries the accrual system for each unprocessed order
-// and updates the order's status accordingly in the local system.
+// CheckOrderStatus queries the accrual system for a single order and updates
+// the order's status accordingly in the local system.
 // The function handles both successful accrual updates and cases where
-// the accrual system returns no content, marking such orders as "INVALID".
-func (ord *UserOrder) UpdateOrderStatus(accrualServerAddress string) error {
-	endpoint := fmt.Sprintf(config.AccrualSystemAddress, accrualServerAddress)
+// the accrual system does not know the order, marking such orders as INVALID.
+// Statuses of the accrual system are mapped onto the order statuses by the
+// state machine; unknown statuses are rejected and the order is checked again.
+// While the order is not processed yet, or the accrual system fails to answer,
+// the next check is postponed according to the retry policy. Checks which are
+// not made because of throttling or an open circuit breaker are not counted
+// as attempts.
+func (ord *UserOrder) CheckOrderStatus(order orderdb.Order) error {
+	orderLoyalty, err := ord.Accrual.GetOrderAccrual(order.OrderID)
+	var throttled *ThrottledError
+	switch {
+	case errors.Is(err, ErrorOrderNotRegistered):
+		_, err = ord.setStatus(order, config.Invalid, 0.0, orderdb.SourcePoller)
+		return err
+	case errors.As(err, &throttled), errors.Is(err, ErrorAccrualCircuitOpen):
+		return err
+	case err != nil:
+		if scheduleErr := ord.scheduleRetry(order); scheduleErr != nil {
+			return errors.Join(err, scheduleErr)
+		}
+		return err
+	}
 
-	orders, err := ord.OrderRep.GetUnprocessedOrders()
+	if orderLoyalty.Status == "" {
+		return ord.scheduleRetry(order)
+	}
+	status, err := mapAccrualStatus(orderLoyalty.Status)
 	if err != nil {
+		ord.rejectTransition(order, orderLoyalty.Status, orderdb.SourcePoller, err)
+		return ord.scheduleRetry(order)
+	}
+
+	applied, err := ord.setStatus(order, status, orderLoyalty.Accrual, orderdb.SourcePoller)
+	if err != nil || !applied || isFinalStatus(status) {
 		return err
 	}
-	for _, order := range orders {
-		response, err := grequests.Get(endpoint+order.OrderID, nil)
+	order.Status = status
+	return ord.scheduleRetry(order)
+}
+
+// CallbackResult summarizes the accrual results pushed by the accrual system.
+type CallbackResult struct {
+	Applied int      `json:"applied"`
+	Skipped int      `json:"skipped"`
+	Unknown []string `json:"unknown,omitempty"`
+}
+
+// ErrorEmptyAccrualResult is returned when a pushed accrual result has no
+// order number or status.
+var ErrorEmptyAccrualResult = errors.New("accrual result must have order and status")
+
+// ApplyAccrualCallback stores accrual results pushed by the accrual system
+// through the same state machine as the results fetched by the poller.
+// Results for unknown orders are reported, results which the state machine
+// rejects or which repeat a final status are skipped; orders left in a
+// non-final status stay in the poller's queue.
+func (ord *UserOrder) ApplyAccrualCallback(results []OrderLoyaltyFormat) (CallbackResult, error) {
+	for _, result := range results {
+		if result.Order == "" || result.Status == "" {
+			return CallbackResult{}, ErrorEmptyAccrualResult
+		}
+	}
+
+	callbackResult := CallbackResult{}
+	for _, result := range results {
+		order, err := ord.OrderRep.GetOrderByID(result.Order)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			callbackResult.Unknown = append(callbackResult.Unknown, result.Order)
+			continue
+		}
 		if err != nil {
-			return err
+			return callbackResult, err
 		}
-		if response.StatusCode == http.StatusOK {
-			var orderLoyalty OrderLoyaltyFormat
-			err := json.Unmarshal(response.Bytes(), &orderLoyalty)
-			if err != nil {
-				return err
-			}
 
-			if orderLoyalty.Status != "" {
-				err := ord.OrderRep.UpdateOrderStatus(
-					orderLoyalty.Order,
-					orderLoyalty.Status,
-					orderLoyalty.Accrual,
-				)
-				if err != nil {
-					return err
-				}
-			}
-			return nil
-		} else if response.StatusCode == http.StatusNoContent {
-			err := ord.OrderRep.UpdateOrderStatus(order.OrderID, "INVALID", 0.0)
-			if err != nil {
-				return err
-			}
+		status, err := mapAccrualStatus(result.Status)
+		if err != nil {
+			ord.rejectTransition(order, result.Status, orderdb.SourceCallback, err)
+			callbackResult.Skipped++
+			continue
+		}
+		applied, err := ord.setStatus(order, status, result.Accrual, orderdb.SourceCallback)
+		if err != nil {
+			return callbackResult, err
+		}
+		if !applied {
+			callbackResult.Skipped++
+			continue
 		}
+		callbackResult.Applied++
+	}
+	return callbackResult, nil
+}
+
+// scheduleRetry postpones the next check of the order with exponential
+// backoff, or moves the order to the STUCK status once it has used up
+// all its attempts.
+func (ord *UserOrder) scheduleRetry(order orderdb.Order) error {
+	attempts := order.Attempts + 1
+	if ord.Retry.Exhausted(attempts) {
+		logger.Logger.Warn(
+			"Order is stuck in the accrual system",
+			zap.String("order", order.OrderID),
+			zap.String("status", order.Status),
+			zap.Int("attempts", attempts),
+		)
+		_, err := ord.setStatus(order, config.Stuck, order.Accrual, orderdb.SourcePoller)
+		return err
 	}
-	return nil
+	return ord.OrderRep.ScheduleOrderCheck(
+		order.OrderID,
+		time.Now().Add(ord.Retry.Delay(attempts)),
+	)
 }
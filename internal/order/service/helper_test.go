@@ -0,0 +1,170 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserOrder_CheckOrderStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		responses    []FakeAccrualResponse
+		wantStatus   string
+		wantAccrual  money.Points
+		wantAttempts int
+		wantRejected int64
+		wantErr      error
+	}{
+		{
+			name: "Processed",
+			responses: []FakeAccrualResponse{{
+				StatusCode: http.StatusOK,
+				Body:       `{"order": "79927398713", "status": "PROCESSED", "accrual": 729.98}`,
+			}},
+			wantStatus:  "PROCESSED",
+			wantAccrual: money.FromFloat(729.98),
+		},
+		{
+			name: "Invalid",
+			responses: []FakeAccrualResponse{{
+				StatusCode: http.StatusOK,
+				Body:       `{"order": "79927398713", "status": "INVALID"}`,
+			}},
+			wantStatus: "INVALID",
+		},
+		{
+			name:       "Not registered",
+			responses:  []FakeAccrualResponse{{StatusCode: http.StatusNoContent}},
+			wantStatus: "INVALID",
+		},
+		{
+			name: "Throttled",
+			responses: []FakeAccrualResponse{{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"Retry-After": []string{"60"}},
+			}},
+			wantStatus: "NEW",
+			wantErr:    &ThrottledError{RetryAfter: time.Minute},
+		},
+		{
+			name: "Still processing",
+			responses: []FakeAccrualResponse{{
+				StatusCode: http.StatusOK,
+				Body:       `{"order": "79927398713", "status": "PROCESSING"}`,
+			}},
+			wantStatus:   "PROCESSING",
+			wantAttempts: 1,
+		},
+		{
+			name: "Registered",
+			responses: []FakeAccrualResponse{{
+				StatusCode: http.StatusOK,
+				Body:       `{"order": "79927398713", "status": "REGISTERED"}`,
+			}},
+			wantStatus:   "PROCESSING",
+			wantAttempts: 1,
+		},
+		{
+			name: "Unknown status",
+			responses: []FakeAccrualResponse{{
+				StatusCode: http.StatusOK,
+				Body:       `{"order": "79927398713", "status": "DONE", "accrual": 10}`,
+			}},
+			wantStatus:   "NEW",
+			wantAttempts: 1,
+			wantRejected: 1,
+		},
+		{
+			name:         "Server error",
+			responses:    []FakeAccrualResponse{{StatusCode: http.StatusServiceUnavailable}},
+			wantStatus:   "NEW",
+			wantAttempts: 1,
+			wantErr:      ErrorAccrualUnavailable,
+		},
+		{
+			name:         "Transport error",
+			responses:    []FakeAccrualResponse{{Err: errors.New("connection refused")}},
+			wantStatus:   "NEW",
+			wantAttempts: 1,
+			wantErr:      ErrorAccrualUnavailable,
+		},
+		{
+			name:         "Malformed body",
+			responses:    []FakeAccrualResponse{{StatusCode: http.StatusOK, Body: `{`}},
+			wantStatus:   "NEW",
+			wantAttempts: 1,
+			wantErr:      ErrorUnexpectedAccrualStatus,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				const orderID = "79927398713"
+				fake := NewFakeAccrualClient()
+				fake.Script(orderID, tt.responses...)
+				mockRepo := NewMockOrderRepository()
+				assert.NoError(t, mockRepo.AddOrder(orderID, uuid.New(), "NEW", 0.0))
+
+				userOrder := NewOrder(mockRepo, fake)
+				err := userOrder.CheckOrderStatus(mockRepo.Orders[orderID])
+
+				var throttled *ThrottledError
+				switch {
+				case tt.wantErr == nil:
+					assert.NoError(t, err)
+				case errors.As(tt.wantErr, &throttled):
+					assert.Equal(t, tt.wantErr, err)
+				default:
+					assert.ErrorIs(t, err, tt.wantErr)
+				}
+				assert.Equal(t, tt.wantStatus, mockRepo.Orders[orderID].Status)
+				assert.Equal(t, tt.wantAccrual, mockRepo.Orders[orderID].Accrual)
+				assert.Equal(t, tt.wantAttempts, mockRepo.Orders[orderID].Attempts)
+				assert.Equal(t, tt.wantRejected, userOrder.RejectedTransitions())
+			},
+		)
+	}
+}
+
+func TestUserOrder_ApplyAccrualCallback(t *testing.T) {
+	mockRepo := NewMockOrderRepository()
+	userID := uuid.New()
+	assert.NoError(t, mockRepo.AddOrder("79927398713", userID, "NEW", 0.0))
+	assert.NoError(t, mockRepo.AddOrder("12345678903", userID, "PROCESSING", 0.0))
+	assert.NoError(t, mockRepo.AddOrder("4561261212345467", userID, "PROCESSED", money.FromFloat(100)))
+	assert.NoError(t, mockRepo.AddOrder("2377225624", userID, "INVALID", 0.0))
+	userOrder := NewOrder(mockRepo, NewFakeAccrualClient())
+
+	result, err := userOrder.ApplyAccrualCallback(
+		[]OrderLoyaltyFormat{
+			{Order: "79927398713", Status: "PROCESSED", Accrual: money.FromFloat(500)},
+			{Order: "12345678903", Status: "REGISTERED"},
+			{Order: "4561261212345467", Status: "PROCESSING"},
+			{Order: "4561261212345467", Status: "PROCESSED", Accrual: money.FromFloat(100)},
+			{Order: "2377225624", Status: "SOMETHING"},
+			{Order: "5062821234567892", Status: "PROCESSED", Accrual: money.FromFloat(1)},
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		CallbackResult{Applied: 2, Skipped: 3, Unknown: []string{"5062821234567892"}},
+		result,
+	)
+	assert.Equal(t, int64(2), userOrder.RejectedTransitions())
+	assert.Equal(t, "PROCESSED", mockRepo.Orders["79927398713"].Status)
+	assert.Equal(t, money.FromFloat(500), mockRepo.Orders["79927398713"].Accrual)
+	assert.Equal(t, "PROCESSING", mockRepo.Orders["12345678903"].Status)
+	assert.Equal(t, "PROCESSED", mockRepo.Orders["4561261212345467"].Status)
+	assert.Equal(t, money.FromFloat(100), mockRepo.Orders["4561261212345467"].Accrual)
+
+	_, err = userOrder.ApplyAccrualCallback([]OrderLoyaltyFormat{{Order: "79927398713"}})
+	assert.ErrorIs(t, err, ErrorEmptyAccrualResult)
+}
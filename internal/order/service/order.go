@@ -5,22 +5,30 @@ package service
 import (
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
+	"github.com/elina-chertova/loyalty-system/internal/config"
 	"github.com/elina-chertova/loyalty-system/internal/db/orderdb"
 	"github.com/elina-chertova/loyalty-system/internal/order/utils"
 	"github.com/elina-chertova/loyalty-system/internal/security"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
 	"gorm.io/gorm"
 )
 
 // UserOrder struct handles operations related to user orders.
 type UserOrder struct {
 	OrderRep orderdb.OrderRepository
+	Accrual  AccrualClient
+	Retry    RetryPolicy
+	rejected atomic.Int64
 }
 
-// NewOrder creates a new instance of UserOrder with the given OrderRepository.
-func NewOrder(model orderdb.OrderRepository) *UserOrder {
-	return &UserOrder{OrderRep: model}
+// NewOrder creates a new instance of UserOrder with the given OrderRepository
+// and the AccrualClient used to check orders against the accrual system.
+// The order uses DefaultRetryPolicy until Retry is set explicitly.
+func NewOrder(model orderdb.OrderRepository, accrual AccrualClient) *UserOrder {
+	return &UserOrder{OrderRep: model, Accrual: accrual, Retry: DefaultRetryPolicy()}
 }
 
 // Predefined errors for order operations.
@@ -28,6 +36,8 @@ var (
 	ErrorAddingOrder             = errors.New("order cannot be added")
 	ErrorOrderBelongsAnotherUser = errors.New("order belongs to another user")
 	ErrorNotValidOrderNumber     = errors.New("order number is not valid")
+	ErrorOrderNotStuck           = errors.New("order is not stuck")
+	ErrorOrderNotFound           = errors.New("order not found")
 )
 
 // LoadOrder handles the loading of an order. It checks the validity of the
@@ -48,7 +58,7 @@ func (ord *UserOrder) LoadOrder(token string, orderID string) (*LoadOrderResult,
 	}
 
 	if (order == orderdb.Order{}) {
-		err = ord.OrderRep.AddOrder(orderID, userID, "NEW", 0.0)
+		err = ord.OrderRep.AddOrder(orderID, userID, config.New, 0.0)
 		if err != nil {
 			return nil, fmt.Errorf("%w: %v", ErrorAddingOrder, err.Error())
 		}
@@ -96,26 +106,155 @@ func (ord *UserOrder) GetOrders(token string) ([]UserOrderFormat, error) {
 
 // UserOrderFormat defines the format for representing user orders.
 type UserOrderFormat struct {
-	Number     string    `json:"number"`
-	Status     string    `json:"status"`
-	Accrual    *float64  `json:"accrual,omitempty"`
-	UploadedAt time.Time `json:"uploaded_at"`
+	Number     string        `json:"number"`
+	Status     string        `json:"status"`
+	Accrual    *money.Points `json:"accrual,omitempty"`
+	UploadedAt time.Time     `json:"uploaded_at"`
+}
+
+// OrderStatusEventFormat defines the format for representing a transition
+// in the status history of a user order.
+type OrderStatusEventFormat struct {
+	OldStatus string        `json:"old_status,omitempty"`
+	NewStatus string        `json:"new_status"`
+	Accrual   *money.Points `json:"accrual,omitempty"`
+	Source    string        `json:"source"`
+	ChangedAt time.Time     `json:"changed_at"`
+}
+
+// GetOrderHistory retrieves the status history of the order, oldest first.
+// It returns ErrorOrderNotFound if the order does not exist or belongs to
+// another user.
+// As in ConvertToUserOrderFormat, the STUCK status is reported as PROCESSING,
+// and transitions which are invisible to the user are left out.
+func (ord *UserOrder) GetOrderHistory(token string, orderID string) ([]OrderStatusEventFormat, error) {
+	userID, err := security.GetUserIDFromToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := ord.OrderRep.GetOrderByID(orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrorOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if order.UserID != userID {
+		return nil, ErrorOrderNotFound
+	}
+
+	events, err := ord.OrderRep.GetOrderStatusEvents(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]OrderStatusEventFormat, 0, len(events))
+	for _, event := range events {
+		oldStatus := userStatus(event.OldStatus)
+		newStatus := userStatus(event.NewStatus)
+		if event.OldStatus != "" && oldStatus == newStatus {
+			continue
+		}
+
+		e := OrderStatusEventFormat{
+			OldStatus: oldStatus,
+			NewStatus: newStatus,
+			Source:    event.Source,
+			ChangedAt: event.CreatedAt,
+		}
+		if event.Accrual != 0 {
+			accrual := event.Accrual
+			e.Accrual = &accrual
+		}
+		history = append(history, e)
+	}
+	return history, nil
+}
+
+// userStatus returns the status of an order as it is shown to the user.
+// Stuck orders are still being worked on from the user's point of view,
+// so they are reported as PROCESSING.
+func userStatus(status string) string {
+	if status == config.Stuck {
+		return config.Processing
+	}
+	return status
 }
 
 // ConvertToUserOrderFormat converts an orderdb.Order to UserOrderFormat
 // for external representation.
 func ConvertToUserOrderFormat(originalOrder orderdb.Order) *UserOrderFormat {
+	status := userStatus(originalOrder.Status)
 	if originalOrder.Accrual == 0 {
 		return &UserOrderFormat{
 			Number:     originalOrder.OrderID,
-			Status:     originalOrder.Status,
+			Status:     status,
 			UploadedAt: originalOrder.UpdatedAt,
 		}
 	}
 	return &UserOrderFormat{
 		Number:     originalOrder.OrderID,
-		Status:     originalOrder.Status,
+		Status:     status,
 		Accrual:    &originalOrder.Accrual,
 		UploadedAt: originalOrder.UpdatedAt,
 	}
 }
+
+// AdminOrderFormat defines the format for representing orders to administrators.
+type AdminOrderFormat struct {
+	Number        string     `json:"number"`
+	UserID        string     `json:"user_id"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+	UploadedAt    time.Time  `json:"uploaded_at"`
+}
+
+// GetStuckOrders retrieves the orders which exceeded the maximum number of
+// checks against the accrual system.
+func (ord *UserOrder) GetStuckOrders() ([]AdminOrderFormat, error) {
+	orders, err := ord.OrderRep.GetOrdersByStatus(config.Stuck)
+	if err != nil {
+		return nil, err
+	}
+
+	stuckOrders := make([]AdminOrderFormat, 0, len(orders))
+	for _, o := range orders {
+		stuckOrders = append(
+			stuckOrders, AdminOrderFormat{
+				Number:        o.OrderID,
+				UserID:        o.UserID.String(),
+				Status:        o.Status,
+				Attempts:      o.Attempts,
+				LastCheckedAt: o.LastCheckedAt,
+				UploadedAt:    o.CreatedAt,
+			},
+		)
+	}
+	return stuckOrders, nil
+}
+
+// RequeueOrder returns a stuck order to the queue of the accrual poller
+// with a fresh set of attempts.
+func (ord *UserOrder) RequeueOrder(orderID string) error {
+	err := ord.OrderRep.RequeueOrder(orderID, config.Stuck, config.New)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrorOrderNotStuck
+	}
+	return err
+}
+
+// NextCheckAt returns the time when the earliest pending order is due for
+// the next check against the accrual system. The boolean result is false
+// when no orders are pending.
+func (ord *UserOrder) NextCheckAt() (time.Time, bool, error) {
+	nextCheckAt, err := ord.OrderRep.GetNextCheckAt()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return nextCheckAt, true, nil
+}
@@ -2,16 +2,24 @@ package service
 
 import (
 	"errors"
-	"github.com/elina-chertova/loyalty-system/internal/db/orderdb"
+	"sort"
+	"sync"
+	"testing"
+	"time"
 
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/internal/db/orderdb"
 	"github.com/elina-chertova/loyalty-system/internal/security"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
 	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
-	"testing"
 )
 
 type MockOrderRepository struct {
+	mu     sync.Mutex
 	Orders map[string]orderdb.Order
+	Events []orderdb.OrderStatusEvent
 }
 
 func NewMockOrderRepository() *MockOrderRepository {
@@ -20,35 +28,136 @@ func NewMockOrderRepository() *MockOrderRepository {
 	}
 }
 
-func (m *MockOrderRepository) GetOrderAccrual() ([]orderdb.UserAccrual, error) {
-	return []orderdb.UserAccrual{}, nil
-}
-
 func (m *MockOrderRepository) GetPreparedOrders() ([]orderdb.OrderAccrual, error) {
-	return []orderdb.OrderAccrual{}, nil
-}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-func (m *MockOrderRepository) SetProcessedOrders(order []orderdb.OrderAccrual) error {
-	return nil
+	var orders []orderdb.OrderAccrual
+	for _, order := range m.Orders {
+		if order.Status == config.Processed && !order.Credited {
+			orders = append(
+				orders, orderdb.OrderAccrual{
+					UserID:     order.UserID,
+					Order:      order.OrderID,
+					SumAccrual: order.Accrual,
+				},
+			)
+		}
+	}
+	return orders, nil
 }
 
-func (m *MockOrderRepository) GetTotalAccrualByUsers() ([]orderdb.UserAccrual, error) {
-	return []orderdb.UserAccrual{}, nil
-}
+func (m *MockOrderRepository) GetUnprocessedOrders(afterID uint, limit int) ([]orderdb.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-func (m *MockOrderRepository) GetUnprocessedOrders() ([]orderdb.Order, error) {
-	return []orderdb.Order{}, nil
+	var orders []orderdb.Order
+	for _, order := range m.Orders {
+		due := !order.NextCheckAt.After(time.Now())
+		if order.ID > afterID && due && (order.Status == "NEW" || order.Status == "PROCESSING") {
+			orders = append(orders, order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+	if len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders, nil
 }
 
 func (m *MockOrderRepository) UpdateOrderStatus(
 	orderID string,
+	oldStatus string,
 	newStatus string,
-	accrual float64,
+	accrual money.Points,
+	source string,
 ) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, exists := m.Orders[orderID]
+	if !exists {
+		return gorm.ErrRecordNotFound
+	}
+	if order.Status != oldStatus {
+		return orderdb.ErrorStatusChanged
+	}
+	if order.Status != newStatus || order.Accrual != accrual {
+		m.addEvent(orderID, order.Status, newStatus, accrual, source)
+	}
+	order.Status = newStatus
+	order.Accrual = accrual
+	m.Orders[orderID] = order
+	return nil
+}
+
+func (m *MockOrderRepository) GetNextCheckAt() (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var nextCheckAt time.Time
+	found := false
+	for _, order := range m.Orders {
+		if order.Status != "NEW" && order.Status != "PROCESSING" {
+			continue
+		}
+		if !found || order.NextCheckAt.Before(nextCheckAt) {
+			nextCheckAt, found = order.NextCheckAt, true
+		}
+	}
+	if !found {
+		return time.Time{}, gorm.ErrRecordNotFound
+	}
+	return nextCheckAt, nil
+}
+
+func (m *MockOrderRepository) ScheduleOrderCheck(orderID string, nextCheckAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, exists := m.Orders[orderID]
+	if !exists {
+		return gorm.ErrRecordNotFound
+	}
+	order.Attempts++
+	order.NextCheckAt = nextCheckAt
+	m.Orders[orderID] = order
+	return nil
+}
+
+func (m *MockOrderRepository) GetOrdersByStatus(status string) ([]orderdb.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var orders []orderdb.Order
+	for _, order := range m.Orders {
+		if order.Status == status {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (m *MockOrderRepository) RequeueOrder(orderID string, fromStatus string, toStatus string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, exists := m.Orders[orderID]
+	if !exists || order.Status != fromStatus {
+		return gorm.ErrRecordNotFound
+	}
+	m.addEvent(orderID, fromStatus, toStatus, order.Accrual, orderdb.SourceAdmin)
+	order.Status = toStatus
+	order.Attempts = 0
+	order.NextCheckAt = time.Now()
+	m.Orders[orderID] = order
 	return nil
 }
 
 func (m *MockOrderRepository) GetOrderByID(orderID string) (orderdb.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if order, exists := m.Orders[orderID]; exists {
 		return order, nil
 	}
@@ -59,21 +168,63 @@ func (m *MockOrderRepository) AddOrder(
 	orderID string,
 	userID uuid.UUID,
 	status string,
-	accrual float64,
+	accrual money.Points,
 ) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if _, exists := m.Orders[orderID]; exists {
 		return errors.New("order already exists")
 	}
-	m.Orders[orderID] = orderdb.Order{
+	order := orderdb.Order{
 		OrderID: orderID,
 		UserID:  userID,
 		Status:  status,
 		Accrual: accrual,
 	}
+	order.ID = uint(len(m.Orders) + 1)
+	m.Orders[orderID] = order
+	m.addEvent(orderID, "", status, accrual, orderdb.SourceUser)
 	return nil
 }
 
+func (m *MockOrderRepository) GetOrderStatusEvents(orderID string) ([]orderdb.OrderStatusEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []orderdb.OrderStatusEvent
+	for _, event := range m.Events {
+		if event.OrderID == orderID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (m *MockOrderRepository) addEvent(
+	orderID string,
+	oldStatus string,
+	newStatus string,
+	accrual money.Points,
+	source string,
+) {
+	m.Events = append(
+		m.Events, orderdb.OrderStatusEvent{
+			ID:        uint(len(m.Events) + 1),
+			OrderID:   orderID,
+			OldStatus: oldStatus,
+			NewStatus: newStatus,
+			Accrual:   accrual,
+			Source:    source,
+			CreatedAt: time.Now(),
+		},
+	)
+}
+
 func (m *MockOrderRepository) GetOrderByUserID(userID uuid.UUID) ([]orderdb.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	var orders []orderdb.Order
 	for _, order := range m.Orders {
 		if order.UserID == userID {
@@ -85,7 +236,7 @@ func (m *MockOrderRepository) GetOrderByUserID(userID uuid.UUID) ([]orderdb.Orde
 
 func TestUserOrder_LoadOrder(t *testing.T) {
 	mockRepo := &MockOrderRepository{Orders: make(map[string]orderdb.Order)}
-	userOrder := NewOrder(mockRepo)
+	userOrder := NewOrder(mockRepo, NewFakeAccrualClient())
 
 	token, _ := security.GenerateToken(uuid.New())
 	orderID := "6231543915765652"
@@ -100,7 +251,7 @@ func TestUserOrder_LoadOrder(t *testing.T) {
 
 func TestUserOrder_GetOrders(t *testing.T) {
 	mockRepo := NewMockOrderRepository()
-	userOrder := NewOrder(mockRepo)
+	userOrder := NewOrder(mockRepo, NewFakeAccrualClient())
 
 	token, _ := security.GenerateToken(uuid.New())
 
@@ -110,9 +261,74 @@ func TestUserOrder_GetOrders(t *testing.T) {
 	}
 }
 
+func TestUserOrder_NextCheckAt(t *testing.T) {
+	mockRepo := NewMockOrderRepository()
+	userOrder := NewOrder(mockRepo, NewFakeAccrualClient())
+
+	_, pending, err := userOrder.NextCheckAt()
+	assert.NoError(t, err)
+	assert.False(t, pending)
+
+	userID := uuid.New()
+	assert.NoError(t, mockRepo.AddOrder("79927398713", userID, "PROCESSED", 0.0))
+	assert.NoError(t, mockRepo.AddOrder("12345678903", userID, "NEW", 0.0))
+	due := time.Now().Add(time.Minute)
+	assert.NoError(t, mockRepo.ScheduleOrderCheck("12345678903", due))
+
+	nextCheckAt, pending, err := userOrder.NextCheckAt()
+	assert.NoError(t, err)
+	assert.True(t, pending)
+	assert.Equal(t, due, nextCheckAt)
+}
+
+func TestUserOrder_GetOrderHistory(t *testing.T) {
+	mockRepo := NewMockOrderRepository()
+	accrual := NewFakeAccrualClient()
+	userOrder := NewOrder(mockRepo, accrual)
+
+	ownerID := uuid.New()
+	owner, _ := security.GenerateToken(ownerID)
+	stranger, _ := security.GenerateToken(uuid.New())
+	orderID := "6231543915765652"
+
+	_, err := userOrder.LoadOrder(owner, orderID)
+	assert.NoError(t, err)
+	accrual.Script(
+		orderID,
+		FakeAccrualResponse{StatusCode: 200, Body: `{"order":"6231543915765652","status":"PROCESSING"}`},
+		FakeAccrualResponse{StatusCode: 200, Body: `{"order":"6231543915765652","status":"PROCESSING"}`},
+	)
+	for i := 0; i < 2; i++ {
+		order, _ := mockRepo.GetOrderByID(orderID)
+		assert.NoError(t, userOrder.CheckOrderStatus(order))
+	}
+	_, err = userOrder.ApplyAccrualCallback(
+		[]OrderLoyaltyFormat{{Order: orderID, Status: "PROCESSED", Accrual: money.FromFloat(500)}},
+	)
+	assert.NoError(t, err)
+
+	history, err := userOrder.GetOrderHistory(owner, orderID)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 3) {
+		assert.Equal(t, "NEW", history[0].NewStatus)
+		assert.Equal(t, orderdb.SourceUser, history[0].Source)
+		assert.Equal(t, "NEW", history[1].OldStatus)
+		assert.Equal(t, "PROCESSING", history[1].NewStatus)
+		assert.Equal(t, orderdb.SourcePoller, history[1].Source)
+		assert.Equal(t, "PROCESSED", history[2].NewStatus)
+		assert.Equal(t, orderdb.SourceCallback, history[2].Source)
+		assert.Equal(t, money.FromFloat(500), *history[2].Accrual)
+	}
+
+	_, err = userOrder.GetOrderHistory(stranger, orderID)
+	assert.ErrorIs(t, err, ErrorOrderNotFound)
+	_, err = userOrder.GetOrderHistory(owner, "79927398713")
+	assert.ErrorIs(t, err, ErrorOrderNotFound)
+}
+
 func BenchmarkUserOrder_LoadOrder(b *testing.B) {
 	mockRepo := NewMockOrderRepository()
-	userOrder := NewOrder(mockRepo)
+	userOrder := NewOrder(mockRepo, NewFakeAccrualClient())
 
 	token, _ := security.GenerateToken(uuid.New())
 	orderID := "6231543915765652"
@@ -125,7 +341,7 @@ func BenchmarkUserOrder_LoadOrder(b *testing.B) {
 
 func BenchmarkUserOrder_GetOrders(b *testing.B) {
 	mockRepo := NewMockOrderRepository()
-	userOrder := NewOrder(mockRepo)
+	userOrder := NewOrder(mockRepo, NewFakeAccrualClient())
 
 	token, _ := security.GenerateToken(uuid.New())
 
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/internal/db/orderdb"
+	"github.com/elina-chertova/loyalty-system/pkg/breaker"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ErrorCheckingOrders is returned by Poll when some orders could not be checked.
+var ErrorCheckingOrders = errors.New("orders have not been checked")
+
+// AccrualPoller checks pending orders against the accrual system. Orders are
+// fetched from the database in batches and dispatched to a bounded pool of
+// concurrent workers.
+type AccrualPoller struct {
+	order     *UserOrder
+	breaker   *breaker.Breaker
+	workers   int
+	batchSize int
+	throttle  *AccrualThrottle
+}
+
+// AccrualStatus describes the state of the communication with the accrual system.
+type AccrualStatus struct {
+	Throttle            ThrottleState     `json:"throttle"`
+	Breaker             *breaker.Snapshot `json:"breaker,omitempty"`
+	RejectedTransitions int64             `json:"rejected_transitions"`
+}
+
+// NewAccrualPoller creates a new AccrualPoller. Non-positive workers and
+// batchSize fall back to the defaults from the config package.
+// b is the circuit breaker guarding the order's AccrualClient; while it is
+// open, Poll returns ErrorAccrualCircuitOpen without touching the database.
+// b may be nil if the client is not guarded.
+func NewAccrualPoller(
+	ord *UserOrder,
+	b *breaker.Breaker,
+	workers int,
+	batchSize int,
+) *AccrualPoller {
+	if workers <= 0 {
+		workers = config.DefaultAccrualWorkers
+	}
+	if batchSize <= 0 {
+		batchSize = config.DefaultAccrualBatchSize
+	}
+	return &AccrualPoller{
+		order:     ord,
+		breaker:   b,
+		workers:   workers,
+		batchSize: batchSize,
+		throttle:  NewAccrualThrottle(),
+	}
+}
+
+// Status returns the current state of the communication with the accrual system.
+func (p *AccrualPoller) Status() AccrualStatus {
+	status := AccrualStatus{
+		Throttle:            p.throttle.State(),
+		RejectedTransitions: p.order.RejectedTransitions(),
+	}
+	if p.breaker != nil {
+		snapshot := p.breaker.Snapshot()
+		status.Breaker = &snapshot
+	}
+	return status
+}
+
+// Poll drains the queue of pending orders. It pages through the orders in
+// batches of batchSize and checks every batch with the worker pool before
+// fetching the next one. Failures of single orders are logged and do not stop
+// the remaining orders from being checked. Once the circuit breaker opens,
+// polling stops and ErrorAccrualCircuitOpen is returned.
+func (p *AccrualPoller) Poll() error {
+	var (
+		lastID  uint
+		checked int
+		failed  int64
+	)
+	for {
+		if p.breaker != nil && p.breaker.State() == breaker.StateOpen {
+			return ErrorAccrualCircuitOpen
+		}
+
+		orders, err := p.order.OrderRep.GetUnprocessedOrders(lastID, p.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			break
+		}
+
+		batchFailed, shortCircuited := p.checkBatch(orders)
+		failed += batchFailed
+		checked += len(orders)
+		lastID = orders[len(orders)-1].ID
+		if shortCircuited {
+			return ErrorAccrualCircuitOpen
+		}
+
+		if len(orders) < p.batchSize {
+			break
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d", ErrorCheckingOrders, failed, checked)
+	}
+	return nil
+}
+
+// checkBatch checks the given orders with at most p.workers concurrent requests.
+// It returns the number of orders that failed and whether some orders were
+// skipped because the circuit breaker opened.
+func (p *AccrualPoller) checkBatch(orders []orderdb.Order) (int64, bool) {
+	jobs := make(chan orderdb.Order)
+	var (
+		wg             sync.WaitGroup
+		failed         int64
+		shortCircuited int32
+	)
+
+	workers := p.workers
+	if workers > len(orders) {
+		workers = len(orders)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for order := range jobs {
+				err := p.checkOrder(order)
+				if errors.Is(err, ErrorAccrualCircuitOpen) {
+					atomic.StoreInt32(&shortCircuited, 1)
+					continue
+				}
+				if err != nil {
+					atomic.AddInt64(&failed, 1)
+					logger.Logger.Warn(
+						"Order status has not been checked",
+						zap.String("order", order.OrderID),
+						zap.Error(err),
+					)
+				}
+			}
+		}()
+	}
+
+	for _, order := range orders {
+		jobs <- order
+	}
+	close(jobs)
+	wg.Wait()
+
+	return failed, atomic.LoadInt32(&shortCircuited) == 1
+}
+
+// checkOrder checks a single order. When the accrual system throttles us,
+// all workers are paused for the requested time, at least
+// config.MinRetryAfter, and the order is retried. After
+// config.MaxThrottledRetries throttled retries the ThrottledError is returned
+// and the order is left for the next poll.
+func (p *AccrualPoller) checkOrder(order orderdb.Order) error {
+	for attempt := 0; ; attempt++ {
+		p.throttle.Wait()
+
+		err := p.order.CheckOrderStatus(order)
+		var throttled *ThrottledError
+		if !errors.As(err, &throttled) {
+			return err
+		}
+		p.throttle.Pause(minRetryAfter(throttled.RetryAfter))
+		if attempt >= config.MaxThrottledRetries {
+			return err
+		}
+	}
+}
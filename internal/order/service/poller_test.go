@@ -0,0 +1,83 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// concurrencyCounter is an AccrualClient recording the maximum number
+// of simultaneous requests.
+type concurrencyCounter struct {
+	AccrualClient
+	inFlight, maxInFlight int64
+}
+
+func (c *concurrencyCounter) GetOrderAccrual(orderID string) (OrderLoyaltyFormat, error) {
+	current := atomic.AddInt64(&c.inFlight, 1)
+	defer atomic.AddInt64(&c.inFlight, -1)
+	for {
+		seen := atomic.LoadInt64(&c.maxInFlight)
+		if current <= seen || atomic.CompareAndSwapInt64(&c.maxInFlight, seen, current) {
+			break
+		}
+	}
+	return c.AccrualClient.GetOrderAccrual(orderID)
+}
+
+func TestAccrualPoller_Poll(t *testing.T) {
+	const (
+		ordersCount = 250
+		workers     = 8
+	)
+
+	fake := NewFakeAccrualClient()
+	fake.SetDefault(
+		FakeAccrualResponse{
+			StatusCode: http.StatusOK,
+			Body:       `{"status": "PROCESSED", "accrual": 10}`,
+			Latency:    time.Millisecond,
+		},
+	)
+	client := &concurrencyCounter{AccrualClient: fake}
+
+	mockRepo := NewMockOrderRepository()
+	userID := uuid.New()
+	for i := 0; i < ordersCount; i++ {
+		assert.NoError(t, mockRepo.AddOrder(strconv.Itoa(i), userID, "NEW", 0.0))
+	}
+
+	poller := NewAccrualPoller(NewOrder(mockRepo, client), nil, workers, 40)
+	assert.NoError(t, poller.Poll())
+
+	for _, order := range mockRepo.Orders {
+		assert.Equal(t, "PROCESSED", order.Status, "order %s", order.OrderID)
+		assert.Equal(t, money.FromFloat(10), order.Accrual)
+	}
+	assert.Equal(t, ordersCount, fake.TotalCalls())
+	assert.LessOrEqual(t, client.maxInFlight, int64(workers))
+}
+
+func TestAccrualPoller_PollFailures(t *testing.T) {
+	fake := NewFakeAccrualClient()
+	fake.SetDefault(FakeAccrualResponse{StatusCode: http.StatusInternalServerError})
+	fake.Script("1", FakeAccrualResponse{StatusCode: http.StatusNoContent})
+
+	mockRepo := NewMockOrderRepository()
+	userID := uuid.New()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, mockRepo.AddOrder(strconv.Itoa(i), userID, "NEW", 0.0))
+	}
+
+	poller := NewAccrualPoller(NewOrder(mockRepo, fake), nil, 2, 2)
+	err := poller.Poll()
+	assert.ErrorIs(t, err, ErrorCheckingOrders)
+	assert.Equal(t, "INVALID", mockRepo.Orders["1"].Status)
+	assert.Equal(t, "NEW", mockRepo.Orders["0"].Status)
+}
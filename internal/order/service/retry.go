@@ -0,0 +1,56 @@
+package service
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+)
+
+// RetryPolicy defines how often an order is re-checked against the accrual
+// system while it is not processed yet.
+type RetryPolicy struct {
+	// MaxAttempts is the number of unsuccessful checks after which
+	// the order is moved to the STUCK status.
+	MaxAttempts int
+	// BaseDelay is the delay after the first unsuccessful check.
+	BaseDelay time.Duration
+	// MaxDelay caps the exponentially growing delay.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy returns the RetryPolicy with defaults from the config package.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: config.DefaultAccrualMaxAttempts,
+		BaseDelay:   config.DefaultAccrualRetryBaseDelay,
+		MaxDelay:    config.DefaultAccrualRetryMaxDelay,
+	}
+}
+
+// Delay returns the time to wait before the next check after the given
+// number of unsuccessful attempts. The delay doubles with every attempt up to
+// MaxDelay; a random jitter of up to half the delay spreads the checks of
+// orders that failed at the same moment.
+func (policy RetryPolicy) Delay(attempts int) time.Duration {
+	delay := policy.MaxDelay
+	if attempts < 1 {
+		attempts = 1
+	}
+	if shift := attempts - 1; shift < 32 {
+		if d := policy.BaseDelay << shift; d > 0 && d < policy.MaxDelay {
+			delay = d
+		}
+	}
+
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Exhausted reports whether the order has used up all its attempts.
+func (policy RetryPolicy) Exhausted(attempts int) bool {
+	return policy.MaxAttempts > 0 && attempts >= policy.MaxAttempts
+}
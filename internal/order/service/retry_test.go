@@ -0,0 +1,81 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+	tests := []struct {
+		attempts int
+		max      time.Duration
+	}{
+		{attempts: 0, max: time.Second},
+		{attempts: 1, max: time.Second},
+		{attempts: 2, max: 2 * time.Second},
+		{attempts: 4, max: 8 * time.Second},
+		{attempts: 7, max: time.Minute},
+		{attempts: 100, max: time.Minute},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			delay := policy.Delay(tt.attempts)
+			assert.GreaterOrEqual(t, delay, tt.max/2, "attempts %d", tt.attempts)
+			assert.LessOrEqual(t, delay, tt.max, "attempts %d", tt.attempts)
+		}
+	}
+
+	assert.False(t, policy.Exhausted(9))
+	assert.True(t, policy.Exhausted(10))
+	assert.False(t, RetryPolicy{}.Exhausted(1000))
+}
+
+func TestUserOrder_StuckAndRequeue(t *testing.T) {
+	const orderID = "79927398713"
+	fake := NewFakeAccrualClient()
+	fake.SetDefault(
+		FakeAccrualResponse{
+			StatusCode: http.StatusOK,
+			Body:       `{"order": "79927398713", "status": "PROCESSING"}`,
+		},
+	)
+	mockRepo := NewMockOrderRepository()
+	assert.NoError(t, mockRepo.AddOrder(orderID, uuid.New(), "NEW", 0.0))
+
+	userOrder := NewOrder(mockRepo, fake)
+	userOrder.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	poller := NewAccrualPoller(userOrder, nil, 1, 10)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, poller.Poll())
+		assert.NoError(t, poller.Poll(), "the order is not due, so it is not checked again")
+		order := mockRepo.Orders[orderID]
+		order.NextCheckAt = time.Now()
+		mockRepo.Orders[orderID] = order
+	}
+	assert.Equal(t, 3, fake.Calls(orderID))
+	assert.Equal(t, config.Stuck, mockRepo.Orders[orderID].Status)
+	assert.Equal(t, "PROCESSING", ConvertToUserOrderFormat(mockRepo.Orders[orderID]).Status)
+
+	stuck, err := userOrder.GetStuckOrders()
+	assert.NoError(t, err)
+	if assert.Len(t, stuck, 1) {
+		assert.Equal(t, orderID, stuck[0].Number)
+		assert.Equal(t, 2, stuck[0].Attempts)
+	}
+
+	assert.NoError(t, userOrder.RequeueOrder(orderID))
+	assert.Equal(t, "NEW", mockRepo.Orders[orderID].Status)
+	assert.Equal(t, 0, mockRepo.Orders[orderID].Attempts)
+	assert.ErrorIs(t, userOrder.RequeueOrder(orderID), ErrorOrderNotStuck)
+
+	assert.NoError(t, poller.Poll())
+	assert.Equal(t, 4, fake.Calls(orderID))
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/internal/db/orderdb"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"go.uber.org/zap"
+)
+
+// Errors describing rejected order status transitions.
+var (
+	ErrorUnknownAccrualStatus = errors.New("unknown accrual status")
+	ErrorIllegalTransition    = errors.New("illegal order status transition")
+)
+
+// accrualStatuses maps the statuses of the accrual system onto the order statuses.
+var accrualStatuses = map[string]string{
+	config.Registered: config.Processing,
+	config.Processing: config.Processing,
+	config.Invalid:    config.Invalid,
+	config.Processed:  config.Processed,
+}
+
+// transitions lists the statuses each order status may move to.
+// PROCESSED and INVALID are final, STUCK orders go back to NEW when they are
+// requeued or move on when the accrual system pushes their result.
+var transitions = map[string][]string{
+	config.New:        {config.Processing, config.Invalid, config.Processed, config.Stuck},
+	config.Processing: {config.Processing, config.Invalid, config.Processed, config.Stuck},
+	config.Stuck:      {config.New, config.Processing, config.Invalid, config.Processed},
+	config.Processed:  {},
+	config.Invalid:    {},
+}
+
+// mapAccrualStatus returns the order status corresponding to the status
+// of the accrual system.
+func mapAccrualStatus(accrualStatus string) (string, error) {
+	status, ok := accrualStatuses[accrualStatus]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrorUnknownAccrualStatus, accrualStatus)
+	}
+	return status, nil
+}
+
+// checkTransition returns ErrorIllegalTransition if an order may not move
+// from status from to status to.
+func checkTransition(from string, to string) error {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrorIllegalTransition, from, to)
+}
+
+// isFinalStatus reports whether the accrual system will not change the order anymore.
+func isFinalStatus(status string) bool {
+	return len(transitions[status]) == 0
+}
+
+// setStatus moves the order to the status through the state machine and
+// reports whether the order was updated. Repeating a final status is
+// silently ignored. Illegal transitions, as well as transitions from a status
+// the order has already left, are rejected: they are logged and counted,
+// and the order is left untouched.
+func (ord *UserOrder) setStatus(
+	order orderdb.Order,
+	status string,
+	accrual money.Points,
+	source string,
+) (bool, error) {
+	if order.Status == status && isFinalStatus(status) {
+		return false, nil
+	}
+	if err := checkTransition(order.Status, status); err != nil {
+		ord.rejectTransition(order, status, source, err)
+		return false, nil
+	}
+
+	err := ord.OrderRep.UpdateOrderStatus(order.OrderID, order.Status, status, accrual, source)
+	if errors.Is(err, orderdb.ErrorStatusChanged) {
+		ord.rejectTransition(order, status, source, err)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// rejectTransition logs and counts a rejected transition of the order to status.
+func (ord *UserOrder) rejectTransition(order orderdb.Order, status string, source string, err error) {
+	ord.rejected.Add(1)
+	logger.Logger.Warn(
+		"Order status transition rejected",
+		zap.String("order", order.OrderID),
+		zap.String("from", order.Status),
+		zap.String("to", status),
+		zap.String("source", source),
+		zap.Error(err),
+	)
+}
+
+// RejectedTransitions returns the number of order status transitions
+// rejected since the start of the service.
+func (ord *UserOrder) RejectedTransitions() int64 {
+	return ord.rejected.Load()
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckTransition(t *testing.T) {
+	tests := []struct {
+		from    string
+		to      string
+		wantErr error
+	}{
+		{from: "NEW", to: "PROCESSING"},
+		{from: "NEW", to: "PROCESSED"},
+		{from: "PROCESSING", to: "PROCESSING"},
+		{from: "PROCESSING", to: "INVALID"},
+		{from: "PROCESSING", to: "STUCK"},
+		{from: "STUCK", to: "NEW"},
+		{from: "STUCK", to: "PROCESSED"},
+		{from: "NEW", to: "NEW", wantErr: ErrorIllegalTransition},
+		{from: "PROCESSED", to: "PROCESSING", wantErr: ErrorIllegalTransition},
+		{from: "PROCESSED", to: "INVALID", wantErr: ErrorIllegalTransition},
+		{from: "INVALID", to: "PROCESSED", wantErr: ErrorIllegalTransition},
+		{from: "PROCESSING", to: "NEW", wantErr: ErrorIllegalTransition},
+		{from: "REGISTERED", to: "PROCESSING", wantErr: ErrorIllegalTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.from+"->"+tt.to, func(t *testing.T) {
+				err := checkTransition(tt.from, tt.to)
+				if tt.wantErr == nil {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorIs(t, err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+func TestMapAccrualStatus(t *testing.T) {
+	tests := map[string]string{
+		"REGISTERED": "PROCESSING",
+		"PROCESSING": "PROCESSING",
+		"INVALID":    "INVALID",
+		"PROCESSED":  "PROCESSED",
+	}
+	for accrualStatus, want := range tests {
+		status, err := mapAccrualStatus(accrualStatus)
+		assert.NoError(t, err)
+		assert.Equal(t, want, status)
+	}
+
+	_, err := mapAccrualStatus("NEW")
+	assert.ErrorIs(t, err, ErrorUnknownAccrualStatus)
+}
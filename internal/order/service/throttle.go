@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ThrottledError is returned when the accrual system answers with
+// 429 Too Many Requests. RetryAfter holds the pause requested by the server.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("accrual system is throttling requests, retry after %s", e.RetryAfter)
+}
+
+// ThrottleState describes whether requests to the accrual system are paused.
+type ThrottleState struct {
+	Throttled   bool      `json:"throttled"`
+	PausedUntil time.Time `json:"paused_until,omitempty"`
+	Pauses      int64     `json:"pauses"`
+}
+
+// AccrualThrottle pauses all outgoing requests to the accrual system once it
+// asks us to slow down. Requests resume automatically when the pause is over.
+type AccrualThrottle struct {
+	mu          sync.Mutex
+	pausedUntil time.Time
+	throttled   bool
+	pauses      int64
+}
+
+// NewAccrualThrottle creates a new AccrualThrottle which is not paused.
+func NewAccrualThrottle() *AccrualThrottle {
+	return &AccrualThrottle{}
+}
+
+// Pause stops outgoing requests for the given duration. A shorter pause never
+// cuts an already running longer one.
+func (t *AccrualThrottle) Pause(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if !until.After(t.pausedUntil) {
+		return
+	}
+	if !t.throttled {
+		t.pauses++
+		logger.Logger.Warn(
+			"Accrual system is throttling requests, pausing",
+			zap.Duration("retry_after", d),
+			zap.Time("paused_until", until),
+		)
+	}
+	t.throttled = true
+	t.pausedUntil = until
+}
+
+// Wait blocks until the current pause, if any, is over.
+func (t *AccrualThrottle) Wait() {
+	for {
+		t.mu.Lock()
+		remaining := time.Until(t.pausedUntil)
+		if remaining <= 0 {
+			if t.throttled {
+				t.throttled = false
+				logger.Logger.Info("Accrual system requests resumed")
+			}
+			t.mu.Unlock()
+			return
+		}
+		t.mu.Unlock()
+
+		time.Sleep(remaining)
+	}
+}
+
+// State returns a snapshot of the throttle state.
+func (t *AccrualThrottle) State() ThrottleState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if time.Now().Before(t.pausedUntil) {
+		return ThrottleState{Throttled: true, PausedUntil: t.pausedUntil, Pauses: t.pauses}
+	}
+	return ThrottleState{Pauses: t.pauses}
+}
+
+// parseRetryAfter interprets the Retry-After header, which holds either
+// a number of seconds or an HTTP date. Missing or malformed values fall back
+// to config.DefaultRetryAfter. Zero, negative and past values are raised to
+// config.MinRetryAfter, so that a throttling server is never retried at once.
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return minRetryAfter(time.Duration(seconds) * time.Second)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return minRetryAfter(time.Until(date))
+	}
+	return config.DefaultRetryAfter
+}
+
+// minRetryAfter raises d to config.MinRetryAfter.
+func minRetryAfter(d time.Duration) time.Duration {
+	if d < config.MinRetryAfter {
+		return config.MinRetryAfter
+	}
+	return d
+}
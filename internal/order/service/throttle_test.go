@@ -0,0 +1,105 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "Seconds", value: "2", want: 2 * time.Second},
+		{name: "Empty", value: "", want: config.DefaultRetryAfter},
+		{name: "Malformed", value: "soon", want: config.DefaultRetryAfter},
+		{name: "Zero", value: "0", want: config.MinRetryAfter},
+		{name: "Negative", value: "-5", want: config.MinRetryAfter},
+		{name: "Date in the past", value: "Mon, 02 Jan 2006 15:04:05 GMT", want: config.MinRetryAfter},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.want, parseRetryAfter(tt.value))
+			},
+		)
+	}
+}
+
+func TestAccrualThrottle_State(t *testing.T) {
+	throttle := NewAccrualThrottle()
+	assert.False(t, throttle.State().Throttled)
+
+	throttle.Pause(50 * time.Millisecond)
+	throttle.Pause(time.Millisecond)
+	state := throttle.State()
+	assert.True(t, state.Throttled)
+	assert.Equal(t, int64(1), state.Pauses)
+
+	start := time.Now()
+	throttle.Wait()
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	assert.False(t, throttle.State().Throttled)
+}
+
+func TestAccrualPoller_PollThrottled(t *testing.T) {
+	fake := NewFakeAccrualClient()
+	fake.Script(
+		"0",
+		FakeAccrualResponse{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     http.Header{"Retry-After": []string{"1"}},
+		},
+		FakeAccrualResponse{StatusCode: http.StatusNoContent},
+	)
+
+	mockRepo := NewMockOrderRepository()
+	userID := uuid.New()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, mockRepo.AddOrder(strconv.Itoa(i), userID, "NEW", 0.0))
+	}
+
+	poller := NewAccrualPoller(NewOrder(mockRepo, fake), nil, 1, 10)
+	start := time.Now()
+	assert.NoError(t, poller.Poll())
+
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Equal(t, 4, fake.TotalCalls())
+	assert.Equal(t, int64(1), poller.Status().Throttle.Pauses)
+	for _, order := range mockRepo.Orders {
+		assert.Equal(t, "INVALID", order.Status)
+	}
+}
+
+func TestAccrualPoller_PollThrottledWithoutPause(t *testing.T) {
+	fake := NewFakeAccrualClient()
+	responses := make([]FakeAccrualResponse, 0, config.MaxThrottledRetries+2)
+	for i := 0; i <= config.MaxThrottledRetries+1; i++ {
+		responses = append(
+			responses, FakeAccrualResponse{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"Retry-After": []string{"0"}},
+			},
+		)
+	}
+	fake.Script("0", responses...)
+
+	mockRepo := NewMockOrderRepository()
+	assert.NoError(t, mockRepo.AddOrder("0", uuid.New(), "NEW", 0.0))
+
+	poller := NewAccrualPoller(NewOrder(mockRepo, fake), nil, 1, 10)
+	start := time.Now()
+	assert.ErrorIs(t, poller.Poll(), ErrorCheckingOrders)
+
+	assert.GreaterOrEqual(t, time.Since(start), time.Duration(config.MaxThrottledRetries)*config.MinRetryAfter)
+	assert.Equal(t, config.MaxThrottledRetries+1, fake.TotalCalls())
+	assert.Equal(t, "NEW", mockRepo.Orders["0"].Status)
+}
@@ -0,0 +1,38 @@
+// Package security provides functions for signing and verifying payloads
+// exchanged with external systems.
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// SignaturePrefix prefixes the hex encoded HMAC-SHA256 in signature headers.
+const SignaturePrefix = "sha256="
+
+// SignPayload returns the signature of the payload: the hex encoded
+// HMAC-SHA256 of the payload with the shared secret, prefixed by SignaturePrefix.
+func SignPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return SignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks in constant time that signature is a valid
+// signature of the payload. The SignaturePrefix is optional.
+// An empty secret never verifies.
+func VerifySignature(secret string, payload []byte, signature string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, SignaturePrefix))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,43 @@
+package security
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"order": "79927398713", "status": "PROCESSED", "accrual": 500}`)
+	signature := SignPayload("secret", payload)
+
+	tests := []struct {
+		name      string
+		secret    string
+		payload   []byte
+		signature string
+		want      bool
+	}{
+		{name: "Valid", secret: "secret", payload: payload, signature: signature, want: true},
+		{
+			name:      "Valid without prefix",
+			secret:    "secret",
+			payload:   payload,
+			signature: strings.TrimPrefix(signature, SignaturePrefix),
+			want:      true,
+		},
+		{name: "Wrong secret", secret: "other", payload: payload, signature: signature, want: false},
+		{name: "Tampered payload", secret: "secret", payload: []byte(`{}`), signature: signature, want: false},
+		{name: "Not hex", secret: "secret", payload: payload, signature: "sha256=zz", want: false},
+		{name: "Empty secret", secret: "", payload: payload, signature: SignPayload("", payload), want: false},
+		{name: "Empty signature", secret: "secret", payload: payload, signature: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.want, VerifySignature(tt.secret, tt.payload, tt.signature))
+			},
+		)
+	}
+}
@@ -3,20 +3,65 @@ package internal
 import (
 	authService "github.com/elina-chertova/loyalty-system/internal/auth/service"
 	balService "github.com/elina-chertova/loyalty-system/internal/balance/service"
+	campService "github.com/elina-chertova/loyalty-system/internal/campaign/service"
+	"github.com/elina-chertova/loyalty-system/internal/config"
 	"github.com/elina-chertova/loyalty-system/internal/db"
 	ordService "github.com/elina-chertova/loyalty-system/internal/order/service"
+	"github.com/elina-chertova/loyalty-system/pkg/breaker"
 )
 
 type services struct {
 	User    *authService.UserAuth
 	Order   *ordService.UserOrder
 	Balance *balService.UserBalance
+	Poller  *ordService.AccrualPoller
+
+	Campaign *campService.Campaigns
 }
 
-func NewServices(s *db.Models) *services {
+func NewServices(s *db.Models, params *config.Settings) *services {
+	accrualBreaker := breaker.New(
+		"accrual",
+		breaker.Settings{
+			FailureThreshold:  params.BreakerFailureThreshold,
+			OpenTimeout:       params.BreakerOpenTimeout,
+			HalfOpenSuccesses: params.BreakerHalfOpenSuccesses,
+		},
+	)
+	order := ordService.NewOrder(
+		s.Order,
+		ordService.NewBreakerAccrualClient(
+			ordService.NewHTTPAccrualClient(params.AccrualSystemAddress),
+			accrualBreaker,
+		),
+	)
+	order.Retry = ordService.RetryPolicy{
+		MaxAttempts: params.AccrualMaxAttempts,
+		BaseDelay:   params.AccrualRetryBase,
+		MaxDelay:    params.AccrualRetryMax,
+	}
+	balance := balService.NewBalance(s.Balance)
+	balance.UserRep = s.User
+	balance.Limits = balService.TransferLimits{
+		MaxAmount:  params.TransferMaxAmount,
+		DailyLimit: params.TransferDailyLimit,
+	}
+	balance.Tiers = params.Tiers
+	balance.TierWindow = params.TierWindow
+	campaign := campService.NewCampaigns(s.Campaign)
+	campaign.Tiers = params.Tiers
+	balance.Campaigns = campaign
 	return &services{
 		User:    authService.NewUserAuth(s.User),
-		Order:   ordService.NewOrder(s.Order),
-		Balance: balService.NewBalance(s.Balance),
+		Order:   order,
+		Balance: balance,
+		Poller: ordService.NewAccrualPoller(
+			order,
+			accrualBreaker,
+			params.AccrualWorkers,
+			params.AccrualBatchSize,
+		),
+
+		Campaign: campaign,
 	}
 }
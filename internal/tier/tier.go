@@ -0,0 +1,145 @@
+// Package tier describes the loyalty tiers. A user is assigned the highest
+// tier whose threshold the user's credited accrual over a rolling window
+// reaches, and the accruals of the user are multiplied by the tier's
+// multiplier.
+package tier
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+)
+
+// ErrorInvalidTiers is returned when the tiers cannot be parsed.
+var ErrorInvalidTiers = errors.New("invalid tiers")
+
+// Multiplier is a multiplier of accruals in hundredths, e.g. 125 for 1.25.
+type Multiplier int64
+
+// One is the multiplier which leaves accruals unchanged.
+const One Multiplier = 100
+
+// ParseMultiplier converts a decimal multiplier, e.g. "1.25", to Multiplier.
+func ParseMultiplier(s string) (Multiplier, error) {
+	p, err := money.Parse(s)
+	if err != nil || p < money.Points(One) {
+		return 0, fmt.Errorf("%w: multiplier %q must be at least 1", ErrorInvalidTiers, s)
+	}
+	return Multiplier(p), nil
+}
+
+// String formats the multiplier as a decimal number, e.g. "1.25".
+func (m Multiplier) String() string {
+	return money.Points(m).String()
+}
+
+// MarshalJSON encodes the multiplier as a JSON number.
+func (m Multiplier) MarshalJSON() ([]byte, error) {
+	return money.Points(m).MarshalJSON()
+}
+
+// UnmarshalJSON decodes the multiplier from a JSON number or a string holding
+// a number. null leaves the multiplier unchanged.
+func (m *Multiplier) UnmarshalJSON(data []byte) error {
+	return (*money.Points)(m).UnmarshalJSON(data)
+}
+
+// Bonus returns the points added to the accrual by the multiplier, rounded
+// to the nearest hundredth, halves away from zero.
+func (m Multiplier) Bonus(accrual money.Points) money.Points {
+	bonus := int64(accrual) * int64(m-One)
+	if bonus >= 0 {
+		return money.Points((bonus + int64(One)/2) / int64(One))
+	}
+	return money.Points((bonus - int64(One)/2) / int64(One))
+}
+
+// Tier is a loyalty tier reached once the credited accrual of a user is at
+// least Threshold.
+type Tier struct {
+	Name       string
+	Threshold  money.Points
+	Multiplier Multiplier
+}
+
+// Tiers are the loyalty tiers ordered by threshold, the lowest one starting
+// at zero. *Tiers can be used as a flag.Value.
+type Tiers []Tier
+
+// Parse converts a comma-separated list of name:threshold:multiplier tiers,
+// e.g. "bronze:0:1,silver:1000:1.1,gold:5000:1.25", to Tiers.
+func Parse(s string) (Tiers, error) {
+	var tiers Tiers
+	for _, spec := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(spec), ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("%w: %q is not name:threshold:multiplier", ErrorInvalidTiers, spec)
+		}
+		threshold, err := money.Parse(parts[1])
+		if err != nil || threshold < 0 {
+			return nil, fmt.Errorf("%w: threshold %q", ErrorInvalidTiers, parts[1])
+		}
+		multiplier, err := ParseMultiplier(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, Tier{Name: parts[0], Threshold: threshold, Multiplier: multiplier})
+	}
+
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].Threshold < tiers[j].Threshold })
+	if tiers[0].Threshold != 0 {
+		return nil, fmt.Errorf("%w: the lowest tier must start at 0", ErrorInvalidTiers)
+	}
+	for i := 1; i < len(tiers); i++ {
+		if tiers[i].Threshold == tiers[i-1].Threshold {
+			return nil, fmt.Errorf("%w: tiers %q and %q have the same threshold", ErrorInvalidTiers, tiers[i-1].Name, tiers[i].Name)
+		}
+	}
+	return tiers, nil
+}
+
+// For returns the highest tier whose threshold the accrual reaches.
+// The tiers must not be empty.
+func (tiers Tiers) For(accrual money.Points) Tier {
+	reached := tiers[0]
+	for _, t := range tiers[1:] {
+		if accrual >= t.Threshold {
+			reached = t
+		}
+	}
+	return reached
+}
+
+// ByName returns the tier with the given name, or the lowest tier if there
+// is none, e.g. for a user who has not been assigned a tier yet.
+// The tiers must not be empty.
+func (tiers Tiers) ByName(name string) Tier {
+	for _, t := range tiers {
+		if t.Name == name {
+			return t
+		}
+	}
+	return tiers[0]
+}
+
+// String formats the tiers in the format accepted by Parse.
+func (tiers Tiers) String() string {
+	specs := make([]string, 0, len(tiers))
+	for _, t := range tiers {
+		specs = append(specs, fmt.Sprintf("%s:%s:%s", t.Name, t.Threshold, t.Multiplier))
+	}
+	return strings.Join(specs, ",")
+}
+
+// Set parses the tiers, so that *Tiers can be used as a flag.Value.
+func (tiers *Tiers) Set(s string) error {
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*tiers = parsed
+	return nil
+}
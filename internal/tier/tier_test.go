@@ -0,0 +1,71 @@
+package tier
+
+import (
+	"testing"
+
+	"github.com/elina-chertova/loyalty-system/pkg/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tiers, err := Parse("gold:5000:1.25, bronze:0:1,silver:1000:1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "bronze:0:1,silver:1000:1.1,gold:5000:1.25", tiers.String())
+
+	for _, spec := range []string{
+		"",
+		"bronze:0",
+		"silver:1000:1.1",
+		"bronze:0:1,silver:0:1.1",
+		"bronze:0:0.5",
+		"bronze:-1:1",
+		"bronze:0:x",
+	} {
+		_, err := Parse(spec)
+		assert.ErrorIs(t, err, ErrorInvalidTiers, spec)
+	}
+}
+
+func TestTiers_For(t *testing.T) {
+	tiers, err := Parse("bronze:0:1,silver:1000:1.1,gold:5000:1.25")
+	require.NoError(t, err)
+
+	assert.Equal(t, "bronze", tiers.For(0).Name)
+	assert.Equal(t, "bronze", tiers.For(money.FromFloat(999.99)).Name)
+	assert.Equal(t, "silver", tiers.For(money.FromFloat(1000)).Name)
+	assert.Equal(t, "gold", tiers.For(money.FromFloat(10000)).Name)
+	assert.Equal(t, "silver", tiers.ByName("silver").Name)
+	assert.Equal(t, "bronze", tiers.ByName("platinum").Name)
+}
+
+func TestMultiplier_Bonus(t *testing.T) {
+	tests := []struct {
+		multiplier string
+		accrual    float64
+		want       float64
+	}{
+		{"1", 100, 0},
+		{"1.1", 100, 10},
+		{"1.25", 729.98, 182.5},
+		{"1.25", 0.02, 0.01},
+		{"1.5", 0.01, 0.01},
+	}
+	for _, tt := range tests {
+		m, err := ParseMultiplier(tt.multiplier)
+		require.NoError(t, err)
+		assert.Equal(t, money.FromFloat(tt.want), m.Bonus(money.FromFloat(tt.accrual)), tt.multiplier)
+	}
+}
+
+func TestMultiplier_JSON(t *testing.T) {
+	var m Multiplier
+	require.NoError(t, m.UnmarshalJSON([]byte(`1.5`)))
+	assert.Equal(t, Multiplier(150), m)
+	require.NoError(t, m.UnmarshalJSON([]byte(`"2"`)))
+	assert.Equal(t, Multiplier(200), m)
+
+	data, err := m.MarshalJSON()
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(data))
+}
@@ -0,0 +1,109 @@
+// Package worker runs the background jobs of the loyalty system.
+package worker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	balService "github.com/elina-chertova/loyalty-system/internal/balance/service"
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	ordService "github.com/elina-chertova/loyalty-system/internal/order/service"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// AccrualWorker checks pending orders against the accrual system and credits
+// the processed ones to user balances. It runs as soon as it is woken up,
+// e.g. by a new order notification, when the earliest pending order is due,
+// or after the idle interval when nothing is pending.
+type AccrualWorker struct {
+	poller       *ordService.AccrualPoller
+	order        *ordService.UserOrder
+	balance      *balService.UserBalance
+	wake         <-chan struct{}
+	idleInterval time.Duration
+}
+
+// NewAccrualWorker creates a new AccrualWorker. A non-positive idleInterval
+// falls back to config.DefaultIdleInterval.
+func NewAccrualWorker(
+	poller *ordService.AccrualPoller,
+	order *ordService.UserOrder,
+	balance *balService.UserBalance,
+	wake <-chan struct{},
+	idleInterval time.Duration,
+) *AccrualWorker {
+	if idleInterval <= 0 {
+		idleInterval = config.DefaultIdleInterval
+	}
+	return &AccrualWorker{
+		poller:       poller,
+		order:        order,
+		balance:      balance,
+		wake:         wake,
+		idleInterval: idleInterval,
+	}
+}
+
+// Run processes orders until ctx is done.
+func (w *AccrualWorker) Run(ctx context.Context) {
+	for {
+		w.updateOrderStatus()
+		w.updateBalance()
+
+		timer := time.NewTimer(w.nextRunIn())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-w.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// nextRunIn returns how long to sleep until the earliest pending order is
+// due, but no longer than the idle interval and no shorter than
+// config.UpdateInterval.
+func (w *AccrualWorker) nextRunIn() time.Duration {
+	nextCheckAt, pending, err := w.order.NextCheckAt()
+	if err != nil {
+		logger.Logger.Warn("Next order check time is unknown", zap.Error(err))
+		return config.UpdateInterval
+	}
+	if !pending {
+		return w.idleInterval
+	}
+
+	wait := time.Until(nextCheckAt)
+	if wait > w.idleInterval {
+		return w.idleInterval
+	}
+	if wait < config.UpdateInterval {
+		return config.UpdateInterval
+	}
+	return wait
+}
+
+// updateOrderStatus checks and updates the status of pending orders
+// by communicating with the external accrual system.
+func (w *AccrualWorker) updateOrderStatus() {
+	err := w.poller.Poll()
+	if errors.Is(err, ordService.ErrorAccrualCircuitOpen) {
+		logger.Logger.Debug("Accrual system is unavailable, polling is paused", zap.Error(err))
+		return
+	}
+	if err != nil {
+		logger.Logger.Warn("Order status has not been updated", zap.Error(err))
+	}
+}
+
+// updateBalance updates user balances based on the latest order accruals.
+func (w *AccrualWorker) updateBalance() {
+	err := w.balance.UpdateBalance(w.order)
+	if err != nil {
+		logger.Logger.Warn("Balance has not been updated", zap.Error(err))
+	}
+}
@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	balService "github.com/elina-chertova/loyalty-system/internal/balance/service"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ExpiryWorker periodically expires the points whose lots are overdue.
+type ExpiryWorker struct {
+	balance  *balService.UserBalance
+	interval time.Duration
+}
+
+// NewExpiryWorker creates a new ExpiryWorker running every interval.
+func NewExpiryWorker(balance *balService.UserBalance, interval time.Duration) *ExpiryWorker {
+	return &ExpiryWorker{balance: balance, interval: interval}
+}
+
+// Run expires points until ctx is done.
+func (w *ExpiryWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		expired, err := w.balance.ExpirePoints()
+		if err != nil {
+			logger.Logger.Warn("Points have not been expired", zap.Error(err))
+		}
+		if expired > 0 {
+			logger.Logger.Info("Points expired", zap.Stringer("points", expired))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	balService "github.com/elina-chertova/loyalty-system/internal/balance/service"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// HoldWorker periodically releases the holds whose TTL has elapsed.
+type HoldWorker struct {
+	balance  *balService.UserBalance
+	interval time.Duration
+}
+
+// NewHoldWorker creates a new HoldWorker running every interval.
+func NewHoldWorker(balance *balService.UserBalance, interval time.Duration) *HoldWorker {
+	return &HoldWorker{balance: balance, interval: interval}
+}
+
+// Run releases expired holds until ctx is done.
+func (w *HoldWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		released, err := w.balance.ExpireHolds()
+		if err != nil {
+			logger.Logger.Warn("Holds have not been expired", zap.Error(err))
+		}
+		if released > 0 {
+			logger.Logger.Info("Holds expired", zap.Int("holds", released))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/internal/config"
+	"github.com/elina-chertova/loyalty-system/internal/db/idempotencydb"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// IdempotencyWorker periodically deletes the idempotency keys older than
+// config.IdempotencyKeyTTL.
+type IdempotencyWorker struct {
+	keys     idempotencydb.IdempotencyRepository
+	interval time.Duration
+}
+
+// NewIdempotencyWorker creates a new IdempotencyWorker running every interval.
+func NewIdempotencyWorker(keys idempotencydb.IdempotencyRepository, interval time.Duration) *IdempotencyWorker {
+	return &IdempotencyWorker{keys: keys, interval: interval}
+}
+
+// Run deletes expired idempotency keys until ctx is done.
+func (w *IdempotencyWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		deleted, err := w.keys.DeleteExpiredKeys(time.Now().Add(-config.IdempotencyKeyTTL))
+		if err != nil {
+			logger.Logger.Warn("Idempotency keys have not been deleted", zap.Error(err))
+		}
+		if deleted > 0 {
+			logger.Logger.Info("Idempotency keys expired", zap.Int64("keys", deleted))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
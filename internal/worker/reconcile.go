@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	balService "github.com/elina-chertova/loyalty-system/internal/balance/service"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ReconcileWorker periodically verifies the cached balances against
+// the points ledger.
+type ReconcileWorker struct {
+	balance  *balService.UserBalance
+	interval time.Duration
+}
+
+// NewReconcileWorker creates a new ReconcileWorker running every interval.
+func NewReconcileWorker(balance *balService.UserBalance, interval time.Duration) *ReconcileWorker {
+	return &ReconcileWorker{balance: balance, interval: interval}
+}
+
+// Run reconciles the balances until ctx is done.
+func (w *ReconcileWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		discrepancies, err := w.balance.Reconcile()
+		if err != nil {
+			logger.Logger.Warn("Balances have not been reconciled", zap.Error(err))
+		} else if len(discrepancies) > 0 {
+			logger.Logger.Error(
+				"Balances differ from the ledger",
+				zap.Int("users", len(discrepancies)),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	balService "github.com/elina-chertova/loyalty-system/internal/balance/service"
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// TierWorker recomputes the loyalty tiers of all users every night.
+type TierWorker struct {
+	balance *balService.UserBalance
+	hour    int
+}
+
+// NewTierWorker creates a new TierWorker running daily at the given hour, UTC.
+func NewTierWorker(balance *balService.UserBalance, hour int) *TierWorker {
+	return &TierWorker{balance: balance, hour: hour}
+}
+
+// Run recomputes tiers every night until ctx is done.
+func (w *TierWorker) Run(ctx context.Context) {
+	for {
+		timer := time.NewTimer(w.untilNextRun(time.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		changed, err := w.balance.RecomputeTiers()
+		if err != nil {
+			logger.Logger.Warn("Tiers have not been recomputed", zap.Error(err))
+			continue
+		}
+		logger.Logger.Info("Tiers recomputed", zap.Int("changed", changed))
+	}
+}
+
+// untilNextRun returns the time from now until the next run.
+func (w *TierWorker) untilNextRun(now time.Time) time.Duration {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), w.hour, 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next.Sub(now)
+}
@@ -0,0 +1,205 @@
+// Package breaker provides a circuit breaker which stops calls to a failing
+// dependency for a while instead of hammering it with requests that are
+// bound to fail.
+//
+// The breaker starts closed and lets every call through. After
+// FailureThreshold consecutive failures it opens and rejects calls for
+// OpenTimeout. Then it becomes half-open and lets single probe calls through:
+// HalfOpenSuccesses successful probes close it again, a failed probe opens it
+// for another OpenTimeout.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elina-chertova/loyalty-system/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+// Circuit breaker states.
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrorOpen is returned by Allow while the breaker rejects calls.
+var ErrorOpen = errors.New("circuit breaker is open")
+
+// Settings configures a Breaker. Non-positive values are replaced by
+// the defaults of 5 failures, 30 seconds and 1 success.
+type Settings struct {
+	FailureThreshold  int
+	OpenTimeout       time.Duration
+	HalfOpenSuccesses int
+}
+
+// Snapshot describes the state of a Breaker at some moment.
+type Snapshot struct {
+	Name                string     `json:"name"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+// Breaker is a circuit breaker safe for concurrent use.
+type Breaker struct {
+	mu       sync.Mutex
+	name     string
+	settings Settings
+
+	state     State
+	failures  int
+	successes int
+	probing   bool
+	openedAt  time.Time
+
+	now func() time.Time
+}
+
+// New creates a closed Breaker. The name is used in logs and snapshots.
+func New(name string, settings Settings) *Breaker {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = 5
+	}
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = 30 * time.Second
+	}
+	if settings.HalfOpenSuccesses <= 0 {
+		settings.HalfOpenSuccesses = 1
+	}
+	return &Breaker{name: name, settings: settings, now: time.Now}
+}
+
+// Allow reports whether a call may be made now. It returns ErrorOpen while
+// the breaker is open, or while it is half-open and a probe is in flight.
+// Every allowed call must be followed by Success or Failure.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if b.now().Before(b.openedAt.Add(b.settings.OpenTimeout)) {
+			return ErrorOpen
+		}
+		b.setState(StateHalfOpen)
+		b.probing = true
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return ErrorOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Success records a successful call.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	if b.state != StateHalfOpen {
+		return
+	}
+	b.probing = false
+	b.successes++
+	if b.successes >= b.settings.HalfOpenSuccesses {
+		b.setState(StateClosed)
+	}
+}
+
+// Failure records a failed call.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	switch b.state {
+	case StateHalfOpen:
+		b.probing = false
+		b.open()
+	case StateClosed:
+		if b.failures >= b.settings.FailureThreshold {
+			b.open()
+		}
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Snapshot returns the current state of the breaker for reporting.
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := Snapshot{
+		Name:                b.name,
+		State:               b.state.String(),
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		retryAt := b.openedAt.Add(b.settings.OpenTimeout)
+		snapshot.OpenedAt = &openedAt
+		snapshot.RetryAt = &retryAt
+	}
+	return snapshot
+}
+
+// open moves the breaker to the open state. The caller must hold b.mu.
+func (b *Breaker) open() {
+	b.openedAt = b.now()
+	b.setState(StateOpen)
+}
+
+// setState changes the state and logs the transition. The caller must hold b.mu.
+func (b *Breaker) setState(state State) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+	b.successes = 0
+
+	fields := []zap.Field{
+		zap.String("breaker", b.name),
+		zap.String("from", from.String()),
+		zap.String("to", state.String()),
+		zap.Int("consecutive_failures", b.failures),
+	}
+	if state == StateOpen {
+		logger.Logger.Warn("Circuit breaker state changed", fields...)
+		return
+	}
+	logger.Logger.Info("Circuit breaker state changed", fields...)
+}
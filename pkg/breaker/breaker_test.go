@@ -0,0 +1,60 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBreaker(settings Settings) (*Breaker, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := New("test", settings)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreaker_Transitions(t *testing.T) {
+	b, now := newTestBreaker(
+		Settings{FailureThreshold: 3, OpenTimeout: time.Minute, HalfOpenSuccesses: 2},
+	)
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, b.Allow())
+		b.Failure()
+	}
+	assert.NoError(t, b.Allow())
+	b.Success()
+	assert.Equal(t, StateClosed, b.State(), "a success resets the consecutive failures")
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, b.Allow())
+		b.Failure()
+	}
+	assert.Equal(t, StateOpen, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrorOpen)
+	snapshot := b.Snapshot()
+	assert.Equal(t, "open", snapshot.State)
+	assert.Equal(t, now.Add(time.Minute), *snapshot.RetryAt)
+
+	*now = now.Add(time.Minute)
+	assert.NoError(t, b.Allow())
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrorOpen, "only one probe at a time")
+	b.Failure()
+	assert.Equal(t, StateOpen, b.State(), "a failed probe opens the breaker again")
+
+	*now = now.Add(time.Minute)
+	assert.NoError(t, b.Allow())
+	b.Success()
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.NoError(t, b.Allow())
+	b.Success()
+	assert.Equal(t, StateClosed, b.State())
+	assert.Nil(t, b.Snapshot().OpenedAt)
+}
+
+func TestBreaker_Defaults(t *testing.T) {
+	b := New("defaults", Settings{})
+	assert.Equal(t, Settings{FailureThreshold: 5, OpenTimeout: 30 * time.Second, HalfOpenSuccesses: 1}, b.settings)
+}
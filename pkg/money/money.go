@@ -0,0 +1,157 @@
+// Package money provides an exact representation of loyalty points.
+//
+// Points are kept as an integer number of hundredths of a point, so adding
+// and subtracting them never accumulates rounding errors. Values with more
+// than two decimal places are rounded to the nearest hundredth, halves away
+// from zero. Points are encoded in JSON as decimal numbers, e.g. 729.98, and
+// stored in Postgres as NUMERIC.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of minor units in a point.
+const Scale = 100
+
+// Points is an amount of loyalty points in hundredths of a point.
+type Points int64
+
+// ErrorInvalidPoints is returned when a value cannot be converted to Points.
+var ErrorInvalidPoints = errors.New("invalid points value")
+
+// FromFloat converts a floating-point number of points to Points, rounding
+// it to the nearest hundredth.
+func FromFloat(f float64) Points {
+	return Points(math.Round(f * Scale))
+}
+
+// Parse converts a decimal number of points, e.g. "729.98", "-3" or "1e2",
+// to Points, rounding it to the nearest hundredth.
+func Parse(s string) (Points, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrorInvalidPoints, s)
+	}
+	r.Mul(r, big.NewRat(Scale, 1))
+
+	quo, rem := new(big.Int).QuoRem(new(big.Int).Abs(r.Num()), r.Denom(), new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(r.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		quo.Neg(quo)
+	}
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("%w: %q is out of range", ErrorInvalidPoints, s)
+	}
+	return Points(quo.Int64()), nil
+}
+
+// Float64 returns the number of points as a floating-point number.
+// It is meant for display and metrics only, never for arithmetic.
+func (p Points) Float64() float64 {
+	return float64(p) / Scale
+}
+
+// String formats the points as a decimal number without trailing zeros,
+// e.g. "500", "0.5" or "729.98".
+func (p Points) String() string {
+	sign := ""
+	abs := uint64(p)
+	if p < 0 {
+		sign = "-"
+		abs = uint64(-p)
+	}
+
+	s := sign + strconv.FormatUint(abs/Scale, 10)
+	switch frac := abs % Scale; {
+	case frac == 0:
+		return s
+	case frac%10 == 0:
+		return fmt.Sprintf("%s.%d", s, frac/10)
+	default:
+		return fmt.Sprintf("%s.%02d", s, frac)
+	}
+}
+
+// MarshalJSON encodes the points as a JSON number.
+func (p Points) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalJSON decodes the points from a JSON number or a string holding
+// a number. null leaves the points unchanged.
+func (p *Points) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	points, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*p = points
+	return nil
+}
+
+// Set parses the points from a decimal number, so that *Points can be used
+// as a flag.Value.
+func (p *Points) Set(s string) error {
+	points, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*p = points
+	return nil
+}
+
+// GormDataType returns the type of the database column holding the points.
+func (Points) GormDataType() string {
+	return "numeric(20,2)"
+}
+
+// Value implements driver.Valuer, storing the points as a decimal number.
+func (p Points) Value() (driver.Value, error) {
+	return p.String(), nil
+}
+
+// Scan implements sql.Scanner, reading the points from a NUMERIC, integer
+// or floating-point column. NULL is read as zero.
+func (p *Points) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*p = 0
+	case int64:
+		*p = Points(v * Scale)
+	case float64:
+		*p = FromFloat(v)
+	case []byte:
+		return p.scanString(string(v))
+	case string:
+		return p.scanString(v)
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrorInvalidPoints, src)
+	}
+	return nil
+}
+
+// scanString reads the points from a decimal number.
+func (p *Points) scanString(s string) error {
+	points, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*p = points
+	return nil
+}
@@ -0,0 +1,113 @@
+package money
+
+import (
+	"encoding/json"
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Points
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "500", want: 50000},
+		{in: "729.98", want: 72998},
+		{in: "0.1", want: 10},
+		{in: "-3.5", want: -350},
+		{in: "1e2", want: 10000},
+		{in: "1.005", want: 101},
+		{in: "1.004", want: 100},
+		{in: "-1.005", want: -101},
+		{in: "abc", wantErr: true},
+		{in: "1e30", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.in, func(t *testing.T) {
+				got, err := Parse(tt.in)
+				if tt.wantErr {
+					assert.ErrorIs(t, err, ErrorInvalidPoints)
+					return
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			},
+		)
+	}
+}
+
+func TestPoints_String(t *testing.T) {
+	tests := map[Points]string{
+		0:      "0",
+		50000:  "500",
+		72998:  "729.98",
+		50:     "0.5",
+		5:      "0.05",
+		-350:   "-3.5",
+		-1:     "-0.01",
+		100001: "1000.01",
+	}
+	for points, want := range tests {
+		assert.Equal(t, want, points.String())
+	}
+}
+
+func TestPoints_NoDrift(t *testing.T) {
+	var balance Points
+	for i := 0; i < 1000; i++ {
+		balance += FromFloat(0.1)
+		balance += FromFloat(0.2)
+	}
+	assert.Equal(t, "300", balance.String())
+}
+
+func TestPoints_JSON(t *testing.T) {
+	var v struct {
+		Accrual Points  `json:"accrual"`
+		Sum     Points  `json:"sum"`
+		Missing *Points `json:"missing,omitempty"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"accrual": 729.98, "sum": "0.3"}`), &v))
+	assert.Equal(t, Points(72998), v.Accrual)
+	assert.Equal(t, Points(30), v.Sum)
+
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"accrual": 729.98, "sum": 0.3}`, string(data))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"sum": true}`), &v))
+}
+
+func TestPoints_Flag(t *testing.T) {
+	p := Points(1000 * Scale)
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Var(&p, "limit", "")
+	assert.Equal(t, "1000", flags.Lookup("limit").DefValue)
+
+	assert.NoError(t, flags.Parse([]string{"-limit", "250.5"}))
+	assert.Equal(t, Points(25050), p)
+	assert.Error(t, flags.Parse([]string{"-limit", "ten"}))
+}
+
+func TestPoints_Scan(t *testing.T) {
+	var p Points
+	assert.NoError(t, p.Scan([]byte("12.34")))
+	assert.Equal(t, Points(1234), p)
+	assert.NoError(t, p.Scan(int64(5)))
+	assert.Equal(t, Points(500), p)
+	assert.NoError(t, p.Scan(0.3))
+	assert.Equal(t, Points(30), p)
+	assert.NoError(t, p.Scan(nil))
+	assert.Equal(t, Points(0), p)
+	assert.Error(t, p.Scan(true))
+
+	value, err := Points(-1050).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "-10.5", value)
+}